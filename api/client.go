@@ -1,15 +1,36 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Client is a warehouse API client
 type Client struct {
 	baseURL    string
 	httpClient *http.Client
+	strict     bool                  // Whether unknown response fields are rejected
+	cache      map[string]cachedItem // Last item details by UUID, nil if caching is disabled
+	cacheM     sync.Mutex            // Guards cache
+}
+
+// cachedItem is the last item details along with validators to revalidate them
+type cachedItem struct {
+	item         Item
+	etag         string
+	lastModified string
 }
 
 // Item represents a response from `/item/{uuid}` API endpoint
@@ -19,6 +40,38 @@ type Item struct {
 	Quantity int    `json:"quantity"`
 }
 
+// itemFields are required fields of `/item/{uuid}` response
+var itemFields = []string{"uuid", "name", "quantity"}
+
+// Alert is an optional payload of `/low-stock-alert/{uuid}` API call
+type Alert struct {
+	Quantity   int       `json:"quantity"`              // Observed quantity
+	Threshold  int       `json:"threshold"`             // Threshold the quantity fell below
+	Name       string    `json:"name,omitempty"`        // Item name
+	ObservedAt time.Time `json:"observed_at"`           // When the quantity was observed
+	InstanceID string    `json:"instance_id,omitempty"` // Worker instance that raised the alert
+	Reason     string    `json:"reason,omitempty"`      // Why the alert was raised
+	Severity   string    `json:"severity,omitempty"`    // Severity of the alert
+	Rules      []string  `json:"rules,omitempty"`       // Names of matched rules
+	Cycles     int       `json:"cycles,omitempty"`      // Consecutive checks the item has been in this alert state
+
+	StateSince *time.Time `json:"state_since,omitempty"` // When the item entered this alert state
+
+	PredictedStockoutAt *time.Time `json:"predicted_stockout_at,omitempty"` // Projected time of running out of stock
+}
+
+// Alert reasons
+const (
+	ReasonRule              = "rule"
+	ReasonPredictedStockout = "predicted_stockout"
+)
+
+// IdempotencyKey returns a key that is the same for all attempts to deliver the alert about `uuid`
+func (a Alert) IdempotencyKey(uuid string) string {
+	sum := sha256.Sum256([]byte(uuid + "|" + a.InstanceID + "|" + strconv.FormatInt(a.ObservedAt.UnixNano(), 10)))
+	return hex.EncodeToString(sum[:16])
+}
+
 const (
 	getItemPath   = "/item/"
 	postAlertPath = "/low-stock-alert/"
@@ -28,13 +81,110 @@ const (
 func New(baseURL string) *Client {
 	return &Client{
 		baseURL:    strings.TrimSuffix(baseURL, "/"),
-		httpClient: http.DefaultClient,
+		httpClient: &http.Client{},
 	}
 }
 
-// GetItem performs a GET API call to `/item/{uuid}`
+// WithTransport makes the client send requests through `t`, e.g. to trace them
+func (c *Client) WithTransport(t http.RoundTripper) *Client {
+	c.httpClient.Transport = t
+	return c
+}
+
+// WithTimeout limits the time a request may take, including reading the response, 0 for no limit.
+// Requests exceeding it fail with an error reporting timeout.
+func (c *Client) WithTimeout(d time.Duration) *Client {
+	c.httpClient.Timeout = d
+	return c
+}
+
+// WithStrictDecoding makes the client reject item responses having fields it does not know.
+// By default such fields are ignored, so the API can add fields without breaking the client.
+func (c *Client) WithStrictDecoding(strict bool) *Client {
+	c.strict = strict
+	return c
+}
+
+// WithCache makes the client keep the last details of every item and revalidate them
+// with `If-None-Match` and `If-Modified-Since` headers, so unchanged items are not downloaded again
+func (c *Client) WithCache() *Client {
+	c.cacheM.Lock()
+	c.cache = make(map[string]cachedItem)
+	c.cacheM.Unlock()
+	return c
+}
+
+// Forget drops cached details of the item
+func (c *Client) Forget(uuid string) {
+	c.cacheM.Lock()
+	delete(c.cache, uuid)
+	c.cacheM.Unlock()
+}
+
+// cached returns cached details of the item, if any
+func (c *Client) cached(uuid string) (cachedItem, bool) {
+	c.cacheM.Lock()
+	defer c.cacheM.Unlock()
+	e, ok := c.cache[uuid]
+	return e, ok
+}
+
+// store caches item details if the response has validators, dropping stale ones otherwise
+func (c *Client) store(uuid string, item *Item, h http.Header) {
+	c.cacheM.Lock()
+	defer c.cacheM.Unlock()
+	if c.cache == nil {
+		return
+	}
+	e := cachedItem{item: *item, etag: h.Get("ETag"), lastModified: h.Get("Last-Modified")}
+	if e.etag == "" && e.lastModified == "" {
+		delete(c.cache, uuid)
+		return
+	}
+	c.cache[uuid] = e
+}
+
+// revalidated updates validators of cached item details with those sent along with 304 response
+func (c *Client) revalidated(uuid string, h http.Header) {
+	c.cacheM.Lock()
+	defer c.cacheM.Unlock()
+	e, ok := c.cache[uuid]
+	if !ok {
+		return
+	}
+	if etag := h.Get("ETag"); etag != "" {
+		e.etag = etag
+	}
+	if lastModified := h.Get("Last-Modified"); lastModified != "" {
+		e.lastModified = lastModified
+	}
+	c.cache[uuid] = e
+}
+
+// GetItem performs a GET API call to `/item/{uuid}`.
+// With cache enabled, the request is conditional and 304 response returns cached details.
+// Other statuses return *StatusError, non-JSON responses return *ContentTypeError,
+// and responses lacking any of item fields return *MissingFieldError.
 func (c *Client) GetItem(uuid string) (*Item, error) {
-	resp, err := c.httpClient.Get(c.baseURL + getItemPath + uuid)
+	return c.GetItemContext(context.Background(), uuid)
+}
+
+// GetItemContext is GetItem making the request with `ctx`, e.g. to cancel it or carry trace span
+func (c *Client) GetItemContext(ctx context.Context, uuid string) (*Item, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+getItemPath+uuid, nil)
+	if err != nil {
+		return nil, err
+	}
+	cached, isCached := c.cached(uuid)
+	if isCached {
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -43,39 +193,137 @@ func (c *Client) GetItem(uuid string) (*Item, error) {
 	}()
 	switch resp.StatusCode {
 	case http.StatusOK: // 200
-		if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
-			return nil, ErrInvalidContentType{contentType: ct}
+		if ct := resp.Header.Get("Content-Type"); !isJSON(ct) {
+			return nil, &ContentTypeError{
+				Method:      req.Method,
+				URL:         req.URL.String(),
+				UUID:        uuid,
+				ContentType: ct,
+				RequestID:   resp.Header.Get("X-Request-Id"),
+			}
 		}
-		var item Item
-		decoder := json.NewDecoder(resp.Body)
-		decoder.DisallowUnknownFields()
-		if err = decoder.Decode(&item); err != nil {
+		item, field, err := c.decodeItem(resp.Body)
+		if err != nil {
 			return nil, err
 		}
-		return &item, nil
-	case http.StatusBadRequest: // 400
-		return nil, ErrBadRequest
-	case http.StatusInternalServerError: // 500
-		return nil, ErrServerError
+		if field != "" {
+			return nil, &MissingFieldError{
+				Method:    req.Method,
+				URL:       req.URL.String(),
+				UUID:      uuid,
+				Field:     field,
+				RequestID: resp.Header.Get("X-Request-Id"),
+			}
+		}
+		c.store(uuid, item, resp.Header)
+		return item, nil
+	case http.StatusNotModified: // 304
+		if isCached {
+			c.revalidated(uuid, resp.Header)
+			item := cached.item
+			return &item, nil
+		}
 	}
-	// Any other code is error
-	return nil, ErrUnexpectedStatusCode{code: resp.StatusCode}
+	return nil, newStatusError(resp, uuid)
 }
 
-// PostAlert performs a POST API call to `/low-stock-alert/{uuid}`
-func (c *Client) PostAlert(uuid string) error {
-	resp, err := c.httpClient.Post(c.baseURL+postAlertPath+uuid, "", nil)
+// isJSON tells whether `contentType` media type is JSON, e.g. `application/json; charset=utf-8`
+// or `application/problem+json`, with UTF-8 or no charset
+func isJSON(contentType string) bool {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if mediaType != "application/json" && !(strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json")) {
+		return false
+	}
+	charset, ok := params["charset"]
+	return !ok || strings.EqualFold(charset, "utf-8")
+}
+
+// decodeItem decodes item response, rejecting unknown fields in strict mode.
+// Returns the first required field that is absent or null, if any.
+func (c *Client) decodeItem(r io.Reader) (*Item, string, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, "", err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, "", err
+	}
+	if c.strict {
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if !isItemField(name) {
+				return nil, "", fmt.Errorf("json: unknown field %q", name)
+			}
+		}
+	}
+	var item Item
+	if err := json.Unmarshal(raw, &item); err != nil {
+		return nil, "", err
+	}
+	for _, f := range itemFields {
+		if v, ok := fields[f]; !ok || string(v) == "null" {
+			return nil, f, nil
+		}
+	}
+	return &item, "", nil
+}
+
+// isItemField tells whether `name` is a known field of item response
+func isItemField(name string) bool {
+	for _, f := range itemFields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// PostAlert performs a POST API call to `/low-stock-alert/{uuid}`,
+// `alert` is sent as JSON body along with Idempotency-Key header if not nil.
+// Statuses other than 201 return *StatusError.
+func (c *Client) PostAlert(uuid string, alert *Alert) error {
+	return c.PostAlertContext(context.Background(), uuid, alert)
+}
+
+// PostAlertContext is PostAlert making the request with `ctx`
+func (c *Client) PostAlertContext(ctx context.Context, uuid string, alert *Alert) error {
+	var (
+		body        io.Reader
+		contentType string
+	)
+	if alert != nil {
+		b, err := json.Marshal(alert)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+		contentType = "application/json"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+postAlertPath+uuid, body)
 	if err != nil {
 		return err
 	}
-	_ = resp.Body.Close()
-	switch resp.StatusCode {
-	case http.StatusCreated: // 201
+	req.Header.Set("Content-Type", contentType)
+	if alert != nil {
+		req.Header.Set("Idempotency-Key", alert.IdempotencyKey(uuid))
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode == http.StatusCreated { // 201
 		return nil
-	case http.StatusBadRequest: // 400
-		return ErrBadRequest
-	case http.StatusInternalServerError: // 500
-		return ErrServerError
 	}
-	return ErrUnexpectedStatusCode{resp.StatusCode}
+	return newStatusError(resp, uuid)
 }
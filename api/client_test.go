@@ -1,13 +1,18 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -20,15 +25,15 @@ func TestClient(t *testing.T) {
 		if item, err := c.GetItem(uuid); r.err == nil && assert.NoError(t, err) {
 			assert.Equal(t, r.item, item)
 		} else {
-			assert.IsType(t, r.err, err)
+			assertError(t, r.err, err)
 		}
 	}
 	// Test POST requests
 	for uuid, r := range postRequests {
-		if err := c.PostAlert(uuid); r.err == nil {
+		if err := c.PostAlert(uuid, nil); r.err == nil {
 			assert.NoError(t, err)
 		} else {
-			assert.Equal(t, err, r.err)
+			assertError(t, r.err, err)
 		}
 	}
 	// Stop the server and test unreachable API
@@ -36,17 +41,257 @@ func TestClient(t *testing.T) {
 	if _, err := c.GetItem("00000000-0000-0000-0000-000000000200"); assert.Error(t, err) {
 		assert.IsType(t, &url.Error{}, err)
 	}
-	if err := c.PostAlert("00000000-0000-0000-0000-000000000200"); assert.Error(t, err) {
+	if err := c.PostAlert("00000000-0000-0000-0000-000000000200", nil); assert.Error(t, err) {
 		assert.IsType(t, &url.Error{}, err)
 	}
 }
 
+func TestStrictDecoding(t *testing.T) {
+	s := startMockServer()
+	defer s.stop()
+	c := New(s.addr).WithStrictDecoding(true)
+	_, err := c.GetItem("30000000-0000-0000-0000-000000000200")
+	assert.EqualError(t, err, `json: unknown field "id"`)
+	if item, err := c.GetItem("00000000-0000-0000-0000-000000000200"); assert.NoError(t, err) {
+		assert.Equal(t, getRequests["00000000-0000-0000-0000-000000000200"].item, item)
+	}
+	_, err = c.GetItem("70000000-0000-0000-0000-000000000200")
+	var missing *MissingFieldError
+	if assert.True(t, errors.As(err, &missing)) {
+		assert.Equal(t, "quantity", missing.Field)
+		assert.Equal(t, "70000000-0000-0000-0000-000000000200", missing.UUID)
+	}
+}
+
+func TestIsJSON(t *testing.T) {
+	for ct, ok := range map[string]bool{
+		"application/json":                   true,
+		"application/json; charset=utf-8":    true,
+		"APPLICATION/JSON;CHARSET=\"UTF-8\"": true,
+		"application/problem+json":           true,
+		"application/json; charset=latin1":   false,
+		"text/json":                          false,
+		"application/jsonp":                  false,
+		"":                                   false,
+		"application/json;;":                 false,
+	} {
+		assert.Equal(t, ok, isJSON(ct), ct)
+	}
+}
+
+func TestContext(t *testing.T) {
+	s := startMockServer()
+	defer s.stop()
+	c := New(s.addr)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := c.GetItemContext(ctx, "00000000-0000-0000-0000-000000000200")
+	assert.True(t, errors.Is(err, context.Canceled))
+	err = c.PostAlertContext(ctx, "00000000-0000-0000-0000-000000000201", nil)
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestTimeout(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer s.Close()
+	c := New(s.URL).WithTimeout(20 * time.Millisecond)
+	start := time.Now()
+	_, err := c.GetItem("00000000-0000-0000-0000-000000000200")
+	assert.Less(t, int64(time.Since(start)), int64(150*time.Millisecond))
+	var timeout interface{ Timeout() bool }
+	if assert.True(t, errors.As(err, &timeout)) {
+		assert.True(t, timeout.Timeout())
+	}
+	// Timeout is kept when transport is replaced
+	c.WithTransport(http.DefaultTransport)
+	err = c.PostAlert("00000000-0000-0000-0000-000000000200", nil)
+	if assert.True(t, errors.As(err, &timeout)) {
+		assert.True(t, timeout.Timeout())
+	}
+}
+
+// assertError checks that `err` matches sentinel `expected` or has its type
+func assertError(t *testing.T, expected, err error) {
+	if !errors.Is(err, expected) {
+		assert.IsType(t, expected, err)
+	}
+}
+
+func TestStatusErrorDetails(t *testing.T) {
+	s := startMockServer()
+	defer s.stop()
+	c := New(s.addr)
+	uuid := "00000000-0000-0000-0000-000000000404"
+	_, err := c.GetItem(uuid)
+	var status *StatusError
+	if assert.True(t, errors.As(err, &status)) {
+		assert.Equal(t, &StatusError{
+			Method:     http.MethodGet,
+			URL:        strings.TrimSuffix(s.addr, "/") + getItemPath + uuid,
+			UUID:       uuid,
+			StatusCode: 404,
+			Body:       `{"error":"no such item"}`,
+			RequestID:  "req-1",
+		}, status)
+	}
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.False(t, errors.Is(err, ErrBadRequest))
+	assert.False(t, Retryable(err))
+	err = c.PostAlert("00000000-0000-0000-0000-000000000500", nil)
+	if assert.True(t, errors.As(err, &status)) {
+		assert.Equal(t, http.MethodPost, status.Method)
+		assert.Equal(t, 500, status.StatusCode)
+	}
+	assert.True(t, Retryable(err))
+	_, err = c.GetItem("20000000-0000-0000-0000-000000000200")
+	var contentType *ContentTypeError
+	if assert.True(t, errors.As(err, &contentType)) {
+		assert.Equal(t, "text/html", contentType.ContentType)
+		assert.Equal(t, "20000000-0000-0000-0000-000000000200", contentType.UUID)
+	}
+	assert.False(t, Retryable(err))
+}
+
+func TestPostAlertPayload(t *testing.T) {
+	s := startMockServer()
+	defer s.stop()
+	c := New(s.addr)
+	uuid := "00000000-0000-0000-0000-000000000201"
+	t.Run("empty", func(t *testing.T) {
+		if assert.NoError(t, c.PostAlert(uuid, nil)) {
+			assert.Empty(t, s.lastBody)
+			assert.Empty(t, s.lastHeader.Get("Content-Type"))
+			assert.Empty(t, s.lastHeader.Get("Idempotency-Key"))
+		}
+	})
+	t.Run("payload", func(t *testing.T) {
+		alert := &Alert{
+			Quantity:   3,
+			Threshold:  5,
+			Name:       "item name",
+			ObservedAt: time.Date(2021, 2, 9, 10, 0, 0, 0, time.UTC),
+			InstanceID: "worker-1",
+		}
+		if assert.NoError(t, c.PostAlert(uuid, alert)) {
+			assert.JSONEq(t, `{"quantity":3,"threshold":5,"name":"item name","observed_at":"2021-02-09T10:00:00Z","instance_id":"worker-1"}`, string(s.lastBody))
+			assert.Equal(t, "application/json", s.lastHeader.Get("Content-Type"))
+			assert.Equal(t, alert.IdempotencyKey(uuid), s.lastHeader.Get("Idempotency-Key"))
+		}
+	})
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	uuid := "00000000-0000-0000-0000-000000000201"
+	a := Alert{ObservedAt: time.Unix(1612864800, 0), InstanceID: "worker-1"}
+	key := a.IdempotencyKey(uuid)
+	assert.Len(t, key, 32)
+	assert.Equal(t, key, a.IdempotencyKey(uuid), "same alert should produce the same key")
+	b := a
+	b.ObservedAt = b.ObservedAt.Add(time.Second)
+	assert.NotEqual(t, key, b.IdempotencyKey(uuid))
+	assert.NotEqual(t, key, a.IdempotencyKey("00000000-0000-0000-0000-000000000202"))
+}
+
+func TestClientCache(t *testing.T) {
+	s := startMockServer()
+	defer s.stop()
+	t.Run("etag", func(t *testing.T) {
+		c := New(s.addr).WithCache()
+		uuid := "00000000-0000-0000-0000-000000000304"
+		for i := 0; i < 2; i++ {
+			if item, err := c.GetItem(uuid); assert.NoError(t, err) {
+				assert.Equal(t, getRequests[uuid].item, item)
+			}
+		}
+		assert.Equal(t, `"v1"`, s.lastGetHeader.Get("If-None-Match"))
+		assert.Equal(t, http.StatusNotModified, s.lastGetCode)
+		// Returned items do not share cached details
+		item, _ := c.GetItem(uuid)
+		item.Quantity = 0
+		if item, err := c.GetItem(uuid); assert.NoError(t, err) {
+			assert.Equal(t, 10, item.Quantity)
+		}
+		c.Forget(uuid)
+		_, _ = c.GetItem(uuid)
+		assert.Empty(t, s.lastGetHeader.Get("If-None-Match"))
+		assert.Equal(t, http.StatusOK, s.lastGetCode)
+	})
+	t.Run("last modified", func(t *testing.T) {
+		c := New(s.addr).WithCache()
+		uuid := "10000000-0000-0000-0000-000000000304"
+		for i := 0; i < 2; i++ {
+			if item, err := c.GetItem(uuid); assert.NoError(t, err) {
+				assert.Equal(t, getRequests[uuid].item, item)
+			}
+		}
+		assert.Empty(t, s.lastGetHeader.Get("If-None-Match"))
+		assert.Equal(t, "Tue, 09 Feb 2021 10:00:00 GMT", s.lastGetHeader.Get("If-Modified-Since"))
+		assert.Equal(t, http.StatusNotModified, s.lastGetCode)
+	})
+	t.Run("no validators", func(t *testing.T) {
+		c := New(s.addr).WithCache()
+		uuid := "00000000-0000-0000-0000-000000000200"
+		for i := 0; i < 2; i++ {
+			_, err := c.GetItem(uuid)
+			assert.NoError(t, err)
+			assert.Empty(t, s.lastGetHeader.Get("If-None-Match"))
+			assert.Empty(t, s.lastGetHeader.Get("If-Modified-Since"))
+		}
+	})
+	t.Run("disabled", func(t *testing.T) {
+		c := New(s.addr)
+		uuid := "00000000-0000-0000-0000-000000000304"
+		for i := 0; i < 2; i++ {
+			_, err := c.GetItem(uuid)
+			assert.NoError(t, err)
+			assert.Empty(t, s.lastGetHeader.Get("If-None-Match"))
+		}
+	})
+	t.Run("validators refreshed", func(t *testing.T) {
+		var etags []string
+		rs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			etags = append(etags, r.Header.Get("If-None-Match"))
+			w.Header().Set("ETag", fmt.Sprintf(`"v%d"`, len(etags)))
+			if len(etags) > 1 {
+				w.Header().Set("Last-Modified", "Tue, 09 Feb 2021 10:00:00 GMT")
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"uuid":"00000000-0000-0000-0000-000000000304","name":"item","quantity":10}`))
+		}))
+		defer rs.Close()
+		c := New(rs.URL).WithCache()
+		for i := 0; i < 3; i++ {
+			if item, err := c.GetItem("00000000-0000-0000-0000-000000000304"); assert.NoError(t, err) {
+				assert.Equal(t, 10, item.Quantity)
+			}
+		}
+		assert.Equal(t, []string{"", `"v1"`, `"v2"`}, etags)
+		cached, _ := c.cached("00000000-0000-0000-0000-000000000304")
+		assert.Equal(t, "Tue, 09 Feb 2021 10:00:00 GMT", cached.lastModified)
+	})
+	t.Run("not modified without cache", func(t *testing.T) {
+		c := New(s.addr).WithCache()
+		_, err := c.GetItem("20000000-0000-0000-0000-000000000304")
+		var status *StatusError
+		if assert.True(t, errors.As(err, &status)) {
+			assert.Equal(t, http.StatusNotModified, status.StatusCode)
+		}
+	})
+}
+
 type mockResponse struct {
-	code        int    // expected status code
-	contentType string // expected content type
-	body        []byte // expected body
-	err         error  // expected error
-	item        *Item  // expected item
+	code         int    // expected status code
+	contentType  string // expected content type
+	body         []byte // expected body
+	err          error  // expected error
+	item         *Item  // expected item
+	etag         string // ETag header, 304 is returned if request has matching If-None-Match
+	lastModified string // Last-Modified header, 304 is returned if request has matching If-Modified-Since
+	requestID    string // X-Request-Id header
 }
 
 var (
@@ -74,14 +319,70 @@ var (
 			code:        200,
 			contentType: "text/html",
 			body:        []byte(`{}`),
-			err:         ErrInvalidContentType{contentType: "text/html"},
+			err:         ErrWrongContentType,
 		},
-		// Unexpected response field
+		// Unexpected response field, ignored unless decoding is strict
 		"30000000-0000-0000-0000-000000000200": {
 			code:        200,
 			contentType: "application/json",
-			body:        []byte(`{"id":"unknown", "uuid":"00000000-0000-0000-0000-000000000200", "name": "item name", "quantity": 10}`),
-			err:         errors.New(`json: unknown field "id"`),
+			body:        []byte(`{"id":"unknown", "uuid":"30000000-0000-0000-0000-000000000200", "name": "item name", "quantity": 10}`),
+			item: &Item{
+				UUID:     "30000000-0000-0000-0000-000000000200",
+				Name:     "item name",
+				Quantity: 10,
+			},
+		},
+		// Content-Type with charset
+		"40000000-0000-0000-0000-000000000200": {
+			code:        200,
+			contentType: "Application/JSON; charset=UTF-8",
+			body:        []byte(`{"uuid":"40000000-0000-0000-0000-000000000200", "name": "item name", "quantity": 0}`),
+			item: &Item{
+				UUID: "40000000-0000-0000-0000-000000000200",
+				Name: "item name",
+			},
+		},
+		// Content-Type with other charset
+		"50000000-0000-0000-0000-000000000200": {
+			code:        200,
+			contentType: "application/json; charset=iso-8859-1",
+			body:        []byte(`{}`),
+			err:         ErrWrongContentType,
+		},
+		// Malformed Content-Type
+		"60000000-0000-0000-0000-000000000200": {
+			code:        200,
+			contentType: "application/json; charset",
+			body:        []byte(`{}`),
+			err:         ErrWrongContentType,
+		},
+		// Missing field
+		"70000000-0000-0000-0000-000000000200": {
+			code:        200,
+			contentType: "application/json",
+			body:        []byte(`{"uuid":"70000000-0000-0000-0000-000000000200", "name": "item name"}`),
+			err:         ErrMissingField,
+		},
+		// Null field
+		"80000000-0000-0000-0000-000000000200": {
+			code:        200,
+			contentType: "application/json",
+			body:        []byte(`{"uuid":"80000000-0000-0000-0000-000000000200", "name": null, "quantity": 1}`),
+			err:         ErrMissingField,
+		},
+		// Not an object
+		"90000000-0000-0000-0000-000000000200": {
+			code:        200,
+			contentType: "application/json",
+			body:        []byte(`[]`),
+			err:         &json.UnmarshalTypeError{},
+		},
+		// Wrong field type
+		"a0000000-0000-0000-0000-000000000200": {
+			code:        200,
+			contentType: "application/json",
+			body:        []byte(`{"uuid":"a0000000-0000-0000-0000-000000000200", "name": "item name", "quantity": "10"}`),
+			err:         &json.UnmarshalTypeError{},
 		},
 		// Error 400
 		"00000000-0000-0000-0000-000000000400": {
@@ -95,10 +396,46 @@ var (
 			err:  ErrServerError,
 			body: nil,
 		},
+		// Error 404
+		"00000000-0000-0000-0000-000000000404": {
+			code:      404,
+			err:       ErrNotFound,
+			body:      []byte(`{"error":"no such item"}`),
+			requestID: "req-1",
+		},
 		// Unexpected error
 		"00000000-0000-0000-0000-000000000999": {
 			code: 999,
-			err:  ErrUnexpectedStatusCode{code: 999},
+			err:  &StatusError{},
+		},
+		// OK with ETag
+		"00000000-0000-0000-0000-000000000304": {
+			code:        200,
+			contentType: "application/json",
+			body:        []byte(`{"uuid":"00000000-0000-0000-0000-000000000304", "name": "item name", "quantity": 10}`),
+			etag:        `"v1"`,
+			item: &Item{
+				UUID:     "00000000-0000-0000-0000-000000000304",
+				Name:     "item name",
+				Quantity: 10,
+			},
+		},
+		// OK with Last-Modified
+		"10000000-0000-0000-0000-000000000304": {
+			code:         200,
+			contentType:  "application/json",
+			body:         []byte(`{"uuid":"10000000-0000-0000-0000-000000000304", "name": "item name", "quantity": 10}`),
+			lastModified: "Tue, 09 Feb 2021 10:00:00 GMT",
+			item: &Item{
+				UUID:     "10000000-0000-0000-0000-000000000304",
+				Name:     "item name",
+				Quantity: 10,
+			},
+		},
+		// Not modified for an unconditional request
+		"20000000-0000-0000-0000-000000000304": {
+			code: 304,
+			err:  &StatusError{},
 		},
 	}
 	postRequests = map[string]mockResponse{
@@ -119,14 +456,18 @@ var (
 		// Unexpected response
 		"00000000-0000-0000-0000-000000000999": {
 			code: 999,
-			err:  ErrUnexpectedStatusCode{code: 999},
+			err:  &StatusError{},
 		},
 	}
 )
 
 type mockAPIServer struct {
-	server *http.Server
-	addr   string
+	server        *http.Server
+	addr          string
+	lastBody      []byte      // body of the last POST request
+	lastHeader    http.Header // headers of the last POST request
+	lastGetHeader http.Header // headers of the last GET request
+	lastGetCode   int         // status code of the last GET response
 }
 
 func startMockServer() *mockAPIServer {
@@ -148,6 +489,24 @@ func (m *mockAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "GET":
 		if resp, ok := getRequests[strings.TrimPrefix(r.URL.Path, getItemPath)]; ok {
+			m.lastGetHeader = r.Header
+			if resp.etag != "" {
+				w.Header().Set("ETag", resp.etag)
+			}
+			if resp.lastModified != "" {
+				w.Header().Set("Last-Modified", resp.lastModified)
+			}
+			// As in RFC 7232, If-Modified-Since is ignored when If-None-Match is present
+			if inm := r.Header.Get("If-None-Match"); (inm != "" && inm == resp.etag) ||
+				(inm == "" && resp.lastModified != "" && r.Header.Get("If-Modified-Since") == resp.lastModified) {
+				m.lastGetCode = http.StatusNotModified
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			m.lastGetCode = resp.code
+			if resp.requestID != "" {
+				w.Header().Set("X-Request-Id", resp.requestID)
+			}
 			w.Header().Add("Content-Type", resp.contentType)
 			w.WriteHeader(resp.code)
 			if _, err := w.Write(resp.body); err != nil {
@@ -158,6 +517,8 @@ func (m *mockAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		panic("unexpected GET request " + r.URL.Path)
 	case "POST":
 		if resp, ok := postRequests[strings.TrimPrefix(r.URL.Path, postAlertPath)]; ok {
+			m.lastBody, _ = ioutil.ReadAll(r.Body)
+			m.lastHeader = r.Header
 			w.WriteHeader(resp.code)
 			return
 		}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+)
+
+// DumpTransport writes full HTTP exchanges to `Out`, for debugging
+type DumpTransport struct {
+	Out  io.Writer
+	Next http.RoundTripper // Transport making requests, http.DefaultTransport if nil
+	m    sync.Mutex        // Keeps concurrent exchanges apart
+}
+
+func (t *DumpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	t.m.Lock()
+	defer t.m.Unlock()
+	b, err := httputil.DumpRequestOut(req, true)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = t.Out.Write(append(b, '\n')); err != nil {
+		return nil, err
+	}
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if b, err = httputil.DumpResponse(resp, true); err != nil {
+		_ = resp.Body.Close()
+		return nil, err
+	}
+	if _, err = t.Out.Write(append(b, '\n', '\n')); err != nil {
+		_ = resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDumpTransport(t *testing.T) {
+	s := startMockServer()
+	defer s.stop()
+	var out bytes.Buffer
+	c := New(s.addr).WithTransport(&DumpTransport{Out: &out})
+	if item, err := c.GetItem("00000000-0000-0000-0000-000000000200"); assert.NoError(t, err) {
+		assert.Equal(t, "00000000-0000-0000-0000-000000000200", item.UUID)
+	}
+	dump := out.String()
+	assert.Contains(t, dump, "GET /item/00000000-0000-0000-0000-000000000200 HTTP/1.1\r\n")
+	assert.Contains(t, dump, "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, dump, "Content-Type: application/json\r\n")
+	assert.Contains(t, dump, `"uuid":"00000000-0000-0000-0000-000000000200"`)
+	s.stop()
+	_, err := c.GetItem("00000000-0000-0000-0000-000000000200")
+	assert.Error(t, err)
+}
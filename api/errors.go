@@ -1,16 +1,33 @@
 package api
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 )
 
+// Errors matched by `errors.Is` against errors returned by Client
 var (
-	ErrBadRequest  = errors.New("bad request")
-	ErrServerError = errors.New("internal server error")
+	ErrBadRequest       = errors.New("bad request")           // Status 400
+	ErrNotFound         = errors.New("not found")             // Status 404
+	ErrTooManyRequests  = errors.New("too many requests")     // Status 429
+	ErrServerError      = errors.New("internal server error") // Any 5xx status
+	ErrWrongContentType = errors.New("invalid content type")
+	ErrMissingField     = errors.New("missing field")
 )
 
-// ErrUnexpectedStatusCode implements `error` with custom http status code
+// ErrUnexpectedStatusCode is the former error type for responses with unexpected status code.
+// It is set by `errors.As` from StatusError.
+//
+// Deprecated: use StatusError, Client no longer returns this type.
 type ErrUnexpectedStatusCode struct {
 	code int
 }
@@ -19,7 +36,10 @@ func (e ErrUnexpectedStatusCode) Error() string {
 	return "unexpected status code " + strconv.Itoa(e.code)
 }
 
-// ErrInvalidContentType implements `error` with custom http status code
+// ErrInvalidContentType is the former error type for responses that are not JSON.
+// It is set by `errors.As` from ContentTypeError.
+//
+// Deprecated: use ContentTypeError or ErrWrongContentType, Client no longer returns this type.
 type ErrInvalidContentType struct {
 	contentType string
 }
@@ -27,3 +47,151 @@ type ErrInvalidContentType struct {
 func (e ErrInvalidContentType) Error() string {
 	return "invalid content type '" + e.contentType + "'"
 }
+
+// maxBodySnippet limits how much of error response body is kept
+const maxBodySnippet = 512
+
+// StatusError is returned for responses with unexpected status code
+type StatusError struct {
+	Method     string
+	URL        string
+	UUID       string // Item the request was about
+	StatusCode int
+	Body       string // Beginning of response body
+	RequestID  string // X-Request-Id response header, if any
+}
+
+// newStatusError reads error details from `resp`
+func newStatusError(resp *http.Response, uuid string) *StatusError {
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxBodySnippet))
+	return &StatusError{
+		Method:     resp.Request.Method,
+		URL:        resp.Request.URL.String(),
+		UUID:       uuid,
+		StatusCode: resp.StatusCode,
+		Body:       strings.TrimSpace(string(b)),
+		RequestID:  resp.Header.Get("X-Request-Id"),
+	}
+}
+
+func (e *StatusError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s: unexpected status code %d", e.Method, e.URL, e.StatusCode)
+	if e.RequestID != "" {
+		fmt.Fprintf(&b, " (request ID %s)", e.RequestID)
+	}
+	if e.Body != "" {
+		fmt.Fprintf(&b, ": %q", e.Body)
+	}
+	return b.String()
+}
+
+// Is matches the error against status sentinel errors, e.g. `errors.Is(err, api.ErrNotFound)`
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrTooManyRequests:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrServerError:
+		return e.StatusCode >= http.StatusInternalServerError
+	}
+	return false
+}
+
+// As sets deprecated ErrUnexpectedStatusCode target, so callers matching it keep working
+func (e *StatusError) As(target interface{}) bool {
+	if t, ok := target.(*ErrUnexpectedStatusCode); ok {
+		*t = ErrUnexpectedStatusCode{code: e.StatusCode}
+		return true
+	}
+	return false
+}
+
+// Temporary tells whether the status indicates API overload or outage, so the request may succeed later
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests ||
+		e.StatusCode >= http.StatusInternalServerError
+}
+
+// ContentTypeError is returned for successful responses that are not JSON
+type ContentTypeError struct {
+	Method      string
+	URL         string
+	UUID        string
+	ContentType string
+	RequestID   string
+}
+
+func (e *ContentTypeError) Error() string {
+	return e.Method + " " + e.URL + ": invalid content type '" + e.ContentType + "'"
+}
+
+// Is makes the error match ErrWrongContentType
+func (e *ContentTypeError) Is(target error) bool { return target == ErrWrongContentType }
+
+// As sets deprecated ErrInvalidContentType target, so callers matching it keep working
+func (e *ContentTypeError) As(target interface{}) bool {
+	if t, ok := target.(*ErrInvalidContentType); ok {
+		*t = ErrInvalidContentType{contentType: e.ContentType}
+		return true
+	}
+	return false
+}
+
+// MissingFieldError is returned for item responses lacking a required field, or having it null
+type MissingFieldError struct {
+	Method    string
+	URL       string
+	UUID      string
+	Field     string
+	RequestID string
+}
+
+func (e *MissingFieldError) Error() string {
+	return e.Method + " " + e.URL + ": missing field '" + e.Field + "'"
+}
+
+// Is makes the error match ErrMissingField
+func (e *MissingFieldError) Is(target error) bool { return target == ErrMissingField }
+
+// Retryable tells whether the request failed for a reason that may go away, like network failure,
+// API overload or outage, so it is worth repeating. Other errors, e.g. rejected requests, malformed
+// responses, TLS certificate verification failures or unsupported URL schemes, are permanent.
+func Retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.Temporary()
+	}
+	if errors.Is(err, ErrServerError) || errors.Is(err, ErrTooManyRequests) {
+		return true
+	}
+	if misconfigured(err) {
+		return false
+	}
+	var (
+		urlErr *url.Error
+		netErr net.Error
+	)
+	return errors.As(err, &urlErr) || errors.As(err, &netErr)
+}
+
+// misconfigured tells whether the request failed because of client or server setup, which repeating won't fix
+func misconfigured(err error) bool {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostname         x509.HostnameError
+		invalid          x509.CertificateInvalidError
+		record           tls.RecordHeaderError
+	)
+	if errors.As(err, &unknownAuthority) || errors.As(err, &hostname) || errors.As(err, &invalid) || errors.As(err, &record) {
+		return true
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) && urlErr.Err != nil && strings.HasPrefix(urlErr.Err.Error(), "unsupported protocol scheme")
+}
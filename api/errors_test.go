@@ -1,6 +1,14 @@
 package api
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -8,16 +16,84 @@ import (
 
 func TestErrors(t *testing.T) {
 	{
-		e := ErrUnexpectedStatusCode{code: 999}
+		e := &StatusError{Method: "GET", URL: "http://api/item/1", StatusCode: 999}
 		if assert.Error(t, e) {
-			assert.Equal(t, "unexpected status code 999", e.Error())
+			assert.Equal(t, "GET http://api/item/1: unexpected status code 999", e.Error())
 		}
+		assert.True(t, e.Temporary())
+		assert.True(t, (&StatusError{StatusCode: 429}).Temporary())
+		assert.False(t, (&StatusError{StatusCode: 404}).Temporary())
+		e.RequestID, e.Body = "req-1", "oops"
+		assert.Equal(t, `GET http://api/item/1: unexpected status code 999 (request ID req-1): "oops"`, e.Error())
 	}
 	{
-		e := ErrInvalidContentType{contentType: "text/html"}
+		e := &ContentTypeError{Method: "GET", URL: "http://api/item/1", ContentType: "text/html"}
 		if assert.Error(t, e) {
-			assert.Equal(t, "invalid content type 'text/html'", e.Error())
+			assert.Equal(t, "GET http://api/item/1: invalid content type 'text/html'", e.Error())
 		}
+		assert.True(t, errors.Is(e, ErrWrongContentType))
 	}
+}
+
+func TestStatusErrorIs(t *testing.T) {
+	testCases := []struct {
+		code   int
+		target error
+	}{
+		{code: 400, target: ErrBadRequest},
+		{code: 404, target: ErrNotFound},
+		{code: 429, target: ErrTooManyRequests},
+		{code: 500, target: ErrServerError},
+		{code: 503, target: ErrServerError},
+	}
+	sentinels := []error{ErrBadRequest, ErrNotFound, ErrTooManyRequests, ErrServerError, ErrWrongContentType}
+	for _, tc := range testCases {
+		err := fmt.Errorf("getting item: %w", &StatusError{StatusCode: tc.code})
+		for _, target := range sentinels {
+			assert.Equal(t, target == tc.target, errors.Is(err, target), "%d is %s", tc.code, target)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	assert.False(t, Retryable(nil))
+	assert.True(t, Retryable(&StatusError{StatusCode: 502}))
+	assert.True(t, Retryable(&StatusError{StatusCode: 408}))
+	assert.False(t, Retryable(&StatusError{StatusCode: 403}))
+	assert.True(t, Retryable(ErrServerError))
+	assert.False(t, Retryable(ErrBadRequest))
+	assert.False(t, Retryable(&ContentTypeError{}))
+	assert.False(t, Retryable(errors.New(`json: unknown field "id"`)))
+	assert.True(t, Retryable(&url.Error{Op: "Get", URL: "http://api", Err: &net.OpError{Op: "dial", Err: errors.New("refused")}}))
+	assert.False(t, Retryable(&url.Error{Op: "Get", URL: "https://api", Err: x509.UnknownAuthorityError{}}))
+	assert.False(t, Retryable(&url.Error{Op: "Get", URL: "https://api", Err: x509.HostnameError{Host: "api"}}))
+	assert.False(t, Retryable(&url.Error{Op: "Get", URL: "https://api", Err: x509.CertificateInvalidError{Reason: x509.Expired}}))
+	assert.False(t, Retryable(&url.Error{Op: "Get", URL: "https://api", Err: tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}}))
+	assert.False(t, Retryable(&url.Error{Op: "Get", URL: "ftp://api", Err: errors.New(`unsupported protocol scheme "ftp"`)}))
+}
 
+func TestRetryableTLS(t *testing.T) {
+	s := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer s.Close()
+	// Test server certificate is not trusted by the default client
+	_, err := New(s.URL).GetItem("00000000-0000-0000-0000-000000000200")
+	if assert.Error(t, err) {
+		assert.False(t, Retryable(err), err.Error())
+	}
+	_, err = New("ftp://api").GetItem("00000000-0000-0000-0000-000000000200")
+	if assert.Error(t, err) {
+		assert.False(t, Retryable(err), err.Error())
+	}
+}
+
+func TestDeprecatedErrors(t *testing.T) {
+	var status ErrUnexpectedStatusCode
+	if assert.True(t, errors.As(fmt.Errorf("getting item: %w", &StatusError{StatusCode: 403}), &status)) {
+		assert.Equal(t, "unexpected status code 403", status.Error())
+	}
+	var contentType ErrInvalidContentType
+	if assert.True(t, errors.As(&ContentTypeError{ContentType: "text/html"}, &contentType)) {
+		assert.Equal(t, "invalid content type 'text/html'", contentType.Error())
+	}
+	assert.False(t, errors.As(&ContentTypeError{}, &status))
 }
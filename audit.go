@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/dmitry-vovk/csv-chg-go/audit"
+	"github.com/dmitry-vovk/csv-chg-go/cli"
+	"github.com/dmitry-vovk/csv-chg-go/config"
+)
+
+// auditQueryCommand prints audit records matching the filter as JSON lines,
+// fails with findings exit code if none match
+func auditQueryCommand(cfg config.AuditQueryConfig, args []string) error {
+	if len(args) != 1 {
+		return cli.Usage(errors.New("one audit file should be specified"))
+	}
+	cfg.File = args[0]
+	if err := cfg.Validate(); err != nil {
+		return cli.Usage(err)
+	}
+	out := bufio.NewWriter(os.Stdout)
+	encoder := json.NewEncoder(out)
+	found := 0
+	err := audit.Query(cfg.File, audit.Filter{UUID: cfg.UUID, Since: cfg.Since, Until: cfg.Until}, func(r audit.Record) error {
+		found++
+		return encoder.Encode(r)
+	})
+	if flushErr := out.Flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		return fmt.Errorf("querying audit: %s", err)
+	}
+	if found == 0 {
+		return cli.ExitCode(cli.ExitFindings)
+	}
+	return nil
+}
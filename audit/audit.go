@@ -0,0 +1,163 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Decisions made for a checked item
+const (
+	DecisionNoAlert  = "no_alert" // Item raises no alert
+	DecisionAlert    = "alert"    // Alert is sent to the sink
+	DecisionDeferred = "deferred" // Alert is held back until quiet hours end
+	DecisionReleased = "released" // Deferred alert is sent to the sink
+	DecisionError    = "error"    // Item could not be checked
+)
+
+// Record is an alert decision made for an item
+type Record struct {
+	Time      time.Time `json:"time"`
+	Warehouse string    `json:"warehouse,omitempty"`
+	UUID      string    `json:"uuid"`
+	Quantity  *int      `json:"quantity,omitempty"` // Observed quantity, nil if the item could not be fetched
+	Threshold int       `json:"threshold"`
+	Rules     []string  `json:"rules,omitempty"` // Rules matched by the item
+	Reason    string    `json:"reason,omitempty"`
+	Severity  string    `json:"severity,omitempty"`
+	Decision  string    `json:"decision"`
+	Sink      string    `json:"sink,omitempty"` // Sink the alert was sent to
+	Error     string    `json:"error,omitempty"`
+}
+
+// SetError records `err` unless nil
+func (r *Record) SetError(err error) {
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// Log appends records to a JSON lines file, rotating it by size and age.
+// Rotated files are renamed with rotation time suffix and never removed.
+type Log struct {
+	file      *file
+	warehouse string // Warehouse set in records
+}
+
+// file is the log file shared by warehouse views of the log
+type file struct {
+	m       sync.Mutex
+	path    string
+	f       *os.File
+	size    int64         // Current file size
+	created time.Time     // Time of the first record in current file
+	maxSize int64         // File is rotated before exceeding that size, 0 for no limit
+	maxAge  time.Duration // File is rotated once its first record is that old, 0 for no limit
+	renamed bool          // Current file was renamed but a new one could not be opened yet
+}
+
+// rotatedFormat is the time layout of rotated file suffix, sorting in rotation order
+const rotatedFormat = "20060102T150405.000000000Z"
+
+// Open opens log at `path` for appending, the file is created if it does not exist.
+// Zero `maxSize` and `maxAge` disable rotation by size and age.
+func Open(path string, maxSize int64, maxAge time.Duration) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	lf := &file{
+		path:    path,
+		f:       f,
+		size:    info.Size(),
+		created: firstRecordTime(path, info.ModTime()),
+		maxSize: maxSize,
+		maxAge:  maxAge,
+	}
+	return &Log{file: lf}, nil
+}
+
+// firstRecordTime returns time of the first record in the file, `fallback` if there is none
+func firstRecordTime(path string, fallback time.Time) time.Time {
+	f, err := os.Open(path)
+	if err != nil {
+		return fallback
+	}
+	defer func() { _ = f.Close() }()
+	scanner := bufio.NewScanner(f)
+	var r Record
+	if !scanner.Scan() || json.Unmarshal(scanner.Bytes(), &r) != nil || r.Time.IsZero() {
+		return fallback
+	}
+	return r.Time
+}
+
+// WithWarehouse returns a view of the log setting `name` as warehouse of records
+func (l *Log) WithWarehouse(name string) *Log {
+	return &Log{file: l.file, warehouse: name}
+}
+
+// Record appends `r` to the log, current time is used if record time is not set
+func (l *Log) Record(r Record) error {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	r.Time = r.Time.UTC()
+	if r.Warehouse == "" {
+		r.Warehouse = l.warehouse
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return l.file.write(append(b, '\n'), r.Time)
+}
+
+// write appends the line, rotating the file first if it is full or outdated.
+// If rotation fails the line goes to the current file and rotation is retried on the next write.
+func (f *file) write(b []byte, now time.Time) error {
+	f.m.Lock()
+	defer f.m.Unlock()
+	if f.size > 0 && (f.maxSize > 0 && f.size+int64(len(b)) > f.maxSize || f.maxAge > 0 && now.Sub(f.created) >= f.maxAge) {
+		_ = f.rotate(now)
+	}
+	if f.size == 0 {
+		f.created = now
+	}
+	n, err := f.f.Write(b)
+	f.size += int64(n)
+	return err
+}
+
+// rotate renames current file with `now` suffix and starts a new one.
+// If the new file can't be opened, records keep going to the renamed one
+// and only opening is retried on the next rotation.
+func (f *file) rotate(now time.Time) error {
+	if !f.renamed {
+		if err := os.Rename(f.path, f.path+"."+now.UTC().Format(rotatedFormat)); err != nil {
+			return err
+		}
+		f.renamed = true
+	}
+	nf, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	_ = f.f.Close()
+	f.f, f.size, f.renamed = nf, 0, false
+	return nil
+}
+
+// Close closes the underlying file
+func (l *Log) Close() error {
+	l.file.m.Lock()
+	defer l.file.m.Unlock()
+	return l.file.f.Close()
+}
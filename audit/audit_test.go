@@ -0,0 +1,197 @@
+package audit
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tempDir() string {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		panic(err)
+	}
+	return dir
+}
+
+func TestLog(t *testing.T) {
+	dir := tempDir()
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "audit.jsonl")
+	l, err := Open(path, 0, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	at := time.Date(2021, 2, 9, 10, 0, 0, 0, time.FixedZone("CET", 3600))
+	quantity := 3
+	r := Record{
+		Time:      at,
+		UUID:      "767d967f-b55b-4457-bfee-685eaa6d0583",
+		Quantity:  &quantity,
+		Threshold: 5,
+		Reason:    "rule",
+		Rules:     []string{"low"},
+		Severity:  "warning",
+		Decision:  DecisionAlert,
+		Sink:      "webhook",
+	}
+	r.SetError(nil)
+	assert.NoError(t, l.Record(r))
+	r.SetError(errors.New("webhook responded with status code 500"))
+	assert.NoError(t, l.WithWarehouse("london").Record(r))
+	before := time.Now()
+	assert.NoError(t, l.Record(Record{UUID: "ee88ff32-f753-4a49-abf1-2885fdfcafba", Threshold: 5, Decision: DecisionError, Error: "timeout"}))
+	assert.NoError(t, l.Close())
+	b, _ := ioutil.ReadFile(path)
+	lines := strings.Split(string(b), "\n")
+	if assert.Len(t, lines, 4) {
+		assert.Equal(t, `{"time":"2021-02-09T09:00:00Z","uuid":"767d967f-b55b-4457-bfee-685eaa6d0583","quantity":3,"threshold":5,"rules":["low"],"reason":"rule","severity":"warning","decision":"alert","sink":"webhook"}`, lines[0])
+		assert.Equal(t, `{"time":"2021-02-09T09:00:00Z","warehouse":"london","uuid":"767d967f-b55b-4457-bfee-685eaa6d0583","quantity":3,"threshold":5,"rules":["low"],"reason":"rule","severity":"warning","decision":"alert","sink":"webhook","error":"webhook responded with status code 500"}`, lines[1])
+		assert.Contains(t, lines[2], `"uuid":"ee88ff32-f753-4a49-abf1-2885fdfcafba","threshold":5,"decision":"error","error":"timeout"}`)
+	}
+	var records []Record
+	assert.NoError(t, Query(path, Filter{Since: before}, func(r Record) error {
+		records = append(records, r)
+		return nil
+	}))
+	if assert.Len(t, records, 1) {
+		assert.Nil(t, records[0].Quantity)
+		assert.Equal(t, time.UTC, records[0].Time.Location())
+	}
+	// Directory can't be opened as a file
+	_, err = Open(dir, 0, 0)
+	assert.Error(t, err)
+}
+
+func TestRotation(t *testing.T) {
+	dir := tempDir()
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "audit.jsonl")
+	start := time.Date(2021, 2, 9, 10, 0, 0, 0, time.UTC)
+	record := func(l *Log, i int) {
+		assert.NoError(t, l.Record(Record{Time: start.Add(time.Duration(i) * time.Minute), UUID: "767d967f-b55b-4457-bfee-685eaa6d0583", Decision: DecisionNoAlert}))
+	}
+	// Each record is about 100 bytes, so two of them fit in a file
+	l, err := Open(path, 250, time.Hour)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for i := 0; i < 5; i++ {
+		record(l, i)
+	}
+	assert.NoError(t, l.Close())
+	files, err := Files(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{
+			path + ".20210209T100200.000000000Z",
+			path + ".20210209T100400.000000000Z",
+			path,
+		}, files)
+	}
+	// File age is restored from its first record on reopening
+	l, err = Open(path, 0, time.Hour)
+	if !assert.NoError(t, err) {
+		return
+	}
+	record(l, 63)
+	record(l, 64)
+	assert.NoError(t, l.Close())
+	files, _ = Files(path)
+	assert.Len(t, files, 4)
+	// Unrelated files are ignored
+	assert.NoError(t, ioutil.WriteFile(path+".bak", []byte("{}\n"), 0o644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "other.jsonl"), []byte("{}\n"), 0o644))
+	var minutes []int
+	assert.NoError(t, Query(path, Filter{}, func(r Record) error {
+		minutes = append(minutes, int(r.Time.Sub(start)/time.Minute))
+		return nil
+	}))
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 63, 64}, minutes)
+}
+
+func TestRotationFailure(t *testing.T) {
+	dir := tempDir()
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "audit.jsonl")
+	start := time.Date(2021, 2, 9, 10, 0, 0, 0, time.UTC)
+	record := func(l *Log, i int) {
+		assert.NoError(t, l.Record(Record{Time: start.Add(time.Duration(i) * time.Minute), UUID: "767d967f-b55b-4457-bfee-685eaa6d0583", Decision: DecisionNoAlert}))
+	}
+	minutes := func() (m []int) {
+		assert.NoError(t, Query(path, Filter{}, func(r Record) error {
+			m = append(m, int(r.Time.Sub(start)/time.Minute))
+			return nil
+		}))
+		return m
+	}
+	l, err := Open(path, 0, time.Minute)
+	if !assert.NoError(t, err) {
+		return
+	}
+	// Rotated file name is taken, so records stay in the current file until rotation succeeds
+	blocked := path + ".20210209T100100.000000000Z"
+	assert.NoError(t, os.Mkdir(blocked, 0o755))
+	record(l, 0)
+	record(l, 1)
+	files, _ := Files(path)
+	assert.Equal(t, []string{path}, files)
+	assert.NoError(t, os.Remove(blocked))
+	record(l, 2)
+	files, _ = Files(path)
+	assert.Len(t, files, 2)
+	// New file can't be opened after renaming, so records go to the renamed file until it can
+	assert.NoError(t, os.Rename(path, path+".20210209T100300.000000000Z"))
+	assert.NoError(t, os.Mkdir(path, 0o755))
+	l.file.renamed = true
+	record(l, 3)
+	assert.NoError(t, os.Remove(path))
+	record(l, 4)
+	assert.NoError(t, l.Close())
+	assert.False(t, l.file.renamed)
+	files, _ = Files(path)
+	assert.Len(t, files, 3)
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, minutes())
+}
+
+func TestQuery(t *testing.T) {
+	dir := tempDir()
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "audit.jsonl")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`{"time":"2021-02-09T10:00:00Z","uuid":"767d967f-b55b-4457-bfee-685eaa6d0583","decision":"no_alert"}
+not json
+{"time":"2021-02-09T11:00:00Z","uuid":"ee88ff32-f753-4a49-abf1-2885fdfcafba","decision":"alert"}
+{"time":"2021-02-09T12:00:00Z","uuid":"767d967f-b55b-4457-bfee-685eaa6d0583","decision":"alert"}
+`), 0o644))
+	query := func(f Filter) (decisions []string) {
+		assert.NoError(t, Query(path, f, func(r Record) error {
+			decisions = append(decisions, r.Time.Format("15")+" "+r.Decision)
+			return nil
+		}))
+		return decisions
+	}
+	assert.Equal(t, []string{"10 no_alert", "11 alert", "12 alert"}, query(Filter{}))
+	assert.Equal(t, []string{"10 no_alert", "12 alert"}, query(Filter{UUID: "767D967F-B55B-4457-BFEE-685EAA6D0583"}))
+	assert.Equal(t, []string{"11 alert"}, query(Filter{
+		Since: time.Date(2021, 2, 9, 11, 0, 0, 0, time.UTC),
+		Until: time.Date(2021, 2, 9, 12, 0, 0, 0, time.UTC),
+	}))
+	// Callback error stops the query
+	stop := errors.New("stop")
+	calls := 0
+	assert.Equal(t, stop, Query(path, Filter{}, func(Record) error {
+		calls++
+		return stop
+	}))
+	assert.Equal(t, 1, calls)
+	// Missing log has no records
+	assert.Empty(t, query(Filter{UUID: "none"}))
+	assert.NoError(t, os.Remove(path))
+	assert.Empty(t, query(Filter{}))
+	assert.Error(t, Query(filepath.Join(dir, "missing", "audit.jsonl"), Filter{}, func(Record) error { return nil }))
+}
@@ -0,0 +1,100 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Filter selects records, zero fields match any record
+type Filter struct {
+	UUID  string
+	Since time.Time // Records at or after that time
+	Until time.Time // Records before that time
+}
+
+// Match tells whether `r` is selected by the filter
+func (f Filter) Match(r Record) bool {
+	if f.UUID != "" && !strings.EqualFold(f.UUID, r.UUID) {
+		return false
+	}
+	if !f.Since.IsZero() && r.Time.Before(f.Since) {
+		return false
+	}
+	return f.Until.IsZero() || r.Time.Before(f.Until)
+}
+
+// Query calls `fn` for records of log at `path` matching `f`, oldest first,
+// reading rotated files before the current one and skipping malformed lines.
+// Iteration stops at the first error returned by `fn`.
+func Query(path string, f Filter, fn func(Record) error) error {
+	files, err := Files(path)
+	if err != nil {
+		return err
+	}
+	for _, name := range files {
+		if err = query(name, f, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Files returns rotated files of log at `path` in rotation order, followed by the current file if it exists
+func Files(path string) ([]string, error) {
+	entries, err := ioutil.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	var (
+		base  = filepath.Base(path)
+		files []string
+		found bool
+	)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() {
+			continue
+		}
+		if name == base {
+			found = true
+			continue
+		}
+		if !strings.HasPrefix(name, base+".") {
+			continue
+		}
+		if _, err := time.Parse(rotatedFormat, name[len(base)+1:]); err == nil {
+			files = append(files, filepath.Join(filepath.Dir(path), name))
+		}
+	}
+	sort.Strings(files)
+	if found {
+		files = append(files, path)
+	}
+	return files, nil
+}
+
+// query calls `fn` for matching records of a single file
+func query(path string, f Filter, fn func(Record) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var r Record
+		if json.Unmarshal(scanner.Bytes(), &r) != nil || !f.Match(r) {
+			continue
+		}
+		if err = fn(r); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
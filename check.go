@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dmitry-vovk/csv-chg-go/api"
+	"github.com/dmitry-vovk/csv-chg-go/cli"
+	"github.com/dmitry-vovk/csv-chg-go/config"
+	"github.com/dmitry-vovk/csv-chg-go/history"
+	"github.com/dmitry-vovk/csv-chg-go/ident"
+	"github.com/dmitry-vovk/csv-chg-go/rules"
+	"github.com/dmitry-vovk/csv-chg-go/worker"
+)
+
+// checkCommand fetches items by ID and prints them along with the decision the worker would make,
+// fails with findings exit code if any item would raise an alert
+func checkCommand(cfg config.CheckConfig, args []string) error {
+	cfg.IDs = args
+	if err := cfg.Validate(); err != nil {
+		return cli.Usage(err)
+	}
+	client := api.New(cfg.APIURL).WithTimeout(cfg.APITimeout).WithStrictDecoding(cfg.Strict)
+	if cfg.Verbose {
+		client.WithTransport(&api.DumpTransport{Out: os.Stderr})
+	}
+	format, _ := ident.New(cfg.IDFormat)
+	logger := log.New(log.Writer(), log.Prefix(), log.Flags())
+	w := worker.New(client).
+		WithThreshold(cfg.Threshold).
+		WithInstanceID(cfg.InstanceID).
+		WithIDFormat(format).
+		WithLogger(logger)
+	withSinks(w, cfg.Sinks, client, logger)
+	if cfg.RulesFile != "" {
+		set, err := rules.Load(cfg.RulesFile)
+		if err != nil {
+			return fmt.Errorf("loading rules: %s", err)
+		}
+		w.WithRules(set)
+	}
+	if cfg.History.File != "" {
+		h, err := history.Open(cfg.History.File, cfg.History.Window)
+		if err != nil {
+			return fmt.Errorf("opening history: %s", err)
+		}
+		defer func() { _ = h.Close() }()
+		w.WithHistory(h, cfg.History.Horizon)
+	}
+	failed, alerts := 0, 0
+	for _, id := range cfg.IDs {
+		key, _ := format.Parse(nil, []byte(id))
+		uuid := format.String(key)
+		fmt.Printf("%s:\n", uuid)
+		item, err := client.GetItem(uuid)
+		if err != nil {
+			fmt.Printf("  error:     %s\n", err)
+			failed++
+			continue
+		}
+		fmt.Printf("  name:      %q\n", item.Name)
+		fmt.Printf("  quantity:  %d\n", item.Quantity)
+		fmt.Printf("  threshold: %d\n", cfg.Threshold)
+		if item.UUID != uuid {
+			fmt.Printf("  error:     API returned item %q\n", item.UUID)
+			failed++
+			continue
+		}
+		alert := w.Evaluate(item)
+		if alert == nil {
+			fmt.Printf("  decision:  no alert\n")
+			continue
+		}
+		alerts++
+		fmt.Printf("  decision:  %s alert, reason %s", alert.Severity, alert.Reason)
+		if len(alert.Rules) > 0 {
+			fmt.Printf(", rules %s", strings.Join(alert.Rules, ", "))
+		}
+		if alert.PredictedStockoutAt != nil {
+			fmt.Printf(", stockout at %s", alert.PredictedStockoutAt.Format(time.RFC3339))
+		}
+		fmt.Println()
+		if cfg.Post {
+			if to, err := w.Send(uuid, alert); err != nil {
+				fmt.Printf("  posted:    %s error: %s\n", to, err)
+				failed++
+			} else {
+				fmt.Printf("  posted:    yes, to %s\n", to)
+			}
+		}
+	}
+	switch {
+	case failed > 0:
+		return fmt.Errorf("%d of %d items failed", failed, len(cfg.IDs))
+	case alerts > 0:
+		return cli.ExitCode(cli.ExitFindings)
+	}
+	return nil
+}
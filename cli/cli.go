@@ -0,0 +1,226 @@
+// Package cli dispatches command line arguments to subcommands
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Exit codes
+const (
+	ExitOK       = 0 // Command succeeded
+	ExitFindings = 1 // Command succeeded, but found problems, e.g. invalid input lines or differences
+	ExitUsage    = 2 // Invalid arguments or configuration
+	ExitError    = 3 // Command failed, e.g. input could not be read
+)
+
+// Command is a subcommand of the application
+type Command struct {
+	Name     string
+	Args     string                    // Positional arguments synopsis, e.g. `<input>`
+	Summary  string                    // One line description
+	Values   []string                  // Positional argument values offered by shell completion, files if empty
+	Flags    func(fs *flag.FlagSet)    // Registers command flags, nil if there are none
+	Run      func(args []string) error // Runs the command with positional arguments, nil for command groups
+	Commands []*Command                // Nested subcommands, e.g. `print` of `config`
+}
+
+// UsageError is returned by commands for invalid arguments, command help is printed along with it
+type UsageError struct {
+	err error
+}
+
+func (e UsageError) Error() string { return e.err.Error() }
+
+// Usage wraps `err` into UsageError
+func Usage(err error) error {
+	return UsageError{err: err}
+}
+
+// ExitCode is returned by commands to exit with the code without printing an error
+type ExitCode int
+
+func (c ExitCode) Error() string { return fmt.Sprintf("exit code %d", int(c)) }
+
+// App is a set of commands
+type App struct {
+	Name     string
+	Commands []*Command
+	Default  string    // Command to run when arguments start with a flag
+	Stdout   io.Writer // Help and completion output, os.Stdout if nil
+	Stderr   io.Writer // Errors output, os.Stderr if nil
+}
+
+// Run runs the command selected by `args`, not including program name, and returns exit code
+func (a *App) Run(args []string) int {
+	if a.Stdout == nil {
+		a.Stdout = os.Stdout
+	}
+	if a.Stderr == nil {
+		a.Stderr = os.Stderr
+	}
+	commands := append(a.Commands, a.builtins()...)
+	switch {
+	case len(args) == 0:
+		a.printCommands(a.Stderr, nil, commands)
+		return ExitUsage
+	case isHelp(args[0]) && len(args) > 1:
+		// `help <command>` is the same as `<command> -h`
+		args = append(args[1:], "-h")
+	case a.Default != "" && strings.HasPrefix(args[0], "-") && !isHelp(args[0]):
+		// Bare flags go to the default command, as they did before subcommands were introduced
+		args = append([]string{a.Default}, args...)
+	}
+	var path []string
+	for {
+		cmd := find(commands, args[0])
+		if cmd == nil {
+			if isHelp(args[0]) {
+				a.printCommands(a.Stdout, path, commands)
+				return ExitOK
+			}
+			_, _ = fmt.Fprintf(a.Stderr, "Error: unknown command %q\n", strings.Join(append(path, args[0]), " "))
+			a.printCommands(a.Stderr, path, commands)
+			return ExitUsage
+		}
+		path = append(path, cmd.Name)
+		args = args[1:]
+		if cmd.Run != nil {
+			return a.run(path, cmd, args)
+		}
+		if len(args) == 0 {
+			a.printCommands(a.Stderr, path, cmd.Commands)
+			return ExitUsage
+		}
+		commands = cmd.Commands
+	}
+}
+
+// run parses flags of `cmd` and runs it
+func (a *App) run(path []string, cmd *Command, args []string) int {
+	fs := a.flagSet(path, cmd)
+	// Requested help goes to stdout like `help` command output, usage printed for invalid flags goes to stderr
+	var usage bytes.Buffer
+	fs.SetOutput(&usage)
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		_, _ = usage.WriteTo(a.Stdout)
+		return ExitOK
+	} else if err != nil {
+		// Error is already printed by flag set along with usage
+		_, _ = usage.WriteTo(a.Stderr)
+		return ExitUsage
+	}
+	fs.SetOutput(a.Stderr)
+	positional := fs.Args()
+	if len(positional) == 0 && len(args) > 0 && args[len(args)-1] == "--" {
+		// Trailing `--` stands for stdin input
+		positional = []string{"--"}
+	}
+	err := cmd.Run(positional)
+	var usageErr UsageError
+	var code ExitCode
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.As(err, &code):
+		return int(code)
+	case errors.As(err, &usageErr):
+		_, _ = fmt.Fprintf(a.Stderr, "Error: %s\n", err)
+		fs.Usage()
+		return ExitUsage
+	}
+	_, _ = fmt.Fprintf(a.Stderr, "Error: %s\n", err)
+	return ExitError
+}
+
+// flagSet returns flag set of `cmd` with consistent help output
+func (a *App) flagSet(path []string, cmd *Command) *flag.FlagSet {
+	fs := flag.NewFlagSet(strings.Join(path, " "), flag.ContinueOnError)
+	fs.SetOutput(a.Stderr)
+	if cmd.Flags != nil {
+		cmd.Flags(fs)
+	}
+	fs.Usage = func() {
+		w := fs.Output()
+		synopsis := append([]string{a.Name}, path...)
+		if hasFlags(fs) {
+			synopsis = append(synopsis, "[flags]")
+		}
+		if cmd.Args != "" {
+			synopsis = append(synopsis, cmd.Args)
+		}
+		_, _ = fmt.Fprintf(w, "Usage: %s\n\n%s\n", strings.Join(synopsis, " "), cmd.Summary)
+		if hasFlags(fs) {
+			_, _ = fmt.Fprintf(w, "\nFlags:\n")
+			fs.PrintDefaults()
+		}
+	}
+	return fs
+}
+
+// printCommands prints the list of commands available after `path`
+func (a *App) printCommands(w io.Writer, path []string, commands []*Command) {
+	synopsis := strings.Join(append([]string{a.Name}, path...), " ")
+	_, _ = fmt.Fprintf(w, "Usage: %s <command> [flags] [arguments]\n\nCommands:\n", synopsis)
+	width := 0
+	for _, cmd := range commands {
+		if len(cmd.Name) > width {
+			width = len(cmd.Name)
+		}
+	}
+	for _, cmd := range commands {
+		_, _ = fmt.Fprintf(w, "  %-*s  %s\n", width, cmd.Name, cmd.Summary)
+	}
+	_, _ = fmt.Fprintf(w, "\nRun '%s <command> -h' for command help.\n", synopsis)
+}
+
+// builtins returns commands every application has
+func (a *App) builtins() []*Command {
+	return []*Command{{
+		Name:    "completion",
+		Args:    "bash|zsh|fish",
+		Summary: "Print shell completion script",
+		Values:  []string{"bash", "zsh", "fish"},
+		Run: func(args []string) error {
+			if len(args) != 1 {
+				return Usage(errors.New("shell should be specified"))
+			}
+			return a.completion(args[0])
+		},
+	}}
+}
+
+func find(commands []*Command, name string) *Command {
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func isHelp(arg string) bool {
+	return arg == "help" || arg == "-h" || arg == "-help" || arg == "--help"
+}
+
+func hasFlags(fs *flag.FlagSet) bool {
+	has := false
+	fs.VisitAll(func(*flag.Flag) { has = true })
+	return has
+}
+
+// flags returns flags of `cmd` in lexical order
+func flags(cmd *Command) []*flag.Flag {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	if cmd.Flags != nil {
+		cmd.Flags(fs)
+	}
+	var list []*flag.Flag
+	fs.VisitAll(func(f *flag.Flag) { list = append(list, f) })
+	return list
+}
@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testApp returns an application recording arguments of the last run command
+func testApp(ran *[]string) (*App, *bytes.Buffer, *bytes.Buffer) {
+	var verbose bool
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	return &App{
+		Name:    "app",
+		Default: "run",
+		Stdout:  stdout,
+		Stderr:  stderr,
+		Commands: []*Command{
+			{
+				Name:    "run",
+				Summary: "Run the thing",
+				Flags: func(fs *flag.FlagSet) {
+					fs.BoolVar(&verbose, "verbose", false, "Be verbose")
+				},
+				Run: func(args []string) error {
+					*ran = append([]string{"run"}, args...)
+					if verbose {
+						*ran = append(*ran, "verbose")
+					}
+					return nil
+				},
+			},
+			{
+				Name:    "check",
+				Args:    "<id>...",
+				Summary: "Check items",
+				Run: func(args []string) error {
+					*ran = append([]string{"check"}, args...)
+					switch {
+					case len(args) == 0:
+						return Usage(errors.New("no IDs specified"))
+					case args[0] == "fail":
+						return errors.New("failed")
+					case args[0] == "found":
+						return ExitCode(ExitFindings)
+					}
+					return nil
+				},
+			},
+			{
+				Name:    "config",
+				Summary: "Configuration commands",
+				Commands: []*Command{{
+					Name:    "print",
+					Summary: "Print configuration",
+					Run: func(args []string) error {
+						*ran = []string{"config print"}
+						return nil
+					},
+				}},
+			},
+		},
+	}, stdout, stderr
+}
+
+func TestAppRun(t *testing.T) {
+	testCases := []struct {
+		args   []string
+		code   int
+		ran    []string
+		stdout string
+		stderr string
+	}{
+		{args: []string{"run", "-verbose", "a"}, ran: []string{"run", "a", "verbose"}},
+		{args: []string{"-verbose", "--"}, ran: []string{"run", "--", "verbose"}},
+		{args: []string{"check", "1", "2"}, ran: []string{"check", "1", "2"}},
+		{args: []string{"check", "found"}, code: ExitFindings, ran: []string{"check", "found"}},
+		{args: []string{"check", "fail"}, code: ExitError, ran: []string{"check", "fail"}, stderr: "Error: failed\n"},
+		{args: []string{"check"}, code: ExitUsage, ran: []string{"check"}, stderr: "Error: no IDs specified\nUsage: app check <id>...\n\nCheck items\n"},
+		{args: []string{"config", "print"}, ran: []string{"config print"}},
+		{args: []string{"config"}, code: ExitUsage, stderr: "Usage: app config <command> [flags] [arguments]\n\nCommands:\n  print  Print configuration\n"},
+		{args: []string{"config", "dump"}, code: ExitUsage, stderr: "Error: unknown command \"config dump\"\n"},
+		{args: []string{"deploy"}, code: ExitUsage, stderr: "Error: unknown command \"deploy\"\n"},
+		{args: nil, code: ExitUsage, stderr: "  completion  Print shell completion script\n"},
+		{args: []string{"run", "-unknown"}, code: ExitUsage, stderr: "flag provided but not defined: -unknown\nUsage: app run [flags]\n\nRun the thing\n\nFlags:\n  -verbose\n"},
+		{args: []string{"help"}, stdout: "  check       Check items\n"},
+		{args: []string{"help", "run"}, stdout: "Usage: app run [flags]\n\nRun the thing\n"},
+		{args: []string{"run", "-h"}, stdout: "Usage: app run [flags]\n\nRun the thing\n"},
+		{args: []string{"config", "-h"}, stdout: "Usage: app config <command> [flags] [arguments]\n"},
+		{args: []string{"completion"}, code: ExitUsage, stderr: "Error: shell should be specified\n"},
+		{args: []string{"completion", "tcsh"}, code: ExitUsage, stderr: "Error: shell should be one of bash, zsh or fish\n"},
+	}
+	for _, tc := range testCases {
+		var ran []string
+		app, stdout, stderr := testApp(&ran)
+		assert.Equal(t, tc.code, app.Run(tc.args), tc.args)
+		assert.Equal(t, tc.ran, ran, tc.args)
+		assert.Contains(t, stdout.String(), tc.stdout, tc.args)
+		assert.Contains(t, stderr.String(), tc.stderr, tc.args)
+		if tc.code == ExitOK && tc.ran == nil {
+			assert.Empty(t, stderr.String(), "help goes to stdout", tc.args)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	var ran []string
+	app, stdout, _ := testApp(&ran)
+	assert.Equal(t, ExitOK, app.Run([]string{"completion", "bash"}))
+	script := stdout.String()
+	assert.Contains(t, script, `"") COMPREPLY=($(compgen -W "run check config completion" -- "$cur")) ;;`)
+	assert.Contains(t, script, `"run"*) COMPREPLY=($(compgen -W "-verbose" -- "$cur")) ;;`)
+	assert.Contains(t, script, `"config") COMPREPLY=($(compgen -W "print" -- "$cur")) ;;`)
+	assert.Contains(t, script, `"config print"*) COMPREPLY=($(compgen -W "" -- "$cur")) ;;`)
+	assert.Contains(t, script, `"completion"*) COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur")) ;;`)
+	assert.Contains(t, script, "complete -o default -F _app app\n")
+	if bash, err := exec.LookPath("bash"); err == nil {
+		// The script should at least be syntactically valid
+		out, err := exec.Command(bash, "-n", "-c", script).CombinedOutput()
+		assert.NoError(t, err, string(out))
+	}
+
+	stdout.Reset()
+	assert.Equal(t, ExitOK, app.Run([]string{"completion", "zsh"}))
+	assert.True(t, strings.HasPrefix(stdout.String(), "autoload -U +X bashcompinit && bashcompinit\n"))
+
+	stdout.Reset()
+	assert.Equal(t, ExitOK, app.Run([]string{"completion", "fish"}))
+	script = stdout.String()
+	assert.Contains(t, script, "complete -c app -n '__fish_use_subcommand' -a check -d 'Check items'\n")
+	assert.Contains(t, script, "complete -c app -n '__fish_seen_subcommand_from config; and not __fish_seen_subcommand_from print' -a print -d 'Print configuration'\n")
+	assert.Contains(t, script, "complete -c app -n '__fish_seen_subcommand_from run' -o verbose -d 'Be verbose'\n")
+	assert.Contains(t, script, "complete -c app -n '__fish_seen_subcommand_from completion' -a zsh\n")
+	assert.Equal(t, `'it\'s'`, fishQuote("it's"))
+}
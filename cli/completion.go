@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// completion prints completion script for `shell`
+func (a *App) completion(shell string) error {
+	var buf bytes.Buffer
+	commands := append(a.Commands, a.builtins()...)
+	switch shell {
+	case "bash":
+		a.bash(&buf, commands)
+	case "zsh":
+		buf.WriteString("autoload -U +X bashcompinit && bashcompinit\n")
+		a.bash(&buf, commands)
+	case "fish":
+		a.fish(&buf, nil, commands)
+	default:
+		return Usage(errors.New("shell should be one of bash, zsh or fish"))
+	}
+	_, err := a.Stdout.Write(buf.Bytes())
+	return err
+}
+
+// bash writes bash completion function, completing words of the command path, then flags and argument values
+func (a *App) bash(buf *bytes.Buffer, commands []*Command) {
+	fn := "_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, a.Name)
+	fmt.Fprintf(buf, `# bash completion for %[1]s
+%[2]s() {
+    local cur="${COMP_WORDS[COMP_CWORD]}" path="" i
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        case "${COMP_WORDS[i]}" in
+            -*) ;;
+            *) path="${path:+$path }${COMP_WORDS[i]}" ;;
+        esac
+    done
+    case "$path" in
+`, a.Name, fn)
+	var walk func(path []string, commands []*Command)
+	walk = func(path []string, commands []*Command) {
+		var names []string
+		for _, cmd := range commands {
+			names = append(names, cmd.Name)
+		}
+		fmt.Fprintf(buf, "        %q) COMPREPLY=($(compgen -W %q -- \"$cur\")) ;;\n", strings.Join(path, " "), strings.Join(names, " "))
+		for _, cmd := range commands {
+			p := append(append([]string{}, path...), cmd.Name)
+			if cmd.Run == nil {
+				walk(p, cmd.Commands)
+				continue
+			}
+			words := cmd.Values
+			for _, f := range flags(cmd) {
+				words = append(words, "-"+f.Name)
+			}
+			fmt.Fprintf(buf, "        %q*) COMPREPLY=($(compgen -W %q -- \"$cur\")) ;;\n", strings.Join(p, " "), strings.Join(words, " "))
+		}
+	}
+	walk(nil, commands)
+	fmt.Fprintf(buf, "    esac\n}\ncomplete -o default -F %s %s\n", fn, a.Name)
+}
+
+// fish writes fish completions of `commands` following `path`
+func (a *App) fish(buf *bytes.Buffer, path []string, commands []*Command) {
+	if len(path) == 0 {
+		fmt.Fprintf(buf, "# fish completion for %s\n", a.Name)
+	}
+	var names []string
+	for _, cmd := range commands {
+		names = append(names, cmd.Name)
+	}
+	condition := "__fish_use_subcommand"
+	if len(path) > 0 {
+		condition = fmt.Sprintf("__fish_seen_subcommand_from %s; and not __fish_seen_subcommand_from %s", path[len(path)-1], strings.Join(names, " "))
+	}
+	for _, cmd := range commands {
+		fmt.Fprintf(buf, "complete -c %s -n '%s' -a %s -d %s\n", a.Name, condition, cmd.Name, fishQuote(cmd.Summary))
+	}
+	for _, cmd := range commands {
+		if cmd.Run == nil {
+			a.fish(buf, append(path, cmd.Name), cmd.Commands)
+			continue
+		}
+		seen := "__fish_seen_subcommand_from " + cmd.Name
+		for _, v := range cmd.Values {
+			fmt.Fprintf(buf, "complete -c %s -n '%s' -a %s\n", a.Name, seen, v)
+		}
+		for _, f := range flags(cmd) {
+			fmt.Fprintf(buf, "complete -c %s -n '%s' -o %s -d %s\n", a.Name, seen, f.Name, fishQuote(f.Usage))
+		}
+	}
+}
+
+// fishQuote returns `s` in single quotes
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"time"
+)
+
+// AuditQueryConfig holds settings of `audit query` subcommand
+type AuditQueryConfig struct {
+	File  string
+	UUID  string
+	Since time.Time
+	Until time.Time
+}
+
+// Validate checks settings consistency
+func (c AuditQueryConfig) Validate() error {
+	if c.File == "" {
+		return errors.New("no audit file specified")
+	}
+	if !c.Since.IsZero() && !c.Until.IsZero() && !c.Until.After(c.Since) {
+		return errors.New("until should be later than since")
+	}
+	return nil
+}
+
+// Flags registers `audit query` settings flags in `fs`
+func (c *AuditQueryConfig) Flags(fs *flag.FlagSet) {
+	fs.StringVar(&c.UUID, "uuid", "", "Print decisions made for that item only")
+	fs.Var((*timeValue)(&c.Since), "since", "Print decisions made at or after that RFC 3339 time, or that long ago, e.g. '24h'")
+	fs.Var((*timeValue)(&c.Until), "until", "Print decisions made before that RFC 3339 time, or that long ago")
+}
+
+// timeValue implements `flag.Value` accepting RFC 3339 time or duration back from now
+type timeValue time.Time
+
+func (t *timeValue) String() string {
+	if t == nil || time.Time(*t).IsZero() {
+		return ""
+	}
+	return time.Time(*t).Format(time.RFC3339)
+}
+
+func (t *timeValue) Set(value string) error {
+	if at, err := time.Parse(time.RFC3339, value); err == nil {
+		*t = timeValue(at)
+		return nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return errors.New("time should be in RFC 3339 format or a positive duration")
+	}
+	*t = timeValue(time.Now().Add(-d))
+	return nil
+}
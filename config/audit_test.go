@@ -0,0 +1,57 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditQueryConfigValidate(t *testing.T) {
+	at := time.Date(2021, 2, 9, 10, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		config AuditQueryConfig
+		err    error
+	}{
+		{
+			config: AuditQueryConfig{},
+			err:    errors.New("no audit file specified"),
+		},
+		{
+			config: AuditQueryConfig{File: "audit.jsonl", Since: at, Until: at},
+			err:    errors.New("until should be later than since"),
+		},
+		{
+			config: AuditQueryConfig{File: "audit.jsonl", Since: at, Until: at.Add(time.Hour)},
+		},
+		{
+			config: AuditQueryConfig{File: "audit.jsonl", Until: at},
+		},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.err, tc.config.Validate())
+	}
+}
+
+func TestAuditQueryFlags(t *testing.T) {
+	var cfg AuditQueryConfig
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	cfg.Flags(fs)
+	before := time.Now()
+	assert.NoError(t, fs.Parse([]string{
+		"-uuid", "767d967f-b55b-4457-bfee-685eaa6d0583",
+		"-since", "2h",
+		"-until", "2021-02-09T11:00:00+01:00",
+	}))
+	assert.Equal(t, "767d967f-b55b-4457-bfee-685eaa6d0583", cfg.UUID)
+	assert.WithinDuration(t, before.Add(-2*time.Hour), cfg.Since, time.Second)
+	assert.True(t, cfg.Until.Equal(time.Date(2021, 2, 9, 10, 0, 0, 0, time.UTC)))
+	assert.Equal(t, "2021-02-09T11:00:00+01:00", fs.Lookup("until").Value.String())
+	for _, value := range []string{"yesterday", "-1h"} {
+		assert.Error(t, fs.Parse([]string{"-since", value}))
+	}
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/dmitry-vovk/csv-chg-go/ident"
+)
+
+// CheckConfig holds settings of `check` subcommand
+type CheckConfig struct {
+	APIURL     string
+	APITimeout time.Duration // API request timeout, 0 for none
+	IDFormat   string
+	IDs        []string
+	Threshold  int
+	RulesFile  string
+	InstanceID string
+	History    HistoryConfig
+	Verbose    bool              // Dump HTTP exchanges
+	Post       bool              // Post alerts for items that would raise them
+	Sinks      map[string]string // Alert sink specification by severity, for posted alerts
+	Strict     bool              // Reject API responses with unknown fields
+}
+
+// Validate checks settings consistency
+func (c CheckConfig) Validate() error {
+	if len(c.IDs) == 0 {
+		return errors.New("no item IDs specified")
+	}
+	if err := validateAPIURL(c.APIURL); err != nil {
+		return err
+	}
+	if c.APITimeout < 0 {
+		return errors.New("API timeout should not be negative")
+	}
+	f, err := ident.New(c.IDFormat)
+	if err != nil {
+		return err
+	}
+	for _, id := range c.IDs {
+		if _, ok := f.Parse(nil, []byte(id)); !ok {
+			return fmt.Errorf("invalid item ID %q", id)
+		}
+	}
+	if c.Threshold < 1 {
+		return errors.New("threshold should be greater than zero")
+	}
+	return c.History.validate()
+}
+
+// Flags registers `check` settings flags in `fs`
+func (c *CheckConfig) Flags(fs *flag.FlagSet) {
+	fs.StringVar(&c.APIURL, "api", "", "Base API URL")
+	fs.DurationVar(&c.APITimeout, "api-timeout", 30*time.Second, "API request timeout, 0 for none")
+	fs.BoolVar(&c.Strict, "strict-decoding", false, "Reject API responses with fields unknown to this version")
+	fs.StringVar(&c.IDFormat, "id-format", ident.FormatUUID, "Item ID format: uuid, uuid-any, ulid or sku")
+	fs.IntVar(&c.Threshold, "threshold", 5, "Quantity below which low stock alert is raised")
+	fs.StringVar(&c.RulesFile, "rules", "", "File with alert rules, replaces the default 'quantity == 0' critical and 'quantity < threshold' warning rules")
+	hostname, _ := os.Hostname()
+	fs.StringVar(&c.InstanceID, "instance-id", hostname, "Worker instance identifier reported in alerts")
+	historyFlags(fs, &c.History)
+	fs.BoolVar(&c.Verbose, "v", false, "Print full HTTP requests and responses to stderr")
+	fs.BoolVar(&c.Post, "post", false, "Post alerts for items that would raise them")
+	c.Sinks = make(map[string]string)
+	fs.Var(sinks(c.Sinks), "sink", "Destination of posted alerts per severity as 'severity=api|log|URL', can be repeated")
+}
+
+// validateAPIURL checks that `apiURL` is an absolute HTTP(S) URL
+func validateAPIURL(apiURL string) error {
+	if apiURL == "" {
+		return errors.New("no API URL specified")
+	}
+	if u, err := url.Parse(apiURL); err != nil {
+		return fmt.Errorf("API URL parse error: %s", err)
+	} else if !(u.Scheme == "http" || u.Scheme == "https") || u.Host == "" {
+		return errors.New("invalid API URL")
+	}
+	return nil
+}
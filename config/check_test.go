@@ -0,0 +1,73 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckConfigValidate(t *testing.T) {
+	testCases := []struct {
+		config CheckConfig
+		err    error
+	}{
+		{
+			config: CheckConfig{},
+			err:    errors.New("no item IDs specified"),
+		},
+		{
+			config: CheckConfig{IDs: []string{"A-1"}, APIURL: "ftp://example.com"},
+			err:    errors.New("invalid API URL"),
+		},
+		{
+			config: CheckConfig{IDs: []string{"A-1"}, APIURL: "http://example.com", APITimeout: -time.Second},
+			err:    errors.New("API timeout should not be negative"),
+		},
+		{
+			config: CheckConfig{IDs: []string{"A-1"}, APIURL: "http://example.com", IDFormat: "guid"},
+			err:    errors.New("ID format should be one of uuid, uuid-any, ulid or sku"),
+		},
+		{
+			config: CheckConfig{IDs: []string{"A-1"}, APIURL: "http://example.com", IDFormat: "uuid"},
+			err:    errors.New(`invalid item ID "A-1"`),
+		},
+		{
+			config: CheckConfig{IDs: []string{"A-1"}, APIURL: "http://example.com", IDFormat: "sku"},
+			err:    errors.New("threshold should be greater than zero"),
+		},
+		{
+			config: CheckConfig{IDs: []string{"A-1"}, APIURL: "http://example.com", IDFormat: "sku", Threshold: 5, History: HistoryConfig{Window: time.Hour, Horizon: time.Hour}},
+			err:    errors.New("prediction requires history file"),
+		},
+		{
+			config: CheckConfig{IDs: []string{"A-1"}, APIURL: "http://example.com", IDFormat: "sku", Threshold: 5, History: HistoryConfig{Window: time.Hour}},
+		},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.err, tc.config.Validate())
+	}
+}
+
+func TestCheckFlags(t *testing.T) {
+	var cfg CheckConfig
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	cfg.Flags(fs)
+	assert.NoError(t, fs.Parse([]string{"-api", "http://example.com", "-v", "-post", "-sink", "critical=log", "-strict-decoding"}))
+	hostname, _ := os.Hostname()
+	assert.Equal(t, CheckConfig{
+		APIURL:     "http://example.com",
+		APITimeout: 30 * time.Second,
+		IDFormat:   "uuid",
+		Threshold:  5,
+		InstanceID: hostname,
+		History:    HistoryConfig{Window: 7 * 24 * time.Hour},
+		Verbose:    true,
+		Post:       true,
+		Sinks:      map[string]string{"critical": "log"},
+		Strict:     true,
+	}, cfg)
+}
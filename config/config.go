@@ -4,57 +4,440 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"net/http"
 	"net/url"
 	"os"
+	"strings"
 	"time"
+
+	"github.com/dmitry-vovk/csv-chg-go/ident"
+	"github.com/dmitry-vovk/csv-chg-go/schedule"
+	"github.com/dmitry-vovk/csv-chg-go/shard"
+	"github.com/dmitry-vovk/csv-chg-go/sink"
 )
 
 type Config struct {
-	APIURL   string
-	CSVFile  string
-	Interval time.Duration
-	Workers  int
+	APIURL       string
+	APITimeout   time.Duration // API request timeout, 0 for none
+	CSVFile      string
+	Interval     time.Duration
+	Schedule     ScheduleConfig
+	AutoInterval AutoIntervalConfig
+	Workers      int
+	Adaptive     AdaptiveConfig
+	Threshold    int
+	InstanceID   string
+	RulesFile    string
+	Sinks        map[string]string // Alert sink specification by severity
+	Escalation   int
+	Shard        ShardConfig
+	LockFile     string
+	DrainTimeout time.Duration // How long shutdown waits for checks in progress
+	Store        string
+	IDFormat     string
+	MaxLine      int
+	Parsers      int
+	Input        InputConfig
+	History      HistoryConfig
+	MetricsAddr  string
+	Trace        TraceConfig
+	Audit        AuditConfig
+	ItemCache    bool
+	Strict       bool // Reject API responses with unknown fields
+
+	WarehousesFile string // File declaring several warehouses checked by the process
+	Warehouse      string // Name of the warehouse these settings are for, empty for a single one
+}
+
+// ShardConfig selects a subset of input this instance is responsible for
+type ShardConfig struct {
+	Index int
+	Count int
+	Mode  string
+}
+
+// AdaptiveConfig holds bounds of adaptive API requests concurrency
+type AdaptiveConfig struct {
+	Enabled       bool
+	MinWorkers    int
+	MaxWorkers    int
+	TargetLatency time.Duration
+}
+
+// AutoIntervalConfig holds bounds of per-item check intervals derived from consumption
+type AutoIntervalConfig struct {
+	Enabled bool
+	Min     time.Duration
+	Max     time.Duration
+}
+
+// ScheduleConfig holds cron schedules and quiet hours, replacing fixed interval between checks
+type ScheduleConfig struct {
+	Crons      []string
+	TimeZone   string
+	QuietHours []string
+}
+
+// HistoryConfig holds settings of observations recording and stockout prediction
+type HistoryConfig struct {
+	File    string
+	Window  time.Duration
+	Horizon time.Duration
+}
+
+// InputConfig holds settings for fetching remote input
+type InputConfig struct {
+	Token        string
+	Headers      http.Header
+	Timeout      time.Duration
+	Retries      int
+	MaxRedirects int
+	CacheDir     string
+}
+
+// adaptiveFlags registers adaptive concurrency settings flags in `fs`
+func adaptiveFlags(fs *flag.FlagSet, c *AdaptiveConfig) {
+	fs.BoolVar(&c.Enabled, "adaptive", false, "Adapt parallel API requests to API latency and errors, starting from -workers")
+	fs.IntVar(&c.MinWorkers, "min-workers", 1, "Lower bound of adaptive parallel API requests")
+	fs.IntVar(&c.MaxWorkers, "max-workers", 64, "Upper bound of adaptive parallel API requests")
+	fs.DurationVar(&c.TargetLatency, "target-latency", time.Second, "Slower API responses reduce adaptive parallel requests")
 }
 
+// validate checks adaptive settings against initial `workers` count
+func (c AdaptiveConfig) validate(workers int) error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.MinWorkers < 1 {
+		return errors.New("min workers should be greater than zero")
+	}
+	if c.MaxWorkers < c.MinWorkers {
+		return errors.New("max workers should not be less than min workers")
+	}
+	if workers < c.MinWorkers || workers > c.MaxWorkers {
+		return errors.New("workers count should be within min and max workers")
+	}
+	if c.TargetLatency <= 0 {
+		return errors.New("target latency should be positive")
+	}
+	return nil
+}
+
+// autoIntervalFlags registers derived check intervals settings flags in `fs`
+func autoIntervalFlags(fs *flag.FlagSet, c *AutoIntervalConfig) {
+	fs.BoolVar(&c.Enabled, "auto-interval", false, "Check items at intervals derived from their consumption")
+	fs.DurationVar(&c.Min, "min-interval", time.Minute, "Shortest derived check interval")
+	fs.DurationVar(&c.Max, "max-interval", 24*time.Hour, "Longest derived check interval")
+}
+
+func (c AutoIntervalConfig) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Min < time.Second {
+		return errors.New("min interval should be at least a second")
+	}
+	if c.Max < c.Min {
+		return errors.New("max interval should not be less than min interval")
+	}
+	return nil
+}
+
+// scheduleFlags registers schedule settings flags in `fs`
+func scheduleFlags(fs *flag.FlagSet, c *ScheduleConfig) {
+	fs.Var((*list)(&c.Crons), "schedule", "Cron expression of check times, replaces -interval, can be repeated")
+	fs.StringVar(&c.TimeZone, "timezone", "Local", "Time zone of schedules and quiet hours, e.g. Europe/London")
+	fs.Var((*list)(&c.QuietHours), "quiet-hours", "Daily 'HH:MM-HH:MM' window when alerts are deferred until it ends, can be repeated")
+}
+
+func (c ScheduleConfig) validate() error {
+	loc, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		return fmt.Errorf("unknown time zone %q", c.TimeZone)
+	}
+	if _, err = schedule.Parse(c.Crons, loc); err != nil {
+		return err
+	}
+	ws, err := schedule.ParseWindows(c.QuietHours, loc)
+	if err != nil {
+		return err
+	}
+	if ws.AllDay() {
+		return errors.New("quiet hours should not cover the whole day")
+	}
+	return nil
+}
+
+// TraceConfig sets where traces of check cycles are exported
+type TraceConfig struct {
+	Dest    string  // `stdout`, file path or OTLP/HTTP collector URL, empty to disable tracing
+	Service string  // Service name reported to the collector
+	Sample  float64 // Ratio of check cycles traced, from 0 to 1
+}
+
+// traceFlags registers tracing settings flags in `fs`
+func traceFlags(fs *flag.FlagSet, c *TraceConfig) {
+	fs.StringVar(&c.Dest, "trace", "", "Export traces of check cycles to 'stdout', a file, or an OTLP/HTTP collector URL")
+	fs.StringVar(&c.Service, "trace-service", "csv-chg-go", "Service name of exported traces")
+	fs.Float64Var(&c.Sample, "trace-sample", 1, "Ratio of check cycles traced, from 0 to 1")
+}
+
+func (c TraceConfig) validate() error {
+	if strings.HasPrefix(c.Dest, "http://") || strings.HasPrefix(c.Dest, "https://") {
+		if u, err := url.Parse(c.Dest); err != nil || u.Host == "" {
+			return errors.New("invalid trace collector URL")
+		}
+	}
+	if c.Dest != "" && c.Service == "" {
+		return errors.New("trace service name should not be empty")
+	}
+	if c.Sample < 0 || c.Sample > 1 {
+		return errors.New("trace sample ratio should be between 0 and 1")
+	}
+	return nil
+}
+
+// AuditConfig sets where alert decisions are recorded
+type AuditConfig struct {
+	File    string        // JSON lines file, empty to disable auditing
+	MaxSize int           // Megabytes written before the file is rotated, 0 for no limit
+	MaxAge  time.Duration // Age of the file when it is rotated, 0 for no limit
+}
+
+// auditFlags registers audit log settings flags in `fs`
+func auditFlags(fs *flag.FlagSet, c *AuditConfig) {
+	fs.StringVar(&c.File, "audit", "", "File to record every alert decision to")
+	fs.IntVar(&c.MaxSize, "audit-max-size", 100, "Size in megabytes at which audit file is rotated, 0 for no limit")
+	fs.DurationVar(&c.MaxAge, "audit-max-age", 24*time.Hour, "Age at which audit file is rotated, 0 for no limit")
+}
+
+func (c AuditConfig) validate() error {
+	if c.MaxSize < 0 {
+		return errors.New("audit max size should not be negative")
+	}
+	if c.MaxAge < 0 {
+		return errors.New("audit max age should not be negative")
+	}
+	return nil
+}
+
+// historyFlags registers history and prediction settings flags in `fs`
+func historyFlags(fs *flag.FlagSet, c *HistoryConfig) {
+	fs.StringVar(&c.File, "history", "", "File to record observed quantities to")
+	fs.DurationVar(&c.Window, "history-window", 7*24*time.Hour, "Period of history used for stockout prediction")
+	fs.DurationVar(&c.Horizon, "predict-horizon", 0, "Raise alert if stockout is projected within that period, 0 to disable")
+}
+
+func (c HistoryConfig) validate() error {
+	if c.Window <= 0 {
+		return errors.New("history window should be positive")
+	}
+	if c.Horizon < 0 {
+		return errors.New("prediction horizon should not be negative")
+	}
+	if c.Horizon > 0 && c.File == "" {
+		return errors.New("prediction requires history file")
+	}
+	return nil
+}
+
+// inputFlags registers remote input settings flags in `fs`
+func inputFlags(fs *flag.FlagSet, c *InputConfig) {
+	c.Headers = make(http.Header)
+	fs.StringVar(&c.Token, "input-token", "", "Bearer token for remote input")
+	fs.Var(headers(c.Headers), "input-header", "Extra 'Key: Value' header for remote input, can be repeated")
+	fs.DurationVar(&c.Timeout, "input-timeout", 5*time.Minute, "Remote input download timeout, 0 for none")
+	fs.IntVar(&c.Retries, "input-retries", 3, "Number of retries for failed remote input requests")
+	fs.IntVar(&c.MaxRedirects, "input-max-redirects", 10, "Maximum redirects to follow for remote input, 0 to disable")
+	fs.StringVar(&c.CacheDir, "input-cache-dir", "", "Directory to cache remote input for conditional requests")
+}
+
+func (c InputConfig) validate() error {
+	if c.Timeout < 0 {
+		return errors.New("input timeout should not be negative")
+	}
+	if c.Retries < 0 {
+		return errors.New("input retries should not be negative")
+	}
+	if c.MaxRedirects < 0 {
+		return errors.New("input max redirects should not be negative")
+	}
+	return nil
+}
+
+// minMaxLine is the lowest accepted line length limit, lines of UUIDs should fit
+const minMaxLine = 36
+
+// severities that can have dedicated alert sink
+var severities = []string{"info", "warning", "critical", "escalation"}
+
+// sinks implements `flag.Value` collecting repeated "severity=sink" arguments
+type sinks map[string]string
+
+func (s sinks) String() string {
+	var list []string
+	for k, v := range s {
+		list = append(list, k+"="+v)
+	}
+	return strings.Join(list, ", ")
+}
+
+func (s sinks) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 {
+		return errors.New("sink should be in 'severity=sink' format")
+	}
+	for _, severity := range severities {
+		if parts[0] == severity {
+			if _, err := sink.New(parts[1], nil); err != nil {
+				return err
+			}
+			s[severity] = parts[1]
+			return nil
+		}
+	}
+	return errors.New("severity should be one of " + strings.Join(severities, ", "))
+}
+
+// list implements `flag.Value` collecting repeated arguments
+type list []string
+
+func (l *list) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, "; ")
+}
+
+func (l *list) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// headers implements `flag.Value` collecting repeated "Key: Value" arguments
+type headers http.Header
+
+func (h headers) String() string {
+	var s []string
+	for k, v := range h {
+		s = append(s, k+": "+strings.Join(v, ", "))
+	}
+	return strings.Join(s, "; ")
+}
+
+func (h headers) Set(value string) error {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return errors.New("header should be in 'Key: Value' format")
+	}
+	http.Header(h).Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	return nil
+}
+
+// Validate checks settings consistency, of every warehouse if warehouses file is set
+func (c Config) Validate() error {
+	if c.WarehousesFile != "" {
+		return c.validateWarehouses()
+	}
+	return c.validate()
+}
+
+// validate checks settings of a single warehouse
 func (c Config) validate() error {
 	if c.CSVFile == "" {
 		return errors.New("no input specified")
 	}
-	if c.APIURL == "" {
-		return errors.New("no API URL specified")
+	if err := validateAPIURL(c.APIURL); err != nil {
+		return err
 	}
-	if u, err := url.Parse(c.APIURL); err != nil {
-		return fmt.Errorf("API URL parse error: %s", err)
-	} else if !(u.Scheme == "http" || u.Scheme == "https") || u.Host == "" {
-		return errors.New("invalid API URL")
+	if c.APITimeout < 0 {
+		return errors.New("API timeout should not be negative")
 	}
 	if c.Workers < 1 {
 		return errors.New("workers count should be greater than zero")
 	}
+	if err := c.Adaptive.validate(c.Workers); err != nil {
+		return err
+	}
 	if c.Interval < time.Second {
 		return errors.New("interval should be at least a second")
 	}
-	return nil
-}
-
-func MustLoad() Config {
-	cfg := Config{}
-	flag.StringVar(&cfg.APIURL, "api", "", "Base API URL")
-	flag.StringVar(&cfg.CSVFile, "input", "", "CSV file source path")
-	var interval string
-	flag.StringVar(&interval, "interval", "60s", "Interval between checks in time.Duration format")
-	flag.IntVar(&cfg.Workers, "workers", 1, "Number of parallel API requests")
-	flag.Parse()
-	if cfg.CSVFile == "" && os.Args[len(os.Args)-1] == "--" {
-		cfg.CSVFile = "--"
+	if err := c.Schedule.validate(); err != nil {
+		return err
+	}
+	if err := c.AutoInterval.validate(); err != nil {
+		return err
+	}
+	if c.Threshold < 1 {
+		return errors.New("threshold should be greater than zero")
+	}
+	if c.Escalation < 0 {
+		return errors.New("escalation cycles should not be negative")
+	}
+	if c.DrainTimeout < 0 {
+		return errors.New("drain timeout should not be negative")
+	}
+	if c.MaxLine < minMaxLine {
+		return fmt.Errorf("max line length should be at least %d", minMaxLine)
+	}
+	if c.Parsers < 0 {
+		return errors.New("parsers count should not be negative")
 	}
-	// Ignoring the error here as it will be validated later
-	cfg.Interval, _ = time.ParseDuration(interval)
-	if err := cfg.validate(); err != nil {
-		log.Printf("Error: %s", err)
-		flag.Usage()
-		os.Exit(1)
+	if c.Store != "map" && c.Store != "sorted" {
+		return errors.New("store should be either map or sorted")
 	}
-	return cfg
+	if f, err := ident.New(c.IDFormat); err != nil {
+		return err
+	} else if c.Store == "sorted" && f.Size() == 0 {
+		return fmt.Errorf("sorted store does not support %s IDs", c.IDFormat)
+	}
+	if _, err := shard.New(c.Shard.Index, c.Shard.Count, c.Shard.Mode); err != nil {
+		return err
+	}
+	if err := c.History.validate(); err != nil {
+		return err
+	}
+	if err := c.Trace.validate(); err != nil {
+		return err
+	}
+	if err := c.Audit.validate(); err != nil {
+		return err
+	}
+	return c.Input.validate()
+}
+
+// Flags registers `run` settings flags in `fs`
+func (c *Config) Flags(fs *flag.FlagSet) {
+	c.Sinks = make(map[string]string)
+	fs.StringVar(&c.APIURL, "api", "", "Base API URL")
+	fs.DurationVar(&c.APITimeout, "api-timeout", 30*time.Second, "API request timeout, 0 for none")
+	fs.BoolVar(&c.Strict, "strict-decoding", false, "Reject API responses with fields unknown to this version")
+	fs.StringVar(&c.CSVFile, "input", "", "CSV file source path, '--' for stdin")
+	fs.StringVar(&c.WarehousesFile, "warehouses", "", "JSON file declaring warehouses to check, flags set defaults for them")
+	fs.DurationVar(&c.Interval, "interval", 60*time.Second, "Interval between checks in time.Duration format")
+	scheduleFlags(fs, &c.Schedule)
+	autoIntervalFlags(fs, &c.AutoInterval)
+	fs.IntVar(&c.Workers, "workers", 1, "Number of parallel API requests")
+	adaptiveFlags(fs, &c.Adaptive)
+	fs.IntVar(&c.Threshold, "threshold", 5, "Quantity below which low stock alert is raised")
+	fs.StringVar(&c.RulesFile, "rules", "", "File with alert rules, replaces the default 'quantity == 0' critical and 'quantity < threshold' warning rules")
+	fs.Var(sinks(c.Sinks), "sink", "Alert destination per severity as 'severity=api|log|URL', can be repeated")
+	fs.IntVar(&c.Escalation, "escalate-after", 0, "Escalate alert after that many cycles in the same state, 0 to disable")
+	hostname, _ := os.Hostname()
+	fs.StringVar(&c.InstanceID, "instance-id", hostname, "Worker instance identifier reported in alerts")
+	fs.IntVar(&c.Shard.Index, "shard-index", 0, "Index of this instance among shards, starting from 0")
+	fs.IntVar(&c.Shard.Count, "shard-count", 1, "Number of instances sharing the input")
+	fs.StringVar(&c.Shard.Mode, "shard-mode", shard.ModeRendezvous, "How UUIDs are assigned to shards, rendezvous or modulo")
+	fs.IntVar(&c.MaxLine, "max-line-length", 4096, "Input lines longer than that are rejected")
+	fs.IntVar(&c.Parsers, "parsers", 0, "Number of goroutines parsing input, 0 for one per CPU")
+	fs.StringVar(&c.Store, "store", "map", "ID store: map, or sorted for smaller memory footprint and ordered checks")
+	fs.StringVar(&c.IDFormat, "id-format", ident.FormatUUID, "Item ID format: uuid, uuid-any, ulid or sku")
+	fs.StringVar(&c.LockFile, "lock-file", "", "Lock file for leader election, only the leader runs checks")
+	fs.DurationVar(&c.DrainTimeout, "drain-timeout", 30*time.Second, "How long shutdown waits for checks in progress before aborting them, 0 to wait indefinitely")
+	historyFlags(fs, &c.History)
+	inputFlags(fs, &c.Input)
+	fs.BoolVar(&c.ItemCache, "item-cache", false, "Cache item details and revalidate them with conditional requests")
+	fs.StringVar(&c.MetricsAddr, "metrics-addr", "", "Address to serve Prometheus metrics at /metrics, e.g. ':9090'")
+	traceFlags(fs, &c.Trace)
+	auditFlags(fs, &c.Audit)
 }
@@ -1,10 +1,10 @@
 package config
 
 import (
-	"bytes"
 	"errors"
+	"flag"
+	"net/http"
 	"os"
-	"os/exec"
 	"strconv"
 	"testing"
 	"time"
@@ -48,6 +48,42 @@ func TestConfigValidate(t *testing.T) {
 			},
 			err: errors.New("workers count should be greater than zero"),
 		},
+		{
+			config: Config{
+				APIURL:   "http://valid.url",
+				CSVFile:  "/some/file",
+				Workers:  1,
+				Adaptive: AdaptiveConfig{Enabled: true},
+			},
+			err: errors.New("min workers should be greater than zero"),
+		},
+		{
+			config: Config{
+				APIURL:   "http://valid.url",
+				CSVFile:  "/some/file",
+				Workers:  1,
+				Adaptive: AdaptiveConfig{Enabled: true, MinWorkers: 2, MaxWorkers: 1},
+			},
+			err: errors.New("max workers should not be less than min workers"),
+		},
+		{
+			config: Config{
+				APIURL:   "http://valid.url",
+				CSVFile:  "/some/file",
+				Workers:  1,
+				Adaptive: AdaptiveConfig{Enabled: true, MinWorkers: 2, MaxWorkers: 10},
+			},
+			err: errors.New("workers count should be within min and max workers"),
+		},
+		{
+			config: Config{
+				APIURL:   "http://valid.url",
+				CSVFile:  "/some/file",
+				Workers:  1,
+				Adaptive: AdaptiveConfig{Enabled: true, MinWorkers: 1, MaxWorkers: 10},
+			},
+			err: errors.New("target latency should be positive"),
+		},
 		{
 			config: Config{
 				APIURL:  "http://valid.url",
@@ -65,60 +101,408 @@ func TestConfigValidate(t *testing.T) {
 			},
 			err: errors.New("interval should be at least a second"),
 		},
+		{
+			config: Config{
+				APIURL:    "http://valid.url",
+				CSVFile:   "/some/file",
+				Workers:   1,
+				Interval:  time.Second,
+				Threshold: 5,
+				MaxLine:   36,
+				Store:     "map",
+				IDFormat:  "uuid",
+				Shard:     ShardConfig{Index: 0, Count: 1, Mode: "rendezvous"},
+				History:   HistoryConfig{Window: time.Hour},
+			},
+		},
+		{
+			config: Config{
+				APIURL:   "http://valid.url",
+				CSVFile:  "/some/file",
+				Workers:  1,
+				Interval: time.Second,
+				MaxLine:  36,
+				Store:    "map",
+				IDFormat: "uuid",
+				Shard:    ShardConfig{Index: 0, Count: 1, Mode: "rendezvous"},
+				History:  HistoryConfig{Window: time.Hour},
+			},
+			err: errors.New("threshold should be greater than zero"),
+		},
+		{
+			config: Config{
+				APIURL:   "http://valid.url",
+				CSVFile:  "/some/file",
+				Workers:  1,
+				Interval: time.Second,
+				Schedule: ScheduleConfig{TimeZone: "Mars/Olympus_Mons"},
+			},
+			err: errors.New(`unknown time zone "Mars/Olympus_Mons"`),
+		},
+		{
+			config: Config{
+				APIURL:   "http://valid.url",
+				CSVFile:  "/some/file",
+				Workers:  1,
+				Interval: time.Second,
+				Schedule: ScheduleConfig{TimeZone: "UTC", Crons: []string{"*/5 9-17 * * *", "0 0 * *"}},
+			},
+			err: errors.New(`cron expression "0 0 * *" should have 5 fields`),
+		},
+		{
+			config: Config{
+				APIURL:   "http://valid.url",
+				CSVFile:  "/some/file",
+				Workers:  1,
+				Interval: time.Second,
+				Schedule: ScheduleConfig{TimeZone: "UTC", QuietHours: []string{"22:00"}},
+			},
+			err: errors.New(`window "22:00" should be in HH:MM-HH:MM format`),
+		},
 		{
 			config: Config{
 				APIURL:   "http://valid.url",
 				CSVFile:  "/some/file",
 				Workers:  1,
 				Interval: time.Second,
+				Schedule: ScheduleConfig{TimeZone: "UTC", QuietHours: []string{"00:00-12:00", "12:00-00:00"}},
+			},
+			err: errors.New("quiet hours should not cover the whole day"),
+		},
+		{
+			config: Config{
+				APIURL:       "http://valid.url",
+				CSVFile:      "/some/file",
+				Workers:      1,
+				Interval:     time.Second,
+				AutoInterval: AutoIntervalConfig{Enabled: true},
+			},
+			err: errors.New("min interval should be at least a second"),
+		},
+		{
+			config: Config{
+				APIURL:       "http://valid.url",
+				CSVFile:      "/some/file",
+				Workers:      1,
+				Interval:     time.Second,
+				AutoInterval: AutoIntervalConfig{Enabled: true, Min: time.Hour, Max: time.Minute},
+			},
+			err: errors.New("max interval should not be less than min interval"),
+		},
+		{
+			config: Config{
+				APIURL:     "http://valid.url",
+				CSVFile:    "/some/file",
+				Workers:    1,
+				Interval:   time.Second,
+				Threshold:  5,
+				Escalation: -1,
 			},
+			err: errors.New("escalation cycles should not be negative"),
+		},
+		{
+			config: Config{
+				APIURL:       "http://valid.url",
+				CSVFile:      "/some/file",
+				Workers:      1,
+				Interval:     time.Second,
+				Threshold:    5,
+				DrainTimeout: -time.Second,
+			},
+			err: errors.New("drain timeout should not be negative"),
+		},
+		{
+			config: Config{
+				APIURL:     "http://valid.url",
+				APITimeout: -time.Second,
+				CSVFile:    "/some/file",
+			},
+			err: errors.New("API timeout should not be negative"),
+		},
+		{
+			config: Config{
+				APIURL:    "http://valid.url",
+				CSVFile:   "/some/file",
+				Workers:   1,
+				Interval:  time.Second,
+				Threshold: 5,
+			},
+			err: errors.New("max line length should be at least 36"),
+		},
+		{
+			config: Config{
+				APIURL:    "http://valid.url",
+				CSVFile:   "/some/file",
+				Workers:   1,
+				Interval:  time.Second,
+				Threshold: 5,
+				MaxLine:   36,
+				Parsers:   -1,
+			},
+			err: errors.New("parsers count should not be negative"),
+		},
+		{
+			config: Config{
+				APIURL:    "http://valid.url",
+				CSVFile:   "/some/file",
+				Workers:   1,
+				Interval:  time.Second,
+				Threshold: 5,
+				MaxLine:   36,
+			},
+			err: errors.New("store should be either map or sorted"),
+		},
+		{
+			config: Config{
+				APIURL:    "http://valid.url",
+				CSVFile:   "/some/file",
+				Workers:   1,
+				Interval:  time.Second,
+				Threshold: 5,
+				MaxLine:   36,
+				Store:     "map",
+				IDFormat:  "guid",
+			},
+			err: errors.New("ID format should be one of uuid, uuid-any, ulid or sku"),
+		},
+		{
+			config: Config{
+				APIURL:    "http://valid.url",
+				CSVFile:   "/some/file",
+				Workers:   1,
+				Interval:  time.Second,
+				Threshold: 5,
+				MaxLine:   36,
+				Store:     "sorted",
+				IDFormat:  "sku",
+			},
+			err: errors.New("sorted store does not support sku IDs"),
+		},
+		{
+			config: Config{
+				APIURL:    "http://valid.url",
+				CSVFile:   "/some/file",
+				Workers:   1,
+				Interval:  time.Second,
+				Threshold: 5,
+				MaxLine:   36,
+				Store:     "sorted",
+				IDFormat:  "uuid",
+			},
+			err: errors.New("shard count should be greater than zero"),
+		},
+		{
+			config: Config{
+				APIURL:    "http://valid.url",
+				CSVFile:   "/some/file",
+				Workers:   1,
+				Interval:  time.Second,
+				Threshold: 5,
+				MaxLine:   36,
+				Store:     "map",
+				IDFormat:  "uuid",
+				Shard:     ShardConfig{Index: 0, Count: 1, Mode: "modulo"},
+			},
+			err: errors.New("history window should be positive"),
+		},
+		{
+			config: Config{
+				APIURL:    "http://valid.url",
+				CSVFile:   "/some/file",
+				Workers:   1,
+				Interval:  time.Second,
+				Threshold: 5,
+				MaxLine:   36,
+				Store:     "map",
+				IDFormat:  "uuid",
+				Shard:     ShardConfig{Index: 0, Count: 1, Mode: "modulo"},
+				History:   HistoryConfig{Window: time.Hour, Horizon: -1},
+			},
+			err: errors.New("prediction horizon should not be negative"),
+		},
+		{
+			config: Config{
+				APIURL:    "http://valid.url",
+				CSVFile:   "/some/file",
+				Workers:   1,
+				Interval:  time.Second,
+				Threshold: 5,
+				MaxLine:   36,
+				Store:     "map",
+				IDFormat:  "uuid",
+				Shard:     ShardConfig{Index: 0, Count: 1, Mode: "modulo"},
+				History:   HistoryConfig{Window: time.Hour, Horizon: time.Hour},
+			},
+			err: errors.New("prediction requires history file"),
+		},
+		{
+			config: Config{
+				APIURL:    "http://valid.url",
+				CSVFile:   "/some/file",
+				Workers:   1,
+				Interval:  time.Second,
+				Threshold: 5,
+				MaxLine:   36,
+				Store:     "map",
+				IDFormat:  "uuid",
+				Shard:     ShardConfig{Index: 0, Count: 1, Mode: "modulo"},
+				History:   HistoryConfig{File: "/some/history", Window: time.Hour, Horizon: time.Hour},
+			},
+		},
+		{
+			config: Config{
+				APIURL:    "http://valid.url",
+				CSVFile:   "/some/file",
+				Workers:   1,
+				Interval:  time.Second,
+				Threshold: 5,
+				MaxLine:   36,
+				Store:     "map",
+				IDFormat:  "uuid",
+				Shard:     ShardConfig{Index: 0, Count: 1, Mode: "modulo"},
+				History:   HistoryConfig{Window: time.Hour},
+				Input:     InputConfig{Timeout: -1},
+			},
+			err: errors.New("input timeout should not be negative"),
+		},
+		{
+			config: Config{
+				APIURL:    "http://valid.url",
+				CSVFile:   "/some/file",
+				Workers:   1,
+				Interval:  time.Second,
+				Threshold: 5,
+				MaxLine:   36,
+				Store:     "map",
+				IDFormat:  "uuid",
+				Shard:     ShardConfig{Index: 0, Count: 1, Mode: "modulo"},
+				History:   HistoryConfig{Window: time.Hour},
+				Input:     InputConfig{Retries: -1},
+			},
+			err: errors.New("input retries should not be negative"),
+		},
+		{
+			config: Config{
+				APIURL:    "http://valid.url",
+				CSVFile:   "/some/file",
+				Workers:   1,
+				Interval:  time.Second,
+				Threshold: 5,
+				MaxLine:   36,
+				Store:     "map",
+				IDFormat:  "uuid",
+				Shard:     ShardConfig{Index: 0, Count: 1, Mode: "modulo"},
+				History:   HistoryConfig{Window: time.Hour},
+				Input:     InputConfig{MaxRedirects: -1},
+			},
+			err: errors.New("input max redirects should not be negative"),
 		},
 	}
 	for i, tc := range testCases {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
-			assert.Equal(t, tc.err, tc.config.validate())
+			assert.Equal(t, tc.err, tc.config.Validate())
 		})
 	}
 }
 
-func TestMustLoad(t *testing.T) {
-	keepArgs := os.Args
-	defer func() { os.Args = keepArgs }()
-	args := []string{
-		os.Args[0],
-		"-api", "http://example.com",
-		"--",
-	}
-	os.Args = args
-	cfg := MustLoad()
+func TestFlags(t *testing.T) {
+	var cfg Config
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	cfg.Flags(fs)
+	assert.NoError(t, fs.Parse([]string{"-api", "http://example.com", "-input", "--"}))
+	hostname, _ := os.Hostname()
 	assert.Equal(t, Config{
-		APIURL:   "http://example.com",
-		CSVFile:  "--",
-		Interval: 60 * time.Second,
-		Workers:  1,
+		APIURL:     "http://example.com",
+		APITimeout: 30 * time.Second,
+		CSVFile:    "--",
+		Interval:   60 * time.Second,
+		Schedule:   ScheduleConfig{TimeZone: "Local"},
+		AutoInterval: AutoIntervalConfig{
+			Min: time.Minute,
+			Max: 24 * time.Hour,
+		},
+		Workers: 1,
+		Adaptive: AdaptiveConfig{
+			MinWorkers:    1,
+			MaxWorkers:    64,
+			TargetLatency: time.Second,
+		},
+		Threshold:    5,
+		InstanceID:   hostname,
+		DrainTimeout: 30 * time.Second,
+		Sinks:        map[string]string{},
+		Store:        "map",
+		IDFormat:     "uuid",
+		MaxLine:      4096,
+		Shard: ShardConfig{
+			Count: 1,
+			Mode:  "rendezvous",
+		},
+		History: HistoryConfig{
+			Window: 7 * 24 * time.Hour,
+		},
+		Input: InputConfig{
+			Headers:      http.Header{},
+			Timeout:      5 * time.Minute,
+			Retries:      3,
+			MaxRedirects: 10,
+		},
+		Trace: TraceConfig{Service: "csv-chg-go", Sample: 1},
+		Audit: AuditConfig{MaxSize: 100, MaxAge: 24 * time.Hour},
 	}, cfg)
 }
 
-// This one is not picked up by test coverage analyser
-func TestMustExit(t *testing.T) {
-	// Run subprocess that is expected to exit with code 1
-	if os.Getenv("MUST_EXIT") == "1" {
-		keepArgs := os.Args
-		defer func() { os.Args = keepArgs }()
-		args := []string{
-			os.Args[0],
-			"-api", "http://example.com",
-		}
-		os.Args = args
-		MustLoad()
-		panic("I am unreachable")
-	}
-	// Run subprocess and collect its output
-	cmd := exec.Command(os.Args[0], "-test.run=TestMustExit")
-	cmd.Env = append(os.Environ(), "MUST_EXIT=1")
-	out, err := cmd.CombinedOutput()
-	if e, ok := err.(*exec.ExitError); assert.True(t, ok) {
-		assert.Equal(t, 1, e.ExitCode())
-		assert.True(t, bytes.Contains(out, []byte(`Error: no input specified`)))
-	}
+func TestTraceConfig(t *testing.T) {
+	assert.NoError(t, TraceConfig{}.validate())
+	assert.NoError(t, TraceConfig{Dest: "stdout", Service: "svc"}.validate())
+	assert.NoError(t, TraceConfig{Dest: "http://localhost:4318/v1/traces", Service: "svc"}.validate())
+	assert.EqualError(t, TraceConfig{Dest: "http://", Service: "svc"}.validate(), "invalid trace collector URL")
+	assert.EqualError(t, TraceConfig{Dest: "traces.jsonl"}.validate(), "trace service name should not be empty")
+	assert.NoError(t, TraceConfig{Dest: "stdout", Service: "svc", Sample: 0.01}.validate())
+	assert.EqualError(t, TraceConfig{Dest: "stdout", Service: "svc", Sample: 1.5}.validate(), "trace sample ratio should be between 0 and 1")
+	assert.EqualError(t, TraceConfig{Sample: -1}.validate(), "trace sample ratio should be between 0 and 1")
+}
+
+func TestAuditConfig(t *testing.T) {
+	assert.NoError(t, AuditConfig{}.validate())
+	assert.NoError(t, AuditConfig{File: "audit.jsonl", MaxSize: 10, MaxAge: time.Hour}.validate())
+	assert.EqualError(t, AuditConfig{MaxSize: -1}.validate(), "audit max size should not be negative")
+	assert.EqualError(t, AuditConfig{MaxAge: -time.Hour}.validate(), "audit max age should not be negative")
+}
+
+func TestScheduleFlags(t *testing.T) {
+	var cfg Config
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	cfg.Flags(fs)
+	assert.NoError(t, fs.Parse([]string{
+		"-schedule", "*/5 9-17 * * mon-fri", "-schedule", "0 0-8,18-23 * * *",
+		"-timezone", "Europe/London", "-quiet-hours", "22:00-07:00",
+	}))
+	assert.Equal(t, ScheduleConfig{
+		Crons:      []string{"*/5 9-17 * * mon-fri", "0 0-8,18-23 * * *"},
+		TimeZone:   "Europe/London",
+		QuietHours: []string{"22:00-07:00"},
+	}, cfg.Schedule)
+	assert.Equal(t, "*/5 9-17 * * mon-fri; 0 0-8,18-23 * * *", fs.Lookup("schedule").Value.String())
+	assert.NoError(t, cfg.Schedule.validate())
+}
+
+func TestHeaders(t *testing.T) {
+	h := headers(http.Header{})
+	assert.NoError(t, h.Set("X-Api-Key: abc:def"))
+	assert.Equal(t, "abc:def", http.Header(h).Get("X-Api-Key"))
+	assert.Equal(t, "X-Api-Key: abc:def", h.String())
+	assert.Error(t, h.Set("no separator"))
+	assert.Error(t, h.Set(": value"))
+}
+
+func TestSinks(t *testing.T) {
+	s := sinks{}
+	assert.NoError(t, s.Set("critical=https://hooks.example.com/critical"))
+	assert.NoError(t, s.Set("escalation=log"))
+	assert.Equal(t, sinks{"critical": "https://hooks.example.com/critical", "escalation": "log"}, s)
+	assert.Contains(t, s.String(), "escalation=log")
+	assert.Error(t, s.Set("critical"))
+	assert.Error(t, s.Set("fatal=log"))
+	assert.Error(t, s.Set("warning=smtp://mail"))
 }
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/dmitry-vovk/csv-chg-go/diff"
+	"github.com/dmitry-vovk/csv-chg-go/ident"
+)
+
+// DiffConfig holds settings of `diff` subcommand
+type DiffConfig struct {
+	Old      string
+	New      string
+	IDFormat string
+	MaxLine  int
+	Output   string
+	Sorted   bool // Both inputs are sorted, compare them without loading into memory
+	Input    InputConfig
+}
+
+// Validate checks settings consistency
+func (c DiffConfig) Validate() error {
+	if c.Old == "" || c.New == "" {
+		return errors.New("two inputs should be specified")
+	}
+	if c.Old == "--" && c.New == "--" {
+		return errors.New("only one input can be read from stdin")
+	}
+	if _, err := ident.New(c.IDFormat); err != nil {
+		return err
+	}
+	if c.MaxLine < minMaxLine {
+		return fmt.Errorf("max line length should be at least %d", minMaxLine)
+	}
+	if _, err := diff.NewWriter(c.Output, nil); err != nil {
+		return err
+	}
+	return c.Input.validate()
+}
+
+// Flags registers `diff` settings flags in `fs`
+func (c *DiffConfig) Flags(fs *flag.FlagSet) {
+	fs.StringVar(&c.IDFormat, "id-format", ident.FormatUUID, "Item ID format: uuid, uuid-any, ulid or sku")
+	fs.IntVar(&c.MaxLine, "max-line-length", 4096, "Input lines longer than that are skipped")
+	fs.StringVar(&c.Output, "output", diff.OutputText, "Output format: text, csv or json")
+	fs.BoolVar(&c.Sorted, "sorted", false, "Inputs are sorted by ID, compare them as streams without loading into memory")
+	inputFlags(fs, &c.Input)
+}
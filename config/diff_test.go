@@ -0,0 +1,64 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffConfigValidate(t *testing.T) {
+	testCases := []struct {
+		config DiffConfig
+		err    error
+	}{
+		{
+			config: DiffConfig{Old: "old.csv"},
+			err:    errors.New("two inputs should be specified"),
+		},
+		{
+			config: DiffConfig{Old: "--", New: "--"},
+			err:    errors.New("only one input can be read from stdin"),
+		},
+		{
+			config: DiffConfig{Old: "old.csv", New: "new.csv", IDFormat: "guid"},
+			err:    errors.New("ID format should be one of uuid, uuid-any, ulid or sku"),
+		},
+		{
+			config: DiffConfig{Old: "old.csv", New: "new.csv", IDFormat: "uuid", MaxLine: 35},
+			err:    errors.New("max line length should be at least 36"),
+		},
+		{
+			config: DiffConfig{Old: "old.csv", New: "new.csv", IDFormat: "uuid", MaxLine: 36, Output: "xml"},
+			err:    errors.New("output should be one of text, csv or json"),
+		},
+		{
+			config: DiffConfig{Old: "old.csv", New: "new.csv", IDFormat: "uuid", MaxLine: 36, Output: "json"},
+		},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.err, tc.config.Validate())
+	}
+}
+
+func TestDiffFlags(t *testing.T) {
+	var cfg DiffConfig
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	cfg.Flags(fs)
+	assert.NoError(t, fs.Parse([]string{"-output", "csv", "-sorted"}))
+	assert.Equal(t, DiffConfig{
+		IDFormat: "uuid",
+		MaxLine:  4096,
+		Output:   "csv",
+		Sorted:   true,
+		Input: InputConfig{
+			Headers:      http.Header{},
+			Timeout:      5 * time.Minute,
+			Retries:      3,
+			MaxRedirects: 10,
+		},
+	}, cfg)
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// secretFlags have their values hidden by Print
+var secretFlags = map[string]bool{
+	"input-token": true,
+}
+
+// Print writes effective values of all flags in `fs` to `w`, one per line, hiding secrets
+func Print(w io.Writer, fs *flag.FlagSet) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil {
+			return
+		}
+		value := f.Value.String()
+		switch v := f.Value.(type) {
+		case headers:
+			// Header values often carry credentials, only names are shown
+			var names []string
+			for name := range v {
+				names = append(names, name+": <hidden>")
+			}
+			sort.Strings(names)
+			value = strings.Join(names, "; ")
+		case sinks:
+			// Webhook path and query often carry tokens, only the host is shown
+			var list []string
+			for severity, spec := range v {
+				list = append(list, severity+"="+redactURL(spec, true))
+			}
+			sort.Strings(list)
+			value = strings.Join(list, ", ")
+		default:
+			if secretFlags[f.Name] && value != "" {
+				value = "<hidden>"
+			} else {
+				value = redactURL(value, false)
+			}
+		}
+		_, err = fmt.Fprintf(w, "%-20s %s\n", f.Name, value)
+	})
+	return err
+}
+
+// redactURL hides credentials and query of `s` if it is an absolute URL, and its path if `path` is set.
+// Other values are returned as is.
+func redactURL(s string, path bool) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return s
+	}
+	value := u.Scheme + "://"
+	if u.User != nil {
+		value += "<hidden>@"
+	}
+	value += u.Host
+	if path && strings.Trim(u.Path, "/") != "" {
+		value += "/<hidden>"
+	} else {
+		value += u.EscapedPath()
+	}
+	if u.RawQuery != "" {
+		value += "?<hidden>"
+	}
+	return value
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/dmitry-vovk/csv-chg-go/ident"
+)
+
+// ValidateConfig holds settings of `validate` subcommand
+type ValidateConfig struct {
+	Source   string
+	IDFormat string
+	MaxLine  int
+	Clean    string // File to write valid unique normalized IDs to
+	Rejects  string // File to write rejected lines to
+	Input    InputConfig
+}
+
+// Validate checks settings consistency
+func (c ValidateConfig) Validate() error {
+	if c.Source == "" {
+		return errors.New("no input specified")
+	}
+	if _, err := ident.New(c.IDFormat); err != nil {
+		return err
+	}
+	if c.MaxLine < minMaxLine {
+		return fmt.Errorf("max line length should be at least %d", minMaxLine)
+	}
+	if c.Clean != "" && c.Clean == c.Rejects {
+		return errors.New("clean and rejects outputs should be different files")
+	}
+	return c.Input.validate()
+}
+
+// Flags registers `validate` settings flags in `fs`
+func (c *ValidateConfig) Flags(fs *flag.FlagSet) {
+	fs.StringVar(&c.IDFormat, "id-format", ident.FormatUUID, "Item ID format: uuid, uuid-any, ulid or sku")
+	fs.IntVar(&c.MaxLine, "max-line-length", 4096, "Input lines longer than that are rejected")
+	fs.StringVar(&c.Clean, "clean", "", "File to write valid unique normalized IDs to")
+	fs.StringVar(&c.Rejects, "rejects", "", "CSV file to write rejected lines to, with reasons")
+	inputFlags(fs, &c.Input)
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateConfigValidate(t *testing.T) {
+	testCases := []struct {
+		config ValidateConfig
+		err    error
+	}{
+		{
+			config: ValidateConfig{},
+			err:    errors.New("no input specified"),
+		},
+		{
+			config: ValidateConfig{Source: "file.csv", IDFormat: "guid"},
+			err:    errors.New("ID format should be one of uuid, uuid-any, ulid or sku"),
+		},
+		{
+			config: ValidateConfig{Source: "file.csv", IDFormat: "uuid", MaxLine: 35},
+			err:    errors.New("max line length should be at least 36"),
+		},
+		{
+			config: ValidateConfig{Source: "file.csv", IDFormat: "uuid", MaxLine: 36, Clean: "out.csv", Rejects: "out.csv"},
+			err:    errors.New("clean and rejects outputs should be different files"),
+		},
+		{
+			config: ValidateConfig{Source: "file.csv", IDFormat: "uuid", MaxLine: 36, Input: InputConfig{Retries: -1}},
+			err:    errors.New("input retries should not be negative"),
+		},
+		{
+			config: ValidateConfig{Source: "file.csv", IDFormat: "uuid", MaxLine: 36, Clean: "clean.csv", Rejects: "rejects.csv"},
+		},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.err, tc.config.Validate())
+	}
+}
+
+func TestValidateFlags(t *testing.T) {
+	var cfg ValidateConfig
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	cfg.Flags(fs)
+	assert.NoError(t, fs.Parse([]string{
+		"-id-format", "sku",
+		"-rejects", "rejects.csv",
+		"-input-header", "X-Api-Key: abc",
+	}))
+	assert.Equal(t, ValidateConfig{
+		IDFormat: "sku",
+		MaxLine:  4096,
+		Rejects:  "rejects.csv",
+		Input: InputConfig{
+			Headers:      http.Header{"X-Api-Key": {"abc"}},
+			Timeout:      5 * time.Minute,
+			Retries:      3,
+			MaxRedirects: 10,
+		},
+	}, cfg)
+}
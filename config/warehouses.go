@@ -0,0 +1,167 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Warehouse overrides `run` settings for one of the warehouses served by the process.
+// Fields left out keep the values set by flags.
+type Warehouse struct {
+	Name      string   `json:"name"`                // Label of the warehouse in logs and metrics
+	APIURL    string   `json:"api,omitempty"`       // Base API URL
+	CSVFile   string   `json:"input,omitempty"`     // Input source
+	Threshold int      `json:"threshold,omitempty"` // Quantity below which alert is raised
+	Interval  Duration `json:"interval,omitempty"`  // Interval between checks
+	Workers   int      `json:"workers,omitempty"`   // Number of parallel API requests
+	RulesFile string   `json:"rules,omitempty"`     // Alert rules file
+	History   string   `json:"history,omitempty"`   // File to record observed quantities to
+
+	InputToken   string            `json:"input_token,omitempty"`   // Bearer token for remote input
+	InputHeaders map[string]string `json:"input_headers,omitempty"` // Extra headers for remote input
+}
+
+// Duration is time.Duration read from JSON string like "1m30s"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return errors.New("duration should be a string like \"1m30s\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// warehousesFile is the format of warehouses file
+type warehousesFile struct {
+	Warehouses []Warehouse `json:"warehouses"`
+}
+
+// LoadWarehouses reads warehouses from JSON file `path`
+func LoadWarehouses(path string) ([]Warehouse, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	var file warehousesFile
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("warehouses file %s: %s", path, err)
+	}
+	if len(file.Warehouses) == 0 {
+		return nil, fmt.Errorf("warehouses file %s declares no warehouses", path)
+	}
+	names := make(map[string]bool, len(file.Warehouses))
+	for _, wh := range file.Warehouses {
+		if wh.Name == "" {
+			return nil, fmt.Errorf("warehouses file %s: warehouse name is empty", path)
+		}
+		if names[wh.Name] {
+			return nil, fmt.Errorf("warehouses file %s: duplicate warehouse %q", path, wh.Name)
+		}
+		names[wh.Name] = true
+	}
+	return file.Warehouses, nil
+}
+
+// Warehouses returns settings of every warehouse declared in warehouses file,
+// or the settings alone if no warehouses file is set
+func (c Config) Warehouses() ([]Config, error) {
+	if c.WarehousesFile == "" {
+		return []Config{c}, nil
+	}
+	list, err := LoadWarehouses(c.WarehousesFile)
+	if err != nil {
+		return nil, err
+	}
+	configs := make([]Config, 0, len(list))
+	for _, wh := range list {
+		configs = append(configs, c.forWarehouse(wh))
+	}
+	return configs, nil
+}
+
+// forWarehouse returns settings with values set for `wh` replacing the ones set by flags.
+// Input credentials set by flags are not passed to a warehouse having its own input.
+func (c Config) forWarehouse(wh Warehouse) Config {
+	c.WarehousesFile = ""
+	c.Warehouse = wh.Name
+	if wh.APIURL != "" {
+		c.APIURL = wh.APIURL
+	}
+	if wh.CSVFile != "" {
+		c.CSVFile = wh.CSVFile
+		c.Input.Token = ""
+		c.Input.Headers = make(http.Header)
+	}
+	if wh.InputToken != "" {
+		c.Input.Token = wh.InputToken
+	}
+	if len(wh.InputHeaders) > 0 {
+		h := c.Input.Headers.Clone()
+		if h == nil {
+			h = make(http.Header)
+		}
+		for k, v := range wh.InputHeaders {
+			h.Set(k, v)
+		}
+		c.Input.Headers = h
+	}
+	if wh.Threshold != 0 {
+		c.Threshold = wh.Threshold
+	}
+	if wh.Interval != 0 {
+		c.Interval = time.Duration(wh.Interval)
+	}
+	if wh.Workers != 0 {
+		c.Workers = wh.Workers
+	}
+	if wh.RulesFile != "" {
+		c.RulesFile = wh.RulesFile
+	}
+	if wh.History != "" {
+		c.History.File = wh.History
+	}
+	return c
+}
+
+// validateWarehouses checks settings of every warehouse and resources they can't share
+func (c Config) validateWarehouses() error {
+	configs, err := c.Warehouses()
+	if err != nil {
+		return err
+	}
+	histories := make(map[string]string)
+	stdin := ""
+	for _, wc := range configs {
+		if err = wc.validate(); err != nil {
+			return fmt.Errorf("warehouse %q: %s", wc.Warehouse, err)
+		}
+		if other, ok := histories[wc.History.File]; ok && wc.History.File != "" {
+			return fmt.Errorf("warehouses %q and %q should have different history files", other, wc.Warehouse)
+		}
+		histories[wc.History.File] = wc.Warehouse
+		if wc.CSVFile == "--" {
+			if stdin != "" {
+				return fmt.Errorf("warehouses %q and %q can't both read stdin", stdin, wc.Warehouse)
+			}
+			stdin = wc.Warehouse
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeWarehouses writes warehouses file with `content` to a temporary directory
+func writeWarehouses(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "warehouses")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	path := filepath.Join(dir, "warehouses.json")
+	if err = ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestWarehouses(t *testing.T) {
+	path := writeWarehouses(t, `{"warehouses": [
+		{"name": "london", "api": "http://london.example.com", "input": "london.csv", "interval": "5m", "workers": 4},
+		{"name": "paris", "api": "http://paris.example.com", "input": "paris.csv", "threshold": 10, "history": "paris.history"}
+	]}`)
+	var cfg Config
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	cfg.Flags(fs)
+	assert.NoError(t, fs.Parse([]string{"-warehouses", path, "-rules", "rules.txt"}))
+	assert.NoError(t, cfg.Validate())
+	configs, err := cfg.Warehouses()
+	if assert.NoError(t, err) && assert.Len(t, configs, 2) {
+		london, paris := configs[0], configs[1]
+		assert.Equal(t, "london", london.Warehouse)
+		assert.Equal(t, "http://london.example.com", london.APIURL)
+		assert.Equal(t, "london.csv", london.CSVFile)
+		assert.Equal(t, 5*time.Minute, london.Interval)
+		assert.Equal(t, 4, london.Workers)
+		assert.Equal(t, 5, london.Threshold)
+		assert.Equal(t, "rules.txt", london.RulesFile)
+		assert.Empty(t, london.WarehousesFile)
+		assert.Equal(t, "paris", paris.Warehouse)
+		assert.Equal(t, 60*time.Second, paris.Interval)
+		assert.Equal(t, 1, paris.Workers)
+		assert.Equal(t, 10, paris.Threshold)
+		assert.Equal(t, "paris.history", paris.History.File)
+		assert.Equal(t, "rules.txt", paris.RulesFile)
+	}
+	cfg.WarehousesFile = ""
+	configs, err = cfg.Warehouses()
+	if assert.NoError(t, err) {
+		assert.Equal(t, []Config{cfg}, configs)
+	}
+}
+
+func TestWarehousesInputAuth(t *testing.T) {
+	path := writeWarehouses(t, `{"warehouses": [
+		{"name": "london", "api": "http://london.example.com"},
+		{"name": "paris", "input": "https://paris.example.com/items.csv"},
+		{"name": "rome", "input": "https://rome.example.com/items.csv", "input_token": "rome-token", "input_headers": {"x-tenant": "rome"}},
+		{"name": "berlin", "input_headers": {"X-Tenant": "berlin"}}
+	]}`)
+	var cfg Config
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	cfg.Flags(fs)
+	assert.NoError(t, fs.Parse([]string{
+		"-warehouses", path, "-api", "http://example.com", "-input", "https://files.example.com/items.csv",
+		"-input-token", "secret", "-input-header", "X-Tenant: main", "-input-header", "X-Client: csvchg",
+	}))
+	configs, err := cfg.Warehouses()
+	if assert.NoError(t, err) && assert.Len(t, configs, 4) {
+		london, paris, rome, berlin := configs[0], configs[1], configs[2], configs[3]
+		// Flags input and its credentials are inherited together
+		assert.Equal(t, "https://files.example.com/items.csv", london.CSVFile)
+		assert.Equal(t, "secret", london.Input.Token)
+		assert.Equal(t, http.Header{"X-Tenant": {"main"}, "X-Client": {"csvchg"}}, london.Input.Headers)
+		// Own input doesn't get credentials of the flags input
+		assert.Empty(t, paris.Input.Token)
+		assert.Empty(t, paris.Input.Headers)
+		assert.Equal(t, "rome-token", rome.Input.Token)
+		assert.Equal(t, http.Header{"X-Tenant": {"rome"}}, rome.Input.Headers)
+		// Headers of the warehouse replace flags ones of the same name
+		assert.Equal(t, "secret", berlin.Input.Token)
+		assert.Equal(t, http.Header{"X-Tenant": {"berlin"}, "X-Client": {"csvchg"}}, berlin.Input.Headers)
+	}
+	assert.Equal(t, http.Header{"X-Tenant": {"main"}, "X-Client": {"csvchg"}}, cfg.Input.Headers)
+}
+
+func TestWarehousesValidate(t *testing.T) {
+	testCases := []struct {
+		content string
+		err     string
+	}{
+		{
+			content: `{"warehouses": []}`,
+			err:     "declares no warehouses",
+		},
+		{
+			content: `{"warehouses": [{"api": "http://a.example.com", "input": "a.csv"}]}`,
+			err:     "warehouse name is empty",
+		},
+		{
+			content: `{"warehouses": [{"name": "a", "input": "a.csv"}, {"name": "a", "input": "b.csv"}]}`,
+			err:     `duplicate warehouse "a"`,
+		},
+		{
+			content: `{"warehouses": [{"name": "a", "inputs": "a.csv"}]}`,
+			err:     `json: unknown field "inputs"`,
+		},
+		{
+			content: `{"warehouses": [{"name": "a", "input": "a.csv", "interval": 60}]}`,
+			err:     `duration should be a string like "1m30s"`,
+		},
+		{
+			content: `{"warehouses": [{"name": "a", "input": "a.csv", "interval": "soon"}]}`,
+			err:     `time: invalid duration`,
+		},
+		{
+			content: `{"warehouses": [{"name": "a", "api": "http://a.example.com"}]}`,
+			err:     `warehouse "a": no input specified`,
+		},
+		{
+			content: `{"warehouses": [{"name": "a", "input": "a.csv", "history": "h"}, {"name": "b", "input": "b.csv", "history": "h"}]}`,
+			err:     `warehouses "a" and "b" should have different history files`,
+		},
+		{
+			content: `{"warehouses": [{"name": "a", "input": "--"}, {"name": "b", "input": "--"}]}`,
+			err:     `warehouses "a" and "b" can't both read stdin`,
+		},
+		{
+			content: `{"warehouses": [{"name": "a", "input": "a.csv"}, {"name": "b", "input": "b.csv", "api": "http://b.example.com"}]}`,
+		},
+	}
+	for _, tc := range testCases {
+		var cfg Config
+		fs := flag.NewFlagSet("run", flag.ContinueOnError)
+		cfg.Flags(fs)
+		assert.NoError(t, fs.Parse([]string{"-warehouses", writeWarehouses(t, tc.content), "-api", "http://example.com"}))
+		if err := cfg.Validate(); tc.err == "" {
+			assert.NoError(t, err, tc.content)
+		} else if assert.Error(t, err, tc.content) {
+			assert.Contains(t, err.Error(), tc.err)
+		}
+	}
+	cfg := Config{WarehousesFile: "/nonexistent/warehouses.json"}
+	assert.True(t, errors.Is(cfg.Validate(), os.ErrNotExist))
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/dmitry-vovk/csv-chg-go/cli"
+	"github.com/dmitry-vovk/csv-chg-go/config"
+	"github.com/dmitry-vovk/csv-chg-go/diff"
+	"github.com/dmitry-vovk/csv-chg-go/ident"
+)
+
+// diffCommand prints IDs added to and removed from the old input,
+// fails with findings exit code if inputs differ
+func diffCommand(cfg config.DiffConfig, args []string) error {
+	if len(args) != 2 {
+		return cli.Usage(errors.New("two inputs should be specified"))
+	}
+	cfg.Old, cfg.New = args[0], args[1]
+	if err := cfg.Validate(); err != nil {
+		return cli.Usage(err)
+	}
+	format, _ := ident.New(cfg.IDFormat)
+	out, _ := diff.NewWriter(cfg.Output, os.Stdout)
+	d := diff.New(format, out).WithMaxLineLength(cfg.MaxLine)
+	src := newSource(cfg.Input)
+	var err error
+	if cfg.Sorted {
+		err = src.ReadAny(cfg.Old, func(from io.Reader) error {
+			return src.ReadAny(cfg.New, func(to io.Reader) error {
+				return d.Merge(from, to)
+			})
+		})
+	} else if err = src.ReadAny(cfg.Old, d.Load); err == nil {
+		err = src.ReadAny(cfg.New, d.Compare)
+	}
+	if err != nil {
+		return fmt.Errorf("comparing inputs: %s", err)
+	}
+	s := d.Summary()
+	log.Printf("%d added, %d removed, %d unchanged, %d invalid lines skipped", s.Added, s.Removed, s.Unchanged, s.Invalid)
+	if s.Added > 0 || s.Removed > 0 {
+		return cli.ExitCode(cli.ExitFindings)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+// Package diff compares two input lists of item identifiers
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/dmitry-vovk/csv-chg-go/ident"
+)
+
+// Summary counts differences between inputs
+type Summary struct {
+	Added     int // IDs present only in the new input
+	Removed   int // IDs present only in the old input
+	Unchanged int // IDs present in both inputs
+	Invalid   int // Lines of either input skipped as invalid or too long
+}
+
+// Differ finds added and removed IDs
+type Differ struct {
+	format  ident.Format
+	maxLine int
+	out     Writer
+	old     map[string]bool // Binary keys of the old input, true once seen in the new one
+	summary Summary
+}
+
+const defaultMaxLineLength = 4096
+
+// New returns Differ of IDs in `format`, writing changes to `out`
+func New(format ident.Format, out Writer) *Differ {
+	return &Differ{
+		format:  format,
+		maxLine: defaultMaxLineLength,
+		out:     out,
+		old:     make(map[string]bool),
+	}
+}
+
+// WithMaxLineLength sets the length above which lines are skipped
+func (d *Differ) WithMaxLineLength(n int) *Differ {
+	d.maxLine = n
+	return d
+}
+
+// Summary returns difference counters
+func (d *Differ) Summary() Summary {
+	return d.summary
+}
+
+// Load reads the old input into memory
+func (d *Differ) Load(r io.Reader) error {
+	s := d.scan(r)
+	for s.next() {
+		d.old[string(s.key)] = false
+	}
+	return s.err
+}
+
+// Compare streams the new input against the loaded old one, writing added IDs in input order,
+// then removed ones sorted, and closes the output
+func (d *Differ) Compare(r io.Reader) error {
+	added := make(map[string]struct{})
+	s := d.scan(r)
+	for s.next() {
+		if seen, ok := d.old[string(s.key)]; ok {
+			if !seen {
+				d.old[string(s.key)] = true
+				d.summary.Unchanged++
+			}
+			continue
+		}
+		if _, ok := added[string(s.key)]; ok {
+			continue
+		}
+		added[string(s.key)] = struct{}{}
+		d.summary.Added++
+		if err := d.out.Added(d.format.String(s.key)); err != nil {
+			return err
+		}
+	}
+	if s.err != nil {
+		return s.err
+	}
+	var removed []string
+	for id, seen := range d.old {
+		if !seen {
+			removed = append(removed, id)
+		}
+	}
+	sort.Strings(removed)
+	for _, id := range removed {
+		d.summary.Removed++
+		if err := d.out.Removed(d.format.String([]byte(id))); err != nil {
+			return err
+		}
+	}
+	return d.out.Close(d.summary)
+}
+
+// ErrNotSorted is returned by Merge for input not sorted in ascending order of IDs
+type ErrNotSorted struct {
+	input string
+	line  int
+}
+
+func (e ErrNotSorted) Error() string {
+	return fmt.Sprintf("%s input is not sorted at line %d", e.input, e.line)
+}
+
+// Merge compares old `from` and new `to` inputs sorted in ascending order of IDs without holding them in memory,
+// writing changes in order and closing the output. Repeated IDs are ignored.
+func (d *Differ) Merge(from, to io.Reader) error {
+	o, n := d.scan(from), d.scan(to)
+	o.name, n.name = "old", "new"
+	hasOld, hasNew := o.nextUnique(), n.nextUnique()
+	for hasOld || hasNew {
+		var err error
+		switch c := bytes.Compare(o.key, n.key); {
+		case hasOld && hasNew && c == 0:
+			d.summary.Unchanged++
+			hasOld, hasNew = o.nextUnique(), n.nextUnique()
+			continue
+		case hasOld && (!hasNew || c < 0):
+			d.summary.Removed++
+			err = d.out.Removed(d.format.String(o.key))
+			hasOld = o.nextUnique()
+		default:
+			d.summary.Added++
+			err = d.out.Added(d.format.String(n.key))
+			hasNew = n.nextUnique()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if o.err != nil {
+		return o.err
+	}
+	if n.err != nil {
+		return n.err
+	}
+	return d.out.Close(d.summary)
+}
+
+// scanner reads valid IDs line by line
+type scanner struct {
+	d    *Differ
+	name string // Input name for errors
+	r    *ident.LineReader
+	line int
+	key  []byte // Binary key of the current ID
+	prev []byte // Binary key of the previous ID, for sorted inputs
+	err  error
+}
+
+func (d *Differ) scan(r io.Reader) *scanner {
+	return &scanner{d: d, r: ident.NewLineReader(r, d.maxLine)}
+}
+
+// next advances to the next valid ID, returns false at the end of input or on error
+func (s *scanner) next() bool {
+	for s.err == nil {
+		b, tooLong, err := s.r.Next()
+		switch {
+		case tooLong:
+			s.line++
+			s.d.summary.Invalid++
+			continue
+		case len(b) > 0:
+			s.line++
+			// Own check intervals do not make a difference
+			id, _, ok := ident.SplitLine(bytes.TrimSpace(b))
+			if s.key, ok = s.d.format.Parse(s.key[:0], id); ok {
+				if err != nil && err != io.EOF {
+					s.err = err
+				}
+				return true
+			}
+			s.d.summary.Invalid++
+		}
+		if err != io.EOF {
+			s.err = err
+		} else {
+			break
+		}
+	}
+	return false
+}
+
+// nextUnique advances to the next ID different from the current one, checking the order
+func (s *scanner) nextUnique() bool {
+	s.prev = append(s.prev[:0], s.key...)
+	first := s.line == 0
+	for s.next() {
+		switch c := bytes.Compare(s.key, s.prev); {
+		case first || c > 0:
+			return true
+		case c < 0:
+			s.err = ErrNotSorted{input: s.name, line: s.line}
+			return false
+		}
+	}
+	return false
+}
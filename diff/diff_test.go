@@ -0,0 +1,106 @@
+package diff
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/dmitry-vovk/csv-chg-go/ident"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	oldInput = `00000000-0000-0000-0000-000000000001
+00000000-0000-0000-0000-000000000002
+00000000-0000-0000-0000-000000000002
+invalid
+00000000-0000-0000-0000-000000000004
+00000000-0000-0000-0000-000000000005
+`
+	newInput = `00000000-0000-0000-0000-000000000001
+00000000-0000-0000-0000-00000000000A
+00000000-0000-0000-0000-000000000003
+00000000-0000-0000-0000-000000000003
+00000000-0000-0000-0000-000000000004`
+)
+
+func TestCompare(t *testing.T) {
+	var out bytes.Buffer
+	w, _ := NewWriter(OutputText, &out)
+	d := New(ident.UUID{}, w)
+	assert.NoError(t, d.Load(strings.NewReader(oldInput)))
+	assert.NoError(t, d.Compare(strings.NewReader(newInput)))
+	assert.Equal(t, Summary{Added: 2, Removed: 2, Unchanged: 2, Invalid: 1}, d.Summary())
+	assert.Equal(t, `+ 00000000-0000-0000-0000-00000000000a
++ 00000000-0000-0000-0000-000000000003
+- 00000000-0000-0000-0000-000000000002
+- 00000000-0000-0000-0000-000000000005
+`, out.String())
+}
+
+func TestCompareIgnoresIntervals(t *testing.T) {
+	var out bytes.Buffer
+	w, _ := NewWriter(OutputText, &out)
+	d := New(ident.UUID{}, w)
+	assert.NoError(t, d.Load(strings.NewReader(oldInput)))
+	assert.NoError(t, d.Compare(strings.NewReader("00000000-0000-0000-0000-000000000001,1m\n00000000-0000-0000-0000-000000000002\n00000000-0000-0000-0000-000000000004, 24h\n00000000-0000-0000-0000-000000000005\n")))
+	assert.Equal(t, Summary{Unchanged: 4, Invalid: 1}, d.Summary())
+	assert.Empty(t, out.String())
+}
+
+func TestMerge(t *testing.T) {
+	sortedNew := `00000000-0000-0000-0000-000000000001
+00000000-0000-0000-0000-000000000003
+00000000-0000-0000-0000-000000000003
+too long line to be considered at all, exceeding the limit set below
+00000000-0000-0000-0000-000000000004
+00000000-0000-0000-0000-00000000000A`
+	var out bytes.Buffer
+	w, _ := NewWriter(OutputCSV, &out)
+	d := New(ident.UUID{}, w).WithMaxLineLength(40)
+	assert.NoError(t, d.Merge(strings.NewReader(oldInput), strings.NewReader(sortedNew)))
+	assert.Equal(t, Summary{Added: 2, Removed: 2, Unchanged: 2, Invalid: 2}, d.Summary())
+	assert.Equal(t, `change,id
+removed,00000000-0000-0000-0000-000000000002
+added,00000000-0000-0000-0000-000000000003
+removed,00000000-0000-0000-0000-000000000005
+added,00000000-0000-0000-0000-00000000000a
+`, out.String())
+}
+
+func TestMergeNotSorted(t *testing.T) {
+	w, _ := NewWriter(OutputText, &bytes.Buffer{})
+	d := New(ident.UUID{}, w)
+	err := d.Merge(strings.NewReader(oldInput), strings.NewReader(newInput))
+	assert.Equal(t, ErrNotSorted{input: "new", line: 3}, err)
+	assert.EqualError(t, err, "new input is not sorted at line 3")
+}
+
+func TestMergeEmpty(t *testing.T) {
+	var out bytes.Buffer
+	w, _ := NewWriter(OutputText, &out)
+	d := New(ident.SKU{}, w)
+	assert.NoError(t, d.Merge(strings.NewReader(""), strings.NewReader("A-1\nB-2\n")))
+	assert.Equal(t, "+ A-1\n+ B-2\n", out.String())
+}
+
+func TestJSONWriter(t *testing.T) {
+	var out bytes.Buffer
+	w, err := NewWriter(OutputJSON, &out)
+	if assert.NoError(t, err) {
+		assert.NoError(t, w.Added("a"))
+		assert.NoError(t, w.Removed("b"))
+		assert.NoError(t, w.Close(Summary{Added: 1, Removed: 1, Unchanged: 3}))
+		assert.Equal(t, `{"changes":[{"change":"added","id":"a"},{"change":"removed","id":"b"}],"added":1,"removed":1,"unchanged":3,"invalid":0}`+"\n", out.String())
+	}
+	out.Reset()
+	w, _ = NewWriter(OutputJSON, &out)
+	assert.NoError(t, w.Close(Summary{}))
+	assert.Equal(t, `{"changes":[],"added":0,"removed":0,"unchanged":0,"invalid":0}`+"\n", out.String())
+	out.Reset()
+	w, _ = NewWriter(OutputCSV, &out)
+	assert.NoError(t, w.Close(Summary{}))
+	assert.Equal(t, "change,id\n", out.String())
+	_, err = NewWriter("xml", &out)
+	assert.Equal(t, ErrUnknownOutput, err)
+}
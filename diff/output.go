@@ -0,0 +1,152 @@
+package diff
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// Writer receives changes
+type Writer interface {
+	Added(id string) error
+	Removed(id string) error
+	// Close is called after all changes with their summary
+	Close(s Summary) error
+}
+
+// Output formats
+const (
+	OutputText = "text"
+	OutputCSV  = "csv"
+	OutputJSON = "json"
+)
+
+// ErrUnknownOutput is returned for unsupported output format
+var ErrUnknownOutput = errors.New("output should be one of " + OutputText + ", " + OutputCSV + " or " + OutputJSON)
+
+// NewWriter returns Writer of `format` to `w`
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case OutputText:
+		return &textWriter{w: bufio.NewWriter(w)}, nil
+	case OutputCSV:
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	case OutputJSON:
+		return &jsonWriter{w: bufio.NewWriter(w)}, nil
+	}
+	return nil, ErrUnknownOutput
+}
+
+// textWriter writes changes as `+ id` and `- id` lines
+type textWriter struct {
+	w *bufio.Writer
+}
+
+func (t *textWriter) Added(id string) error {
+	_, err := t.w.WriteString("+ " + id + "\n")
+	return err
+}
+
+func (t *textWriter) Removed(id string) error {
+	_, err := t.w.WriteString("- " + id + "\n")
+	return err
+}
+
+func (t *textWriter) Close(Summary) error {
+	return t.w.Flush()
+}
+
+// csvWriter writes changes as `change,id` records with a header
+type csvWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+func (c *csvWriter) writeHeader() error {
+	if c.header {
+		return nil
+	}
+	c.header = true
+	return c.w.Write([]string{"change", "id"})
+}
+
+func (c *csvWriter) write(change, id string) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	return c.w.Write([]string{change, id})
+}
+
+func (c *csvWriter) Added(id string) error   { return c.write("added", id) }
+func (c *csvWriter) Removed(id string) error { return c.write("removed", id) }
+
+func (c *csvWriter) Close(Summary) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// jsonWriter streams changes as a single JSON object:
+// `{"changes":[{"change":"added","id":"..."},...],"added":1,"removed":0,"unchanged":2}`
+type jsonWriter struct {
+	w *bufio.Writer
+	n int // Number of changes written
+}
+
+type jsonChange struct {
+	Change string `json:"change"`
+	ID     string `json:"id"`
+}
+
+type jsonSummary struct {
+	Added     int `json:"added"`
+	Removed   int `json:"removed"`
+	Unchanged int `json:"unchanged"`
+	Invalid   int `json:"invalid"`
+}
+
+func (j *jsonWriter) write(change, id string) error {
+	prefix := ","
+	if j.n == 0 {
+		prefix = `{"changes":[`
+	}
+	j.n++
+	b, err := json.Marshal(jsonChange{Change: change, ID: id})
+	if err != nil {
+		return err
+	}
+	if _, err = j.w.WriteString(prefix); err != nil {
+		return err
+	}
+	_, err = j.w.Write(b)
+	return err
+}
+
+func (j *jsonWriter) Added(id string) error   { return j.write("added", id) }
+func (j *jsonWriter) Removed(id string) error { return j.write("removed", id) }
+
+func (j *jsonWriter) Close(s Summary) error {
+	prefix := "],"
+	if j.n == 0 {
+		prefix = `{"changes":[],`
+	}
+	b, err := json.Marshal(jsonSummary(s))
+	if err != nil {
+		return err
+	}
+	// Summary fields continue the object opened with changes
+	if _, err = j.w.WriteString(prefix); err != nil {
+		return err
+	}
+	if _, err = j.w.Write(b[1:]); err != nil {
+		return err
+	}
+	if err = j.w.WriteByte('\n'); err != nil {
+		return err
+	}
+	return j.w.Flush()
+}
@@ -0,0 +1,55 @@
+package history
+
+import (
+	"time"
+)
+
+const (
+	minPoints     = 3                         // Number of observations needed to estimate consumption rate
+	maxProjection = 10 * 365 * 24 * time.Hour // Stockouts further than that are not reported
+)
+
+// Predict estimates when the stock runs out by fitting a least squares line
+// through observations made since the last restock.
+// Returns false if there is not enough data or the stock is not being consumed.
+func Predict(obs []Observation) (time.Time, bool) {
+	// Only observations after the last quantity increase describe current consumption
+	start := 0
+	for i := 1; i < len(obs); i++ {
+		if obs[i].Quantity > obs[i-1].Quantity {
+			start = i
+		}
+	}
+	obs = obs[start:]
+	if len(obs) < minPoints {
+		return time.Time{}, false
+	}
+	last := obs[len(obs)-1]
+	if last.Quantity <= 0 {
+		return last.At, true
+	}
+	// Time is measured in seconds relative to the last observation to keep precision
+	var sumX, sumY, sumXY, sumXX float64
+	for _, o := range obs {
+		x := o.At.Sub(last.At).Seconds()
+		y := float64(o.Quantity)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	n := float64(len(obs))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return time.Time{}, false
+	}
+	slope := (n*sumXY - sumX*sumY) / denominator // Quantity change per second
+	if slope >= 0 {
+		return time.Time{}, false
+	}
+	left := float64(last.Quantity) / -slope * float64(time.Second)
+	if left > float64(maxProjection) {
+		return time.Time{}, false
+	}
+	return last.At.Add(time.Duration(left)), true
+}
@@ -0,0 +1,47 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPredict(t *testing.T) {
+	start := time.Date(2021, 2, 9, 0, 0, 0, 0, time.UTC)
+	series := func(quantities ...int) []Observation {
+		var obs []Observation
+		for i, q := range quantities {
+			obs = append(obs, Observation{Quantity: q, At: start.Add(time.Duration(i) * time.Hour)})
+		}
+		return obs
+	}
+	testCases := []struct {
+		name string
+		obs  []Observation
+		at   time.Time
+		ok   bool
+	}{
+		{name: "empty"},
+		{name: "too few", obs: series(10, 9)},
+		{name: "steady", obs: series(10, 10, 10)},
+		{name: "growing", obs: series(10, 11, 12)},
+		{name: "consumed", obs: series(30, 25, 20), at: start.Add(6 * time.Hour), ok: true},
+		{name: "restocked", obs: series(5, 2, 40, 30, 20), at: start.Add(6 * time.Hour), ok: true},
+		{name: "restocked recently", obs: series(5, 4, 3, 2, 40)},
+		{name: "out of stock", obs: series(2, 1, 0), at: start.Add(2 * time.Hour), ok: true},
+		{name: "same time", obs: []Observation{{Quantity: 3, At: start}, {Quantity: 2, At: start}, {Quantity: 1, At: start}}},
+		{name: "too slow", obs: []Observation{
+			{Quantity: 1000001, At: start.Add(-time.Second)},
+			{Quantity: 1000000, At: start.Add(-time.Second)},
+			{Quantity: 1000000, At: start.Add(100000 * time.Hour)},
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			at, ok := Predict(tc.obs)
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.at, at)
+		})
+	}
+}
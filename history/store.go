@@ -0,0 +1,106 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Observation is a single item quantity reading
+type Observation struct {
+	UUID     string    `json:"uuid"`
+	Quantity int       `json:"quantity"`
+	At       time.Time `json:"at"`
+}
+
+// Store appends observations to a JSON lines file
+// and keeps the recent ones in memory for stockout predictions
+type Store struct {
+	m      sync.Mutex
+	f      *os.File
+	window time.Duration            // How old observations are kept in memory
+	recent map[string][]Observation // Recent observations by UUID, oldest first
+}
+
+// maxRecent limits number of observations kept in memory per item
+const maxRecent = 64
+
+// Open loads recent observations from `path` and opens it for appending,
+// the file is created if it does not exist
+func Open(path string, window time.Duration) (*Store, error) {
+	s := &Store{
+		window: window,
+		recent: make(map[string][]Observation),
+	}
+	if err := s.load(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s.f = f
+	return s, nil
+}
+
+// load reads observations within the window from existing file, skipping malformed lines
+func (s *Store) load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	since := time.Now().Add(-s.window)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var o Observation
+		if json.Unmarshal(scanner.Bytes(), &o) != nil || o.At.Before(since) {
+			continue
+		}
+		s.remember(o)
+	}
+	return scanner.Err()
+}
+
+// remember adds `o` to in-memory observations, dropping outdated ones
+func (s *Store) remember(o Observation) {
+	obs := append(s.recent[o.UUID], o)
+	since := o.At.Add(-s.window)
+	i := 0
+	for i < len(obs)-1 && (obs[i].At.Before(since) || len(obs)-i > maxRecent) {
+		i++
+	}
+	s.recent[o.UUID] = obs[i:]
+}
+
+// Record appends observation to the file
+func (s *Store) Record(o Observation) error {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.remember(o)
+	_, err = s.f.Write(append(b, '\n'))
+	return err
+}
+
+// Recent returns a copy of in-memory observations of `uuid`, oldest first
+func (s *Store) Recent(uuid string) []Observation {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return append([]Observation(nil), s.recent[uuid]...)
+}
+
+// StockoutAt returns projected time when `uuid` runs out of stock
+func (s *Store) StockoutAt(uuid string) (time.Time, bool) {
+	return Predict(s.Recent(uuid))
+}
+
+// Close closes the underlying file
+func (s *Store) Close() error {
+	return s.f.Close()
+}
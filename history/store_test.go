@@ -0,0 +1,68 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		panic(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "history.jsonl")
+	uuid := "767d967f-b55b-4457-bfee-685eaa6d0583"
+	now := time.Now().UTC().Truncate(time.Second)
+	s, err := Open(path, time.Hour)
+	if !assert.NoError(t, err) {
+		return
+	}
+	// Outdated observation is dropped from memory once newer one arrives
+	assert.NoError(t, s.Record(Observation{UUID: uuid, Quantity: 30, At: now.Add(-2 * time.Hour)}))
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, s.Record(Observation{UUID: uuid, Quantity: 20 - i*5, At: now.Add(time.Duration(i-2) * time.Minute)}))
+	}
+	assert.Len(t, s.Recent(uuid), 3)
+	if at, ok := s.StockoutAt(uuid); assert.True(t, ok) {
+		assert.Equal(t, now.Add(2*time.Minute), at)
+	}
+	assert.NoError(t, s.Close())
+	// Garbage in the file is skipped on load
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		panic(err)
+	}
+	_, _ = f.WriteString("not json\n")
+	_ = f.Close()
+	// Reopen and check recent observations are restored
+	s, err = Open(path, time.Hour)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []Observation{
+			{UUID: uuid, Quantity: 20, At: now.Add(-2 * time.Minute)},
+			{UUID: uuid, Quantity: 15, At: now.Add(-1 * time.Minute)},
+			{UUID: uuid, Quantity: 10, At: now},
+		}, s.Recent(uuid))
+		assert.Empty(t, s.Recent("ee88ff32-f753-4a49-abf1-2885fdfcafba"))
+		assert.NoError(t, s.Close())
+	}
+	// Directory can't be opened as a file
+	_, err = Open(dir, time.Hour)
+	assert.Error(t, err)
+}
+
+func TestStoreLimit(t *testing.T) {
+	s := &Store{window: time.Hour, recent: make(map[string][]Observation)}
+	now := time.Now()
+	for i := 0; i < maxRecent*2; i++ {
+		s.remember(Observation{UUID: "a", Quantity: i, At: now.Add(time.Duration(i) * time.Second)})
+	}
+	if recent := s.Recent("a"); assert.Len(t, recent, maxRecent) {
+		assert.Equal(t, maxRecent*2-1, recent[maxRecent-1].Quantity)
+	}
+}
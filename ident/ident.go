@@ -0,0 +1,218 @@
+// Package ident parses item identifiers of supported formats into binary keys and back
+package ident
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+)
+
+// Format parses identifiers of one kind
+type Format interface {
+	// Parse validates identifier `b` and appends its binary key to `dst`
+	Parse(dst, b []byte) ([]byte, bool)
+	// String returns normalized identifier of binary key `id`, as sent to the API
+	String(id []byte) string
+	// Size returns binary key length, 0 if it varies
+	Size() int
+}
+
+// Format names
+const (
+	// FormatUUID is 36-char UUID, case-insensitive
+	FormatUUID = "uuid"
+	// FormatUUIDAny is UUID with or without dashes, in braces or with `urn:uuid:` prefix
+	FormatUUIDAny = "uuid-any"
+	// FormatULID is 26-char ULID, case-insensitive
+	FormatULID = "ulid"
+	// FormatSKU is up to 64 characters of letters, digits, `-`, `_` and `.`, starting with letter or digit
+	FormatSKU = "sku"
+)
+
+// ErrUnknownFormat is returned for unsupported format name
+var ErrUnknownFormat = errors.New("ID format should be one of " + FormatUUID + ", " + FormatUUIDAny + ", " + FormatULID + " or " + FormatSKU)
+
+// New returns format by its name
+func New(name string) (Format, error) {
+	switch name {
+	case FormatUUID:
+		return UUID{}, nil
+	case FormatUUIDAny:
+		return UUIDAny{}, nil
+	case FormatULID:
+		return ULID{}, nil
+	case FormatSKU:
+		return SKU{}, nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+// UUID accepts 36-char UUIDs only
+type UUID struct{}
+
+func (UUID) Parse(dst, b []byte) ([]byte, bool) {
+	if len(b) != 36 {
+		return dst, false
+	}
+	return appendUUID(dst, b)
+}
+
+func (UUID) String(id []byte) string { return formatUUID(id) }
+func (UUID) Size() int               { return 16 }
+
+// UUIDAny accepts UUIDs in all common notations, normalizing them to 36-char lower case form
+type UUIDAny struct{}
+
+var urnPrefix = []byte("urn:uuid:")
+
+func (UUIDAny) Parse(dst, b []byte) ([]byte, bool) {
+	switch {
+	case len(b) > len(urnPrefix) && equalFold(b[:len(urnPrefix)], urnPrefix):
+		b = b[len(urnPrefix):]
+	case len(b) > 2 && b[0] == '{' && b[len(b)-1] == '}':
+		b = b[1 : len(b)-1]
+	}
+	return appendUUID(dst, b)
+}
+
+func (UUIDAny) String(id []byte) string { return formatUUID(id) }
+func (UUIDAny) Size() int               { return 16 }
+
+// hexValues maps ASCII hex digits to their values, other bytes to 0xff
+var hexValues = func() (t [256]byte) {
+	for i := range t {
+		t[i] = 0xff
+	}
+	for i, c := range []byte("0123456789abcdef") {
+		t[c] = byte(i)
+	}
+	for i, c := range []byte("ABCDEF") {
+		t[c] = byte(i + 10)
+	}
+	return
+}()
+
+// appendUUID decodes 36-char dashed or 32-char plain UUID `b` and appends it to `dst`
+func appendUUID(dst, b []byte) ([]byte, bool) {
+	dashed := len(b) == 36
+	if dashed {
+		if b[8] != '-' || b[13] != '-' || b[18] != '-' || b[23] != '-' {
+			return dst, false
+		}
+	} else if len(b) != 32 {
+		return dst, false
+	}
+	var id [16]byte
+	j := 0
+	for i := 0; i < len(b); i += 2 {
+		if dashed && (i == 8 || i == 13 || i == 18 || i == 23) {
+			i++
+		}
+		hi, lo := hexValues[b[i]], hexValues[b[i+1]]
+		if hi|lo == 0xff {
+			return dst, false
+		}
+		id[j] = hi<<4 | lo
+		j++
+	}
+	return append(dst, id[:]...), true
+}
+
+// formatUUID returns standard 36-char representation of 16-byte UUID
+func formatUUID(id []byte) string {
+	buf := make([]byte, 36)
+	hex.Encode(buf[0:8], id[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], id[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], id[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], id[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], id[10:])
+	return string(buf)
+}
+
+// equalFold tells whether ASCII `a` equals lower case `lower` ignoring case
+func equalFold(a, lower []byte) bool {
+	for i, c := range a {
+		if c|0x20 != lower[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ULID accepts 26-char Crockford base32 ULIDs, normalizing them to upper case
+type ULID struct{}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// crockfordValues maps Crockford base32 digits of either case to their values, other bytes to 0xff
+var crockfordValues = func() (t [256]byte) {
+	for i := range t {
+		t[i] = 0xff
+	}
+	for i, c := range []byte(crockford) {
+		t[c] = byte(i)
+		t[c|0x20] = byte(i)
+	}
+	return
+}()
+
+func (ULID) Parse(dst, b []byte) ([]byte, bool) {
+	// 26 digits hold 130 bits, so the first one can't exceed 7
+	if len(b) != 26 || crockfordValues[b[0]] > 7 {
+		return dst, false
+	}
+	var hi, lo uint64
+	for _, c := range b {
+		v := crockfordValues[c]
+		if v == 0xff {
+			return dst, false
+		}
+		hi = hi<<5 | lo>>59
+		lo = lo<<5 | uint64(v)
+	}
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[:8], hi)
+	binary.BigEndian.PutUint64(id[8:], lo)
+	return append(dst, id[:]...), true
+}
+
+func (ULID) String(id []byte) string {
+	hi, lo := binary.BigEndian.Uint64(id[:8]), binary.BigEndian.Uint64(id[8:])
+	buf := make([]byte, 26)
+	for i := len(buf) - 1; i >= 0; i-- {
+		buf[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(buf)
+}
+
+func (ULID) Size() int { return 16 }
+
+// SKU accepts plain stock keeping unit codes as they are
+type SKU struct{}
+
+const maxSKULength = 64
+
+func (SKU) Parse(dst, b []byte) ([]byte, bool) {
+	if len(b) == 0 || len(b) > maxSKULength || !isAlnum(b[0]) {
+		return dst, false
+	}
+	for _, c := range b[1:] {
+		if !isAlnum(c) && c != '-' && c != '_' && c != '.' {
+			return dst, false
+		}
+	}
+	return append(dst, b...), true
+}
+
+func (SKU) String(id []byte) string { return string(id) }
+func (SKU) Size() int               { return 0 }
+
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
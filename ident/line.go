@@ -0,0 +1,63 @@
+package ident
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"time"
+)
+
+// MinInterval is the shortest per-item check interval accepted in input
+const MinInterval = time.Second
+
+// SplitLine splits trimmed input line into identifier and optional check interval column, e.g. `<id>,5m`.
+// Interval is 0 if the column is absent or empty, ok is false if it is malformed or shorter than MinInterval.
+func SplitLine(line []byte) (id []byte, interval time.Duration, ok bool) {
+	i := bytes.IndexByte(line, ',')
+	if i < 0 {
+		return line, 0, true
+	}
+	id, column := bytes.TrimSpace(line[:i]), bytes.TrimSpace(line[i+1:])
+	if len(column) == 0 {
+		return id, 0, true
+	}
+	interval, err := time.ParseDuration(string(column))
+	if err != nil || interval < MinInterval {
+		return id, 0, false
+	}
+	return id, interval, true
+}
+
+// LineReader reads input lines, skipping lines longer than a limit without reading them into memory
+type LineReader struct {
+	r    *bufio.Reader
+	long bool // Inside a line exceeding the limit
+}
+
+// NewLineReader returns LineReader of `r` treating lines longer than `maxLine` bytes as too long
+func NewLineReader(r io.Reader, maxLine int) *LineReader {
+	return &LineReader{r: bufio.NewReaderSize(r, maxLine+1)}
+}
+
+// Next returns the next line with its line break, valid until the next call, or tooLong for a line exceeding the limit.
+// The last line may come along with io.EOF or a read error, line is empty at the end of input.
+func (l *LineReader) Next() (line []byte, tooLong bool, err error) {
+	for {
+		line, err = l.r.ReadSlice('\n')
+		switch {
+		case err == bufio.ErrBufferFull:
+			if !l.long {
+				l.long = true
+				return nil, true, nil
+			}
+		case l.long:
+			// Tail of the long line
+			l.long = false
+			if err != nil {
+				return nil, false, err
+			}
+		default:
+			return line, false, err
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package ident
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitLine(t *testing.T) {
+	testCases := []struct {
+		line     string
+		id       string
+		interval time.Duration
+		ok       bool
+	}{
+		{"767d967f-b55b-4457-bfee-685eaa6d0583", "767d967f-b55b-4457-bfee-685eaa6d0583", 0, true},
+		{"767d967f-b55b-4457-bfee-685eaa6d0583,5m", "767d967f-b55b-4457-bfee-685eaa6d0583", 5 * time.Minute, true},
+		{"SKU-1 , 24h", "SKU-1", 24 * time.Hour, true},
+		{"SKU-1,", "SKU-1", 0, true},
+		{"SKU-1,soon", "SKU-1", 0, false},
+		{"SKU-1,500ms", "SKU-1", 0, false},
+		{"SKU-1,-1m", "SKU-1", 0, false},
+	}
+	for _, tc := range testCases {
+		id, interval, ok := SplitLine([]byte(tc.line))
+		assert.Equal(t, tc.id, string(id), tc.line)
+		assert.Equal(t, tc.interval, interval, tc.line)
+		assert.Equal(t, tc.ok, ok, tc.line)
+	}
+}
+
+func TestLineReader(t *testing.T) {
+	long := strings.Repeat("x", 40)
+	lr := NewLineReader(strings.NewReader("A-1\n"+long+"\n"+long+long+"\n\nA-2"), 36)
+	var lines []string
+	for {
+		line, tooLong, err := lr.Next()
+		if tooLong {
+			line = []byte("<too long>")
+		}
+		if len(line) > 0 {
+			lines = append(lines, string(line))
+		}
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			return
+		}
+	}
+	assert.Equal(t, []string{"A-1\n", "<too long>", "<too long>", "\n", "A-2"}, lines)
+	// Read error in the tail of a long line
+	lr = NewLineReader(io.MultiReader(strings.NewReader(long), errReader{}), 36)
+	_, tooLong, err := lr.Next()
+	assert.True(t, tooLong)
+	assert.NoError(t, err)
+	_, tooLong, err = lr.Next()
+	assert.False(t, tooLong)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) { return 0, io.ErrUnexpectedEOF }
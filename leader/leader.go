@@ -0,0 +1,145 @@
+package leader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Elector holds leadership for as long as it keeps exclusive advisory lock on a file.
+// Lock is released by OS when the process dies, so a standby takes over on its next attempt.
+type Elector struct {
+	path     string        // Lock file path
+	id       string        // Instance identifier written to the lock file
+	renew    time.Duration // Period of lease renewal for leader, or lock attempts for standby
+	f        *os.File      // Locked file, nil if not leader
+	leader   int32         // 1 if leader, accessed atomically
+	doneC    chan struct{} // Closed when requested to stop
+	stoppedC chan struct{} // Closed when stopped and lock released
+}
+
+// errLocked is returned by tryLock when the file is locked by another instance
+var errLocked = errors.New("file is locked by another instance")
+
+// lease is written to the lock file by the leader
+type lease struct {
+	ID        string    `json:"id"`
+	PID       int       `json:"pid"`
+	RenewedAt time.Time `json:"renewed_at"`
+}
+
+// New returns Elector competing for lock on `path`
+func New(path, id string, renew time.Duration) *Elector {
+	return &Elector{
+		path:     path,
+		id:       id,
+		renew:    renew,
+		doneC:    make(chan struct{}),
+		stoppedC: make(chan struct{}),
+	}
+}
+
+// IsLeader tells whether this instance currently holds the lock
+func (e *Elector) IsLeader() bool {
+	return atomic.LoadInt32(&e.leader) == 1
+}
+
+// Run tries to acquire leadership and renews the lease until stopped
+func (e *Elector) Run() {
+	t := time.NewTicker(e.renew)
+	defer t.Stop()
+	for {
+		if e.IsLeader() {
+			e.renewLease()
+		} else if err := e.Acquire(); err != nil {
+			log.Printf("Error acquiring leadership: %s", err)
+		}
+		select {
+		case <-e.doneC:
+			e.release()
+			close(e.stoppedC)
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Stop releases leadership and blocks until Run exits
+func (e *Elector) Stop() {
+	close(e.doneC)
+	<-e.stoppedC
+}
+
+// Acquire makes one attempt to take leadership without blocking, it is called by Run and can be called before it
+// to fail at startup. The lock being held by another instance is not an error.
+func (e *Elector) Acquire() error {
+	if e.IsLeader() {
+		return nil
+	}
+	f, err := os.OpenFile(e.path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	if err = tryLock(f); err != nil {
+		_ = f.Close()
+		if err == errLocked {
+			return nil
+		}
+		return fmt.Errorf("locking %s: %s", e.path, err)
+	}
+	e.f = f
+	if err = e.writeLease(); err != nil {
+		e.release()
+		return fmt.Errorf("writing lease: %s", err)
+	}
+	atomic.StoreInt32(&e.leader, 1)
+	log.Printf("Acquired leadership, lock file %s", e.path)
+	return nil
+}
+
+// renewLease refreshes lease timestamp,
+// leadership is given up if the lock file has been removed or replaced
+func (e *Elector) renewLease() {
+	locked, err := e.f.Stat()
+	if err == nil {
+		var current os.FileInfo
+		if current, err = os.Stat(e.path); err == nil && !os.SameFile(locked, current) {
+			err = os.ErrNotExist
+		}
+	}
+	if err == nil {
+		err = e.writeLease()
+	}
+	if err != nil {
+		log.Printf("Lost leadership: %s", err)
+		e.release()
+	}
+}
+
+func (e *Elector) writeLease() error {
+	b, err := json.Marshal(lease{ID: e.id, PID: os.Getpid(), RenewedAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	// Overwrite in place first, so readers never see an empty file
+	b = append(b, '\n')
+	if _, err = e.f.WriteAt(b, 0); err != nil {
+		return err
+	}
+	return e.f.Truncate(int64(len(b)))
+}
+
+// release unlocks and closes the file
+func (e *Elector) release() {
+	atomic.StoreInt32(&e.leader, 0)
+	if e.f == nil {
+		return
+	}
+	_ = unlock(e.f)
+	_ = e.f.Close()
+	e.f = nil
+}
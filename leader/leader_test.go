@@ -0,0 +1,106 @@
+package leader
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const renew = 10 * time.Millisecond
+
+func TestElector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "leader")
+	if err != nil {
+		panic(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "worker.lock")
+	first := New(path, "first", renew)
+	go first.Run()
+	assert.Eventually(t, first.IsLeader, time.Second, renew)
+	second := New(path, "second", renew)
+	go second.Run()
+	// Standby stays standby while leader renews the lease
+	time.Sleep(5 * renew)
+	assert.False(t, second.IsLeader())
+	assert.Equal(t, "first", readLease(t, path).ID)
+	// Leader goes away, standby takes over
+	first.Stop()
+	assert.False(t, first.IsLeader())
+	assert.Eventually(t, second.IsLeader, time.Second, renew)
+	assert.Equal(t, "second", readLease(t, path).ID)
+	second.Stop()
+}
+
+func TestElectorLockRemoved(t *testing.T) {
+	dir, err := ioutil.TempDir("", "leader")
+	if err != nil {
+		panic(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "worker.lock")
+	e := New(path, "first", renew)
+	go e.Run()
+	defer e.Stop()
+	assert.Eventually(t, e.IsLeader, time.Second, renew)
+	lease := readLease(t, path)
+	// Removed lock file is recreated and locked again
+	assert.NoError(t, os.Remove(path))
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(path)
+		return err == nil && e.IsLeader()
+	}, time.Second, renew)
+	assert.True(t, readLease(t, path).RenewedAt.After(lease.RenewedAt))
+}
+
+func TestElectorBadPath(t *testing.T) {
+	e := New(filepath.Join("non-existing", "dir", "worker.lock"), "first", renew)
+	go e.Run()
+	time.Sleep(3 * renew)
+	assert.False(t, e.IsLeader())
+	e.Stop()
+}
+
+func TestAcquire(t *testing.T) {
+	dir, err := ioutil.TempDir("", "leader")
+	if err != nil {
+		panic(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "worker.lock")
+	first, second := New(path, "first", renew), New(path, "second", renew)
+	assert.NoError(t, first.Acquire())
+	assert.True(t, first.IsLeader())
+	assert.NoError(t, second.Acquire(), "lock held by another instance is not an error")
+	assert.False(t, second.IsLeader())
+	first.release()
+	assert.NoError(t, second.Acquire())
+	assert.True(t, second.IsLeader())
+	second.release()
+	assert.Error(t, New(filepath.Join(dir, "missing", "worker.lock"), "first", renew).Acquire())
+	// Lock errors other than contention are reported
+	f, err := os.Create(filepath.Join(dir, "closed.lock"))
+	if err != nil {
+		panic(err)
+	}
+	_ = f.Close()
+	err = tryLock(f)
+	assert.Error(t, err)
+	assert.NotEqual(t, errLocked, err)
+}
+
+func readLease(t *testing.T, path string) lease {
+	var l lease
+	f, err := os.Open(path)
+	if assert.NoError(t, err) {
+		defer func() { _ = f.Close() }()
+		// Decoder tolerates a longer previous lease tail not yet truncated
+		assert.NoError(t, json.NewDecoder(f).Decode(&l))
+	}
+	return l
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+// +build !windows
+
+package leader
+
+import (
+	"os"
+	"syscall"
+)
+
+// tryLock places exclusive advisory lock on `f`, fails immediately with errLocked if it is held by someone else
+func tryLock(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return errLocked
+	}
+	return err
+}
+
+func unlock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,44 @@
+//go:build windows
+// +build windows
+
+package leader
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+// LockFileEx flags and the error returned for a region locked by another process
+const (
+	lockfileFailImmediately               = 0x1
+	lockfileExclusiveLock                 = 0x2
+	errorLockViolation      syscall.Errno = 33
+)
+
+// tryLock places exclusive lock on the first byte of `f`, fails immediately with errLocked if it is held by someone else
+func tryLock(f *os.File) error {
+	var ol syscall.Overlapped
+	r, _, err := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock|lockfileFailImmediately, 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r != 0 {
+		return nil
+	}
+	if err == errorLockViolation {
+		return errLocked
+	}
+	return err
+}
+
+func unlock(f *os.File) error {
+	var ol syscall.Overlapped
+	if r, _, err := procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(&ol))); r == 0 {
+		return err
+	}
+	return nil
+}
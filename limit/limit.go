@@ -0,0 +1,124 @@
+// Package limit bounds the number of concurrent API requests, fixed or adapting to API latency and overload
+package limit
+
+import (
+	"sync"
+	"time"
+)
+
+// Fixed allows a constant number of concurrent requests
+type Fixed chan struct{}
+
+// NewFixed returns Fixed limiter allowing `n` concurrent requests
+func NewFixed(n int) Fixed {
+	return make(Fixed, n)
+}
+
+// Acquire blocks until a request may start
+func (f Fixed) Acquire() { f <- struct{}{} }
+
+// Release frees the slot taken by Acquire
+func (f Fixed) Release() { <-f }
+
+// Observe ignores request outcome
+func (f Fixed) Observe(time.Duration, bool) {}
+
+// Limit returns the number of allowed concurrent requests
+func (f Fixed) Limit() int { return cap(f) }
+
+// InFlight returns the number of requests in progress
+func (f Fixed) InFlight() int { return len(f) }
+
+// AIMD adapts the number of concurrent requests with additive increase, multiplicative decrease:
+// the limit grows by one per limit's worth of healthy requests, as long as it is actually used,
+// and is cut by Backoff factor on every request that is slower than the target latency or failed due to overload.
+type AIMD struct {
+	m        sync.Mutex
+	cond     *sync.Cond
+	limit    float64
+	min      int
+	max      int
+	target   time.Duration
+	backoff  float64
+	inFlight int
+}
+
+// Backoff is the factor AIMD limit is multiplied by on overload
+const Backoff = 0.9
+
+// NewAIMD returns AIMD limiter starting at `initial` concurrent requests, bounded by `min` and `max`,
+// treating requests slower than `target` latency as overload
+func NewAIMD(initial, min, max int, target time.Duration) *AIMD {
+	a := &AIMD{
+		limit:   float64(initial),
+		min:     min,
+		max:     max,
+		target:  target,
+		backoff: Backoff,
+	}
+	a.cond = sync.NewCond(&a.m)
+	a.clamp()
+	return a
+}
+
+// Acquire blocks until a request may start
+func (a *AIMD) Acquire() {
+	a.m.Lock()
+	for a.inFlight >= int(a.limit) {
+		a.cond.Wait()
+	}
+	a.inFlight++
+	a.m.Unlock()
+}
+
+// Release frees the slot taken by Acquire
+func (a *AIMD) Release() {
+	a.m.Lock()
+	a.inFlight--
+	a.m.Unlock()
+	a.cond.Signal()
+}
+
+// Observe adjusts the limit to request outcome
+func (a *AIMD) Observe(latency time.Duration, overloaded bool) {
+	a.m.Lock()
+	grown := false
+	switch {
+	case overloaded || latency > a.target:
+		a.limit *= a.backoff
+	case a.inFlight*2 >= int(a.limit):
+		// Growing unused limit would only allow a burst later
+		before := int(a.limit)
+		a.limit += 1 / a.limit
+		grown = int(a.limit) > before
+	}
+	a.clamp()
+	a.m.Unlock()
+	if grown {
+		a.cond.Broadcast()
+	}
+}
+
+// clamp keeps the limit within bounds
+func (a *AIMD) clamp() {
+	if a.limit < float64(a.min) {
+		a.limit = float64(a.min)
+	}
+	if a.limit > float64(a.max) {
+		a.limit = float64(a.max)
+	}
+}
+
+// Limit returns the current number of allowed concurrent requests
+func (a *AIMD) Limit() int {
+	a.m.Lock()
+	defer a.m.Unlock()
+	return int(a.limit)
+}
+
+// InFlight returns the number of requests in progress
+func (a *AIMD) InFlight() int {
+	a.m.Lock()
+	defer a.m.Unlock()
+	return a.inFlight
+}
@@ -0,0 +1,81 @@
+package limit
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFixed(t *testing.T) {
+	f := NewFixed(2)
+	f.Acquire()
+	f.Acquire()
+	f.Observe(time.Hour, true)
+	assert.Equal(t, 2, f.Limit())
+	assert.Equal(t, 2, f.InFlight())
+	f.Release()
+	assert.Equal(t, 1, f.InFlight())
+}
+
+func TestAIMD(t *testing.T) {
+	a := NewAIMD(4, 2, 6, 100*time.Millisecond)
+	assert.Equal(t, 4, a.Limit())
+	// Unused limit does not grow
+	a.Acquire()
+	for i := 0; i < 10; i++ {
+		a.Observe(time.Millisecond, false)
+	}
+	assert.Equal(t, 4, a.Limit())
+	// Grows by about one per limit's worth of healthy requests while used
+	a.Acquire()
+	for i := 0; i < 5; i++ {
+		a.Observe(time.Millisecond, false)
+	}
+	assert.Equal(t, 5, a.Limit())
+	a.Acquire()
+	for i := 0; i < 100; i++ {
+		a.Observe(time.Millisecond, false)
+	}
+	assert.Equal(t, 6, a.Limit(), "bounded by max")
+	// Shrinks on overload and slow requests
+	a.Observe(time.Millisecond, true)
+	assert.Equal(t, 5, a.Limit())
+	a.Observe(time.Second, false)
+	assert.Equal(t, 4, a.Limit())
+	for i := 0; i < 100; i++ {
+		a.Observe(time.Millisecond, true)
+	}
+	assert.Equal(t, 2, a.Limit(), "bounded by min")
+	assert.Equal(t, 3, a.InFlight())
+	a.Release()
+	a.Release()
+	a.Release()
+	assert.Equal(t, 0, a.InFlight())
+	assert.Equal(t, 3, NewAIMD(1, 3, 5, time.Second).Limit())
+}
+
+func TestAIMDConcurrency(t *testing.T) {
+	a := NewAIMD(3, 1, 3, time.Second)
+	var running, peak int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.Acquire()
+			n := atomic.AddInt32(&running, 1)
+			for p := atomic.LoadInt32(&peak); n > p && !atomic.CompareAndSwapInt32(&peak, p, n); p = atomic.LoadInt32(&peak) {
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			a.Observe(time.Millisecond, false)
+			a.Release()
+		}()
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, peak, int32(3))
+	assert.Equal(t, 0, a.InFlight())
+}
@@ -1,38 +1,126 @@
 package main
 
 import (
-	"log"
+	"flag"
+	"fmt"
 	"os"
-	"os/signal"
-	"syscall"
+	"runtime"
+	"time"
+	_ "time/tzdata" // Time zones for schedules, the image has no zoneinfo
 
-	"github.com/dmitry-vovk/csv-chg-go/api"
+	"github.com/dmitry-vovk/csv-chg-go/cli"
 	"github.com/dmitry-vovk/csv-chg-go/config"
 	"github.com/dmitry-vovk/csv-chg-go/source"
-	"github.com/dmitry-vovk/csv-chg-go/worker"
 )
 
+// version is set at build time with `-ldflags "-X main.version=..."`
+var version = "dev"
+
 func main() {
-	// Load configuration
-	cfg := config.MustLoad()
-	// Build worker instance
-	w := worker.New(api.New(cfg.APIURL)).
-		WithWorkersCount(cfg.Workers).
-		WithInterval(cfg.Interval)
-	// Read input data
-	if err := source.ReadAny(cfg.CSVFile, w.ReadUUIDs); err != nil {
-		log.Fatalf("Error reading source file: %s", err)
+	var (
+		runCfg      config.Config
+		checkCfg    config.CheckConfig
+		validateCfg config.ValidateConfig
+		diffCfg     config.DiffConfig
+		auditCfg    config.AuditQueryConfig
+		printCfg    config.Config
+		printFlags  *flag.FlagSet
+	)
+	app := &cli.App{
+		Name:    "csv-chg-go",
+		Default: "run",
+		Commands: []*cli.Command{
+			{
+				Name:    "run",
+				Args:    "[--]",
+				Summary: "Check input items periodically and raise low stock alerts",
+				Flags:   runCfg.Flags,
+				Run:     func(args []string) error { return runCommand(runCfg, args) },
+			},
+			{
+				Name:    "check",
+				Args:    "<id>...",
+				Summary: "Fetch items from the API and print their state",
+				Flags:   checkCfg.Flags,
+				Run:     func(args []string) error { return checkCommand(checkCfg, args) },
+			},
+			{
+				Name:    "validate",
+				Args:    "<input>",
+				Summary: "Check input for invalid and duplicate lines without calling the API",
+				Flags:   validateCfg.Flags,
+				Run:     func(args []string) error { return validateCommand(validateCfg, args) },
+			},
+			{
+				Name:    "diff",
+				Args:    "<old input> <new input>",
+				Summary: "Print IDs added and removed between two inputs",
+				Flags:   diffCfg.Flags,
+				Run:     func(args []string) error { return diffCommand(diffCfg, args) },
+			},
+			{
+				Name:    "audit",
+				Summary: "Inspect alert decisions audit",
+				Commands: []*cli.Command{{
+					Name:    "query",
+					Args:    "<audit file>",
+					Summary: "Print recorded alert decisions, including rotated files",
+					Flags:   auditCfg.Flags,
+					Run:     func(args []string) error { return auditQueryCommand(auditCfg, args) },
+				}},
+			},
+			{
+				Name:    "version",
+				Summary: "Print version",
+				Run: func([]string) error {
+					fmt.Printf("csv-chg-go %s %s %s/%s\n", version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+					return nil
+				},
+			},
+			{
+				Name:    "config",
+				Summary: "Inspect configuration",
+				Commands: []*cli.Command{{
+					Name:    "print",
+					Summary: "Print effective 'run' settings for the given flags",
+					Flags: func(fs *flag.FlagSet) {
+						printFlags = fs
+						printCfg.Flags(fs)
+					},
+					Run: func([]string) error {
+						if err := config.Print(os.Stdout, printFlags); err != nil {
+							return err
+						}
+						if err := printCfg.Validate(); err != nil {
+							// Settings are printed anyway, help would only obscure them
+							_, _ = fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+							return cli.ExitCode(cli.ExitUsage)
+						}
+						return nil
+					},
+				}},
+			},
+		},
+	}
+	os.Exit(app.Run(os.Args[1:]))
+}
+
+// newSource returns input reader with remote input settings from `cfg`
+func newSource(cfg config.InputConfig) *source.Reader {
+	src := source.New().
+		WithTimeout(cfg.Timeout).
+		WithRetries(cfg.Retries, time.Second).
+		WithMaxRedirects(cfg.MaxRedirects)
+	for k, v := range cfg.Headers {
+		for _, vv := range v {
+			src.WithHeader(k, vv)
+		}
+	}
+	if cfg.Token != "" {
+		src.WithBearerToken(cfg.Token)
+	}
+	if cfg.CacheDir != "" {
+		src.WithCacheDir(cfg.CacheDir)
 	}
-	// Subscribe to OS signals
-	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
-	go func() {
-		s := <-signals
-		log.Printf("Got %s, initiating shutdown...", s)
-		w.Shutdown()
-	}()
-	// Start the worker
-	log.Printf("Worker started")
-	w.Run()
-	log.Printf("Worker exited")
+	return src
 }
@@ -0,0 +1,236 @@
+// Package metrics keeps counters and gauges and writes them in Prometheus text format
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Metric types
+const (
+	TypeCounter = "counter"
+	TypeGauge   = "gauge"
+)
+
+// Registry holds metrics and exposes them in Prometheus text format
+type Registry struct {
+	set    *metricSet
+	labels string // Formatted labels of metrics registered through this registry, e.g. `{warehouse="a"}`
+}
+
+// metricSet is the list of metrics shared by registries with different labels
+type metricSet struct {
+	m       sync.Mutex
+	metrics []metric
+	kinds   map[string]string // Metric type by name
+	samples map[string]struct{}
+}
+
+// metric is a registered metric
+type metric struct {
+	name   string
+	help   string
+	kind   string
+	labels string
+	value  func() float64
+}
+
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{set: &metricSet{kinds: make(map[string]string), samples: make(map[string]struct{})}}
+}
+
+// WithLabels returns a registry adding `name`, `value` label pairs to the metrics registered through it,
+// metrics of both registries are exposed together
+func (r *Registry) WithLabels(pairs ...string) *Registry {
+	if len(pairs)%2 != 0 {
+		panic("labels should be name and value pairs")
+	}
+	labels := strings.TrimSuffix(strings.TrimPrefix(r.labels, "{"), "}")
+	for i := 0; i < len(pairs); i += 2 {
+		if labels != "" {
+			labels += ","
+		}
+		labels += pairs[i] + `="` + escapeLabel(pairs[i+1]) + `"`
+	}
+	if labels == "" {
+		return &Registry{set: r.set}
+	}
+	return &Registry{set: r.set, labels: "{" + labels + "}"}
+}
+
+// register adds a metric, panicking on duplicate names as that is a programming error
+func (r *Registry) register(name, help, kind string, value func() float64) {
+	s := r.set
+	s.m.Lock()
+	defer s.m.Unlock()
+	if _, ok := s.samples[name+r.labels]; ok {
+		panic(fmt.Sprintf("metric %q is already registered", name+r.labels))
+	}
+	if k, ok := s.kinds[name]; ok && k != kind {
+		panic(fmt.Sprintf("metric %q is already registered as %s", name, k))
+	}
+	s.kinds[name] = kind
+	s.samples[name+r.labels] = struct{}{}
+	s.metrics = append(s.metrics, metric{name: name, help: help, kind: kind, labels: r.labels, value: value})
+}
+
+// Counter registers and returns a counter
+func (r *Registry) Counter(name, help string) *Counter {
+	c := &Counter{}
+	r.register(name, help, TypeCounter, c.Value)
+	return c
+}
+
+// Gauge registers and returns a gauge
+func (r *Registry) Gauge(name, help string) *Gauge {
+	g := &Gauge{}
+	r.register(name, help, TypeGauge, g.Value)
+	return g
+}
+
+// GaugeFunc registers a gauge reporting the value returned by `fn`
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	r.register(name, help, TypeGauge, fn)
+}
+
+// CounterFunc registers a counter reporting the value returned by `fn`, which should never decrease
+func (r *Registry) CounterFunc(name, help string, fn func() float64) {
+	r.register(name, help, TypeCounter, fn)
+}
+
+// WriteTo writes all metrics to `w` in Prometheus text format.
+// Samples of the same metric with different labels are grouped under the first registered help.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.set.m.Lock()
+	var names []string
+	byName := make(map[string][]metric)
+	for _, m := range r.set.metrics {
+		if _, ok := byName[m.name]; !ok {
+			names = append(names, m.name)
+		}
+		byName[m.name] = append(byName[m.name], m)
+	}
+	r.set.m.Unlock()
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, name := range names {
+		list := byName[name]
+		_, _ = fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(list[0].help), name, list[0].kind)
+		for _, m := range list {
+			_, _ = fmt.Fprintf(bw, "%s%s %s\n", m.name, m.labels, formatValue(m.value()))
+		}
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ServeHTTP serves metrics to Prometheus scraper
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = r.WriteTo(w)
+}
+
+// escapeHelp escapes backslashes and line breaks in help text
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+// escapeLabel escapes backslashes, quotes and line breaks in label values
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// formatValue formats `v` as Prometheus sample value
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Counter is a monotonically increasing value, methods of nil Counter do nothing
+type Counter struct {
+	bits uint64 // float64 bits, accessed atomically
+}
+
+// Inc adds one to the counter
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds non-negative `v` to the counter
+func (c *Counter) Add(v float64) {
+	if c != nil && v > 0 {
+		addFloat(&c.bits, v)
+	}
+}
+
+// Value returns current counter value
+func (c *Counter) Value() float64 {
+	if c == nil {
+		return 0
+	}
+	return math.Float64frombits(atomic.LoadUint64(&c.bits))
+}
+
+// Gauge is a value that can go up and down, methods of nil Gauge do nothing
+type Gauge struct {
+	bits uint64 // float64 bits, accessed atomically
+}
+
+// Set sets the gauge to `v`
+func (g *Gauge) Set(v float64) {
+	if g != nil {
+		atomic.StoreUint64(&g.bits, math.Float64bits(v))
+	}
+}
+
+// Add adds `v`, possibly negative, to the gauge
+func (g *Gauge) Add(v float64) {
+	if g != nil {
+		addFloat(&g.bits, v)
+	}
+}
+
+// Value returns current gauge value
+func (g *Gauge) Value() float64 {
+	if g == nil {
+		return 0
+	}
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+// addFloat atomically adds `v` to float64 stored as bits in `addr`
+func addFloat(addr *uint64, v float64) {
+	for {
+		old := atomic.LoadUint64(addr)
+		if atomic.CompareAndSwapUint64(addr, old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// countingWriter counts bytes written to the underlying writer
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	c := r.Counter("requests_total", "Requests made")
+	g := r.Gauge("in_flight", "Requests\nin flight")
+	r.GaugeFunc("limit", `Current \ limit`, func() float64 { return 12 })
+	r.GaugeFunc("ratio", "Ratio", func() float64 { return math.NaN() })
+	r.CounterFunc("dropped_total", "Dropped", func() float64 { return 3 })
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Inc()
+			g.Add(1)
+			g.Add(-0.5)
+		}()
+	}
+	wg.Wait()
+	c.Add(-1) // Ignored
+	var buf bytes.Buffer
+	n, err := r.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(buf.Len()), n)
+	assert.Equal(t, `# HELP requests_total Requests made
+# TYPE requests_total counter
+requests_total 100
+# HELP in_flight Requests\nin flight
+# TYPE in_flight gauge
+in_flight 50
+# HELP limit Current \\ limit
+# TYPE limit gauge
+limit 12
+# HELP ratio Ratio
+# TYPE ratio gauge
+ratio NaN
+# HELP dropped_total Dropped
+# TYPE dropped_total counter
+dropped_total 3
+`, buf.String())
+	g.Set(2.5)
+	assert.Equal(t, 2.5, g.Value())
+	assert.Panics(t, func() { r.Gauge("limit", "Duplicate") })
+}
+
+func TestLabels(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("up", "Up").Inc()
+	a := r.WithLabels("warehouse", "a")
+	b := r.WithLabels("warehouse", `b"\`)
+	a.Counter("requests_total", "Requests made").Add(2)
+	r.GaugeFunc("limit", "Limit", func() float64 { return 1 })
+	b.Counter("requests_total", "Requests made").Add(3)
+	a.WithLabels("pool", "x").Gauge("limit", "Limit").Set(4)
+	assert.Equal(t, r.labels, r.WithLabels().labels)
+	var buf bytes.Buffer
+	_, err := r.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, `# HELP up Up
+# TYPE up counter
+up 1
+# HELP requests_total Requests made
+# TYPE requests_total counter
+requests_total{warehouse="a"} 2
+requests_total{warehouse="b\"\\"} 3
+# HELP limit Limit
+# TYPE limit gauge
+limit 1
+limit{warehouse="a",pool="x"} 4
+`, buf.String())
+	assert.Panics(t, func() { a.Counter("requests_total", "Duplicate") })
+	assert.Panics(t, func() { b.Gauge("requests_total", "Other type") })
+	assert.Panics(t, func() { r.WithLabels("warehouse") })
+}
+
+func TestNilMetrics(t *testing.T) {
+	var c *Counter
+	var g *Gauge
+	c.Inc()
+	g.Set(1)
+	g.Add(1)
+	assert.Equal(t, 0.0, c.Value())
+	assert.Equal(t, 0.0, g.Value())
+}
+
+func TestServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("alerts_total", "Alerts raised").Add(3)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), "\nalerts_total 3\n")
+}
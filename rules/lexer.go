@@ -0,0 +1,96 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string  // Operator or identifier text, unquoted string value
+	num  float64 // Value of number token
+	pos  int     // Offset in expression
+}
+
+// operators sorted so that longer ones match first
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "+", "-", "*", "/"}
+
+// tokenize splits expression into tokens
+func tokenize(expr string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expr); {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: i})
+			i++
+		case c == '"':
+			end := i + 1
+			for ; end < len(expr) && expr[end] != '"'; end++ {
+				if expr[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(expr) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			s, err := strconv.Unquote(expr[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at %d: %s", i, err)
+			}
+			tokens = append(tokens, token{kind: tokString, text: s, pos: i})
+			i = end + 1
+		case c >= '0' && c <= '9' || c == '.':
+			end := i
+			for end < len(expr) && (expr[end] >= '0' && expr[end] <= '9' || expr[end] == '.') {
+				end++
+			}
+			n, err := strconv.ParseFloat(expr[i:end], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at %d", expr[i:end], i)
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: expr[i:end], num: n, pos: i})
+			i = end
+		case c == '_' || unicode.IsLetter(c):
+			end := i
+			for end < len(expr) && (expr[end] == '_' || unicode.IsLetter(rune(expr[end])) || unicode.IsDigit(rune(expr[end]))) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: expr[i:end], pos: i})
+			i = end
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(expr[i:], op) {
+					tokens = append(tokens, token{kind: tokOp, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at %d", c, i)
+			}
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(expr)}), nil
+}
@@ -0,0 +1,355 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+)
+
+type valueType int
+
+const (
+	typeNumber valueType = iota
+	typeString
+	typeBool
+)
+
+func (t valueType) String() string {
+	switch t {
+	case typeNumber:
+		return "number"
+	case typeString:
+		return "string"
+	}
+	return "bool"
+}
+
+// node is a compiled expression, only the getter matching `typ` is set
+type node struct {
+	typ  valueType
+	num  func(e *Env) float64
+	str  func(e *Env) string
+	bool func(e *Env) bool
+}
+
+// variables available in expressions
+var variables = map[string]node{
+	"quantity":     {typ: typeNumber, num: func(e *Env) float64 { return float64(e.Quantity) }},
+	"threshold":    {typ: typeNumber, num: func(e *Env) float64 { return float64(e.Threshold) }},
+	"previous":     {typ: typeNumber, num: func(e *Env) float64 { return float64(e.previous()) }},
+	"drop":         {typ: typeNumber, num: func(e *Env) float64 { return float64(e.previous() - e.Quantity) }},
+	"drop_pct":     {typ: typeNumber, num: func(e *Env) float64 { return e.dropPercent() }},
+	"has_previous": {typ: typeBool, bool: func(e *Env) bool { return e.HasPrevious }},
+	"name":         {typ: typeString, str: func(e *Env) string { return e.Name }},
+	"uuid":         {typ: typeString, str: func(e *Env) string { return e.UUID }},
+	"true":         {typ: typeBool, bool: func(*Env) bool { return true }},
+	"false":        {typ: typeBool, bool: func(*Env) bool { return false }},
+}
+
+// parser is a recursive descent parser of rule expressions
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// compile parses `expr` into boolean expression
+func compile(expr string) (node, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return node{}, err
+	}
+	p := parser{tokens: tokens}
+	n, err := p.or()
+	if err != nil {
+		return node{}, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return node{}, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+	}
+	if n.typ != typeBool {
+		return node{}, fmt.Errorf("expression should be bool, got %s", n.typ)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is one of operators `ops`
+func (p *parser) accept(ops ...string) (token, bool) {
+	t := p.peek()
+	if t.kind == tokOp {
+		for _, op := range ops {
+			if t.text == op {
+				p.pos++
+				return t, true
+			}
+		}
+	}
+	return t, false
+}
+
+func expect(t token, n node, typ valueType) error {
+	if n.typ != typ {
+		return fmt.Errorf("operator %q at %d expects %s, got %s", t.text, t.pos, typ, n.typ)
+	}
+	return nil
+}
+
+func (p *parser) or() (node, error) {
+	left, err := p.and()
+	if err != nil {
+		return node{}, err
+	}
+	for {
+		t, ok := p.accept("||")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.and()
+		if err != nil {
+			return node{}, err
+		}
+		if err = expect(t, left, typeBool); err != nil {
+			return node{}, err
+		}
+		if err = expect(t, right, typeBool); err != nil {
+			return node{}, err
+		}
+		l, r := left.bool, right.bool
+		left = node{typ: typeBool, bool: func(e *Env) bool { return l(e) || r(e) }}
+	}
+}
+
+func (p *parser) and() (node, error) {
+	left, err := p.comparison()
+	if err != nil {
+		return node{}, err
+	}
+	for {
+		t, ok := p.accept("&&")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.comparison()
+		if err != nil {
+			return node{}, err
+		}
+		if err = expect(t, left, typeBool); err != nil {
+			return node{}, err
+		}
+		if err = expect(t, right, typeBool); err != nil {
+			return node{}, err
+		}
+		l, r := left.bool, right.bool
+		left = node{typ: typeBool, bool: func(e *Env) bool { return l(e) && r(e) }}
+	}
+}
+
+func (p *parser) comparison() (node, error) {
+	left, err := p.sum()
+	if err != nil {
+		return node{}, err
+	}
+	t, ok := p.accept("=~", "!~")
+	if ok {
+		return p.match(t, left)
+	}
+	if t, ok = p.accept("==", "!=", "<", "<=", ">", ">="); !ok {
+		return left, nil
+	}
+	right, err := p.sum()
+	if err != nil {
+		return node{}, err
+	}
+	if left.typ != right.typ {
+		return node{}, fmt.Errorf("operator %q at %d compares %s to %s", t.text, t.pos, left.typ, right.typ)
+	}
+	switch left.typ {
+	case typeNumber:
+		return compareNumbers(t.text, left.num, right.num), nil
+	case typeString:
+		return compareStrings(t.text, left.str, right.str), nil
+	}
+	if t.text != "==" && t.text != "!=" {
+		return node{}, fmt.Errorf("operator %q at %d is not defined for bool", t.text, t.pos)
+	}
+	l, r, eq := left.bool, right.bool, t.text == "=="
+	return node{typ: typeBool, bool: func(e *Env) bool { return (l(e) == r(e)) == eq }}, nil
+}
+
+// match compiles regular expression match, pattern should be a string literal
+func (p *parser) match(t token, left node) (node, error) {
+	if err := expect(t, left, typeString); err != nil {
+		return node{}, err
+	}
+	pattern := p.next()
+	if pattern.kind != tokString {
+		return node{}, fmt.Errorf("operator %q at %d expects string literal pattern", t.text, t.pos)
+	}
+	re, err := regexp.Compile(pattern.text)
+	if err != nil {
+		return node{}, fmt.Errorf("invalid pattern at %d: %s", pattern.pos, err)
+	}
+	l, want := left.str, t.text == "=~"
+	return node{typ: typeBool, bool: func(e *Env) bool { return re.MatchString(l(e)) == want }}, nil
+}
+
+func compareNumbers(op string, l, r func(e *Env) float64) node {
+	var f func(a, b float64) bool
+	switch op {
+	case "==":
+		f = func(a, b float64) bool { return a == b }
+	case "!=":
+		f = func(a, b float64) bool { return a != b }
+	case "<":
+		f = func(a, b float64) bool { return a < b }
+	case "<=":
+		f = func(a, b float64) bool { return a <= b }
+	case ">":
+		f = func(a, b float64) bool { return a > b }
+	default:
+		f = func(a, b float64) bool { return a >= b }
+	}
+	return node{typ: typeBool, bool: func(e *Env) bool { return f(l(e), r(e)) }}
+}
+
+func compareStrings(op string, l, r func(e *Env) string) node {
+	var f func(a, b string) bool
+	switch op {
+	case "==":
+		f = func(a, b string) bool { return a == b }
+	case "!=":
+		f = func(a, b string) bool { return a != b }
+	case "<":
+		f = func(a, b string) bool { return a < b }
+	case "<=":
+		f = func(a, b string) bool { return a <= b }
+	case ">":
+		f = func(a, b string) bool { return a > b }
+	default:
+		f = func(a, b string) bool { return a >= b }
+	}
+	return node{typ: typeBool, bool: func(e *Env) bool { return f(l(e), r(e)) }}
+}
+
+func (p *parser) sum() (node, error) {
+	left, err := p.term()
+	if err != nil {
+		return node{}, err
+	}
+	for {
+		t, ok := p.accept("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.term()
+		if err != nil {
+			return node{}, err
+		}
+		if left, err = arithmetic(t, left, right); err != nil {
+			return node{}, err
+		}
+	}
+}
+
+func (p *parser) term() (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return node{}, err
+	}
+	for {
+		t, ok := p.accept("*", "/")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.unary()
+		if err != nil {
+			return node{}, err
+		}
+		if left, err = arithmetic(t, left, right); err != nil {
+			return node{}, err
+		}
+	}
+}
+
+func arithmetic(t token, left, right node) (node, error) {
+	if err := expect(t, left, typeNumber); err != nil {
+		return node{}, err
+	}
+	if err := expect(t, right, typeNumber); err != nil {
+		return node{}, err
+	}
+	l, r := left.num, right.num
+	var f func(e *Env) float64
+	switch t.text {
+	case "+":
+		f = func(e *Env) float64 { return l(e) + r(e) }
+	case "-":
+		f = func(e *Env) float64 { return l(e) - r(e) }
+	case "*":
+		f = func(e *Env) float64 { return l(e) * r(e) }
+	default:
+		// Division by zero yields ±Inf or NaN, both compare predictably
+		f = func(e *Env) float64 { return l(e) / r(e) }
+	}
+	return node{typ: typeNumber, num: f}, nil
+}
+
+func (p *parser) unary() (node, error) {
+	t, ok := p.accept("!", "-")
+	if !ok {
+		return p.primary()
+	}
+	n, err := p.unary()
+	if err != nil {
+		return node{}, err
+	}
+	if t.text == "!" {
+		if err = expect(t, n, typeBool); err != nil {
+			return node{}, err
+		}
+		f := n.bool
+		return node{typ: typeBool, bool: func(e *Env) bool { return !f(e) }}, nil
+	}
+	if err = expect(t, n, typeNumber); err != nil {
+		return node{}, err
+	}
+	f := n.num
+	return node{typ: typeNumber, num: func(e *Env) float64 { return -f(e) }}, nil
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		v := t.num
+		return node{typ: typeNumber, num: func(*Env) float64 { return v }}, nil
+	case tokString:
+		v := t.text
+		return node{typ: typeString, str: func(*Env) string { return v }}, nil
+	case tokIdent:
+		if n, ok := variables[t.text]; ok {
+			return n, nil
+		}
+		return node{}, fmt.Errorf("unknown variable %q at %d", t.text, t.pos)
+	case tokLParen:
+		n, err := p.or()
+		if err != nil {
+			return node{}, err
+		}
+		if t = p.next(); t.kind != tokRParen {
+			return node{}, fmt.Errorf("expected ')' at %d", t.pos)
+		}
+		return n, nil
+	case tokEOF:
+		return node{}, fmt.Errorf("unexpected end of expression")
+	}
+	return node{}, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
@@ -0,0 +1,83 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompile(t *testing.T) {
+	env := &Env{
+		UUID:        "767d967f-b55b-4457-bfee-685eaa6d0583",
+		Name:        "PART-42",
+		Quantity:    4,
+		Threshold:   5,
+		Previous:    10,
+		HasPrevious: true,
+	}
+	testCases := map[string]bool{
+		`quantity < threshold`:                           true,
+		`quantity < 5 && name =~ "^PAR"`:                 true,
+		`quantity < 5 && name !~ "^PAR"`:                 false,
+		`quantity == 0 || drop_pct >= 60`:                true,
+		`drop == 6 && previous == 10`:                    true,
+		`!(quantity >= 5)`:                               true,
+		`-quantity + 2 * 3 - 8 / 4 == 0`:                 true,
+		`quantity != 4`:                                  false,
+		`quantity <= 3.5`:                                false,
+		`quantity > 3`:                                   true,
+		`uuid == "767d967f-b55b-4457-bfee-685eaa6d0583"`: true,
+		`name != "PART-42"`:                              false,
+		`name < "Q" && name <= "PART-42"`:                true,
+		`name > "Q" || name >= "Q"`:                      false,
+		`has_previous == true`:                           true,
+		`has_previous != false && true`:                  true,
+		`quantity / 0 > 1000`:                            true,
+		`name == "tab\t"`:                                false,
+	}
+	for expr, expected := range testCases {
+		t.Run(expr, func(t *testing.T) {
+			if n, err := compile(expr); assert.NoError(t, err) {
+				assert.Equal(t, expected, n.bool(env))
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	testCases := map[string]string{
+		``:                        "unexpected end of expression",
+		`quantity`:                "expression should be bool, got number",
+		`name`:                    "expression should be bool, got string",
+		`quantity < "5"`:          `operator "<" at 9 compares number to string`,
+		`stock < 5`:               `unknown variable "stock" at 0`,
+		`quantity < 5 &&`:         "unexpected end of expression",
+		`quantity < 5 && 1`:       `operator "&&" at 13 expects bool, got number`,
+		`1 || quantity < 5`:       `operator "||" at 2 expects bool, got number`,
+		`quantity < 5 || 1`:       `operator "||" at 13 expects bool, got number`,
+		`quantity =~ "5"`:         `operator "=~" at 9 expects string, got number`,
+		`name =~ uuid`:            `operator "=~" at 5 expects string literal pattern`,
+		`name =~ "("`:             "invalid pattern at 8: error parsing regexp: missing closing ): `(`",
+		`(quantity < 5`:           "expected ')' at 13",
+		`quantity < 5)`:           `unexpected ")" at 12`,
+		`quantity < 5 < 6`:        `unexpected "<" at 13`,
+		`name + 1 > 0`:            `operator "+" at 5 expects number, got string`,
+		`1 * name > 0`:            `operator "*" at 2 expects number, got string`,
+		`!quantity`:               `operator "!" at 0 expects bool, got number`,
+		`-name == ""`:             `operator "-" at 0 expects number, got string`,
+		`true < false`:            `operator "<" at 5 is not defined for bool`,
+		`name == "unterminated`:   "unterminated string at 8",
+		`name == "\q"`:            "invalid string at 8: invalid syntax",
+		`quantity < 1.2.3`:        `invalid number "1.2.3" at 11`,
+		`quantity < 5 ; true`:     `unexpected character ';' at 13`,
+		`quantity < )`:            `unexpected ")" at 11`,
+		`quantity < 5 && (drop >`: "unexpected end of expression",
+	}
+	for expr, expected := range testCases {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := compile(expr); assert.Error(t, err) {
+				assert.Equal(t, expected, err.Error())
+			}
+		})
+	}
+}
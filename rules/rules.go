@@ -0,0 +1,170 @@
+package rules
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Env holds item data the rules are evaluated against
+type Env struct {
+	UUID        string
+	Name        string
+	Quantity    int
+	Threshold   int
+	Previous    int  // Quantity observed in the previous cycle
+	HasPrevious bool // Whether the item has been observed before
+}
+
+// previous returns previous quantity, or current one if there is none
+func (e *Env) previous() int {
+	if e.HasPrevious {
+		return e.Previous
+	}
+	return e.Quantity
+}
+
+// dropPercent returns quantity drop since previous cycle in percents of previous quantity
+func (e *Env) dropPercent() float64 {
+	prev := e.previous()
+	if prev <= 0 {
+		return 0
+	}
+	return float64(prev-e.Quantity) * 100 / float64(prev)
+}
+
+// Severity labels, in increasing order
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+var severities = map[string]int{
+	SeverityInfo:     1,
+	SeverityWarning:  2,
+	SeverityCritical: 3,
+}
+
+// Rule is a named alert condition
+type Rule struct {
+	Name     string
+	Severity string
+	Expr     string
+	cond     node
+}
+
+// Set is an ordered list of rules
+type Set []Rule
+
+// New compiles a single rule
+func New(name, severity, expr string) (Rule, error) {
+	if _, ok := severities[severity]; !ok {
+		return Rule{}, fmt.Errorf("unknown severity %q", severity)
+	}
+	cond, err := compile(expr)
+	if err != nil {
+		return Rule{}, err
+	}
+	return Rule{Name: name, Severity: severity, Expr: expr, cond: cond}, nil
+}
+
+// Match tells whether rule condition holds for `e`
+func (r Rule) Match(e *Env) bool {
+	return r.cond.bool(e)
+}
+
+// Default returns the rule set raising critical alerts for items out of stock and warnings for items below threshold
+func Default() Set {
+	var set Set
+	for _, r := range []struct{ name, severity, expr string }{
+		{"out_of_stock", SeverityCritical, "quantity == 0"},
+		{"below_threshold", SeverityWarning, "quantity < threshold"},
+	} {
+		rule, err := New(r.name, r.severity, r.expr)
+		if err != nil {
+			panic(err)
+		}
+		set = append(set, rule)
+	}
+	return set
+}
+
+// Parse reads rules, one per line, in `<name> <severity> <expression>` format.
+// Empty lines and lines starting with `#` are ignored.
+func Parse(r io.Reader) (Set, error) {
+	var set Set
+	names := make(map[string]struct{})
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("line %d: expected '<name> <severity> <expression>'", line)
+		}
+		if _, ok := names[fields[0]]; ok {
+			return nil, fmt.Errorf("line %d: duplicate rule name %q", line, fields[0])
+		}
+		names[fields[0]] = struct{}{}
+		rest := strings.TrimSpace(text[len(fields[0]):])
+		expr := strings.TrimSpace(rest[len(fields[1]):])
+		rule, err := New(fields[0], fields[1], expr)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		set = append(set, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(set) == 0 {
+		return nil, fmt.Errorf("no rules defined")
+	}
+	return set, nil
+}
+
+// Load reads rules from file `path`
+func Load(path string) (Set, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return Parse(f)
+}
+
+// Evaluate returns rules matching `e`
+func (s Set) Evaluate(e *Env) Set {
+	var matched Set
+	for _, r := range s {
+		if r.Match(e) {
+			matched = append(matched, r)
+		}
+	}
+	return matched
+}
+
+// Names returns rule names
+func (s Set) Names() []string {
+	names := make([]string, len(s))
+	for i, r := range s {
+		names[i] = r.Name
+	}
+	return names
+}
+
+// Severity returns the highest severity among rules, empty for empty set
+func (s Set) Severity() string {
+	severity := ""
+	for _, r := range s {
+		if severities[r.Severity] > severities[severity] {
+			severity = r.Severity
+		}
+	}
+	return severity
+}
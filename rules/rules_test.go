@@ -0,0 +1,96 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	set, err := Load("test_data/rules.txt")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"low_stock", "out_of_stock", "parts", "sudden_drop", "big_drop"}, set.Names())
+	assert.Equal(t, `quantity < 10 && name =~ "^PAR"`, set[2].Expr)
+	testCases := []struct {
+		name     string
+		env      Env
+		matched  []string
+		severity string
+	}{
+		{
+			name:    "nothing",
+			env:     Env{Name: "item", Quantity: 50, Threshold: 5},
+			matched: []string{},
+		},
+		{
+			name:     "below threshold",
+			env:      Env{Name: "item", Quantity: 3, Threshold: 5},
+			matched:  []string{"low_stock"},
+			severity: SeverityWarning,
+		},
+		{
+			name:     "out of stock",
+			env:      Env{Name: "PARTS", Quantity: 0, Threshold: 5, Previous: 200, HasPrevious: true},
+			matched:  []string{"low_stock", "out_of_stock", "parts", "sudden_drop", "big_drop"},
+			severity: SeverityCritical,
+		},
+		{
+			name:     "first observation",
+			env:      Env{Name: "item", Quantity: 200, Threshold: 5},
+			matched:  []string{},
+			severity: "",
+		},
+		{
+			name:     "big drop",
+			env:      Env{Name: "item", Quantity: 200, Threshold: 5, Previous: 350, HasPrevious: true},
+			matched:  []string{"big_drop"},
+			severity: SeverityInfo,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			matched := set.Evaluate(&tc.env)
+			assert.Equal(t, tc.matched, matched.Names())
+			assert.Equal(t, tc.severity, matched.Severity())
+		})
+	}
+	_, err = Load("test_data/non-existing.txt")
+	assert.Error(t, err)
+}
+
+func TestParseErrors(t *testing.T) {
+	testCases := map[string]string{
+		"":                       "no rules defined",
+		"# only comment\n\n":     "no rules defined",
+		"low warning":            "line 1: expected '<name> <severity> <expression>'",
+		"low fatal quantity < 5": `line 1: unknown severity "fatal"`,
+		"low warning quantity <": "line 1: unexpected end of expression",
+		"low warning quantity < 5\nlow info true": `line 2: duplicate rule name "low"`,
+	}
+	for text, expected := range testCases {
+		t.Run(text, func(t *testing.T) {
+			if _, err := Parse(strings.NewReader(text)); assert.Error(t, err) {
+				assert.Equal(t, expected, err.Error())
+			}
+		})
+	}
+}
+
+func TestDefault(t *testing.T) {
+	set := Default()
+	assert.Equal(t, []string{"below_threshold"}, set.Evaluate(&Env{Quantity: 4, Threshold: 5}).Names())
+	assert.Equal(t, SeverityWarning, set.Evaluate(&Env{Quantity: 4, Threshold: 5}).Severity())
+	assert.Equal(t, []string{"out_of_stock", "below_threshold"}, set.Evaluate(&Env{Quantity: 0, Threshold: 5}).Names())
+	assert.Equal(t, SeverityCritical, set.Evaluate(&Env{Quantity: 0, Threshold: 5}).Severity())
+	assert.Empty(t, set.Evaluate(&Env{Quantity: 5, Threshold: 5}))
+}
+
+func TestDropPercent(t *testing.T) {
+	assert.Equal(t, 0.0, (&Env{Quantity: 5}).dropPercent())
+	assert.Equal(t, 0.0, (&Env{Quantity: 5, Previous: 0, HasPrevious: true}).dropPercent())
+	assert.Equal(t, 25.0, (&Env{Quantity: 3, Previous: 4, HasPrevious: true}).dropPercent())
+	assert.Equal(t, -50.0, (&Env{Quantity: 6, Previous: 4, HasPrevious: true}).dropPercent())
+}
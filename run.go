@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/dmitry-vovk/csv-chg-go/api"
+	"github.com/dmitry-vovk/csv-chg-go/audit"
+	"github.com/dmitry-vovk/csv-chg-go/cli"
+	"github.com/dmitry-vovk/csv-chg-go/config"
+	"github.com/dmitry-vovk/csv-chg-go/history"
+	"github.com/dmitry-vovk/csv-chg-go/ident"
+	"github.com/dmitry-vovk/csv-chg-go/leader"
+	"github.com/dmitry-vovk/csv-chg-go/limit"
+	"github.com/dmitry-vovk/csv-chg-go/metrics"
+	"github.com/dmitry-vovk/csv-chg-go/rules"
+	"github.com/dmitry-vovk/csv-chg-go/schedule"
+	"github.com/dmitry-vovk/csv-chg-go/shard"
+	"github.com/dmitry-vovk/csv-chg-go/sink"
+	"github.com/dmitry-vovk/csv-chg-go/trace"
+	"github.com/dmitry-vovk/csv-chg-go/worker"
+)
+
+// runCommand loads input and checks items until interrupted
+func runCommand(cfg config.Config, args []string) error {
+	switch {
+	case len(args) == 1 && args[0] == "--" && cfg.CSVFile == "":
+		cfg.CSVFile = "--"
+	case len(args) > 0:
+		return cli.Usage(errors.New("unexpected arguments, input should be set with -input"))
+	}
+	if err := cfg.Validate(); err != nil {
+		return cli.Usage(err)
+	}
+	configs, err := cfg.Warehouses()
+	if err != nil {
+		return err
+	}
+	var registry *metrics.Registry
+	if cfg.MetricsAddr != "" {
+		registry = metrics.NewRegistry()
+		ln, err := net.Listen("tcp", cfg.MetricsAddr)
+		if err != nil {
+			return fmt.Errorf("serving metrics: %s", err)
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", registry)
+		srv := &http.Server{Handler: mux}
+		go func() { _ = srv.Serve(ln) }()
+		defer func() { _ = srv.Close() }()
+		log.Printf("Serving metrics at http://%s/metrics", ln.Addr())
+	}
+	tracer, closeTracer, err := newTracer(cfg.Trace)
+	if err != nil {
+		return fmt.Errorf("opening trace destination: %s", err)
+	}
+	defer closeTracer()
+	if registry != nil && tracer != nil {
+		registry.CounterFunc("csvchg_trace_spans_dropped_total", "Number of spans dropped because export could not keep up",
+			func() float64 { return float64(tracer.Dropped()) })
+	}
+	var auditLog *audit.Log
+	if cfg.Audit.File != "" {
+		if auditLog, err = audit.Open(cfg.Audit.File, int64(cfg.Audit.MaxSize)<<20, cfg.Audit.MaxAge); err != nil {
+			return fmt.Errorf("opening audit file: %s", err)
+		}
+		defer func() { _ = auditLog.Close() }()
+	}
+	workers := make([]*worker.Worker, 0, len(configs))
+	for _, wc := range configs {
+		w, closeWorker, err := newWorker(wc, registry, tracer, auditLog)
+		if err != nil {
+			if wc.Warehouse != "" {
+				return fmt.Errorf("warehouse %q: %s", wc.Warehouse, err)
+			}
+			return err
+		}
+		defer closeWorker()
+		workers = append(workers, w)
+	}
+	// Compete for leadership, standby keeps the UUIDs loaded to take over quickly
+	if cfg.LockFile != "" {
+		elector := leader.New(cfg.LockFile, cfg.InstanceID, cfg.Interval/2)
+		if err := elector.Acquire(); err != nil {
+			return fmt.Errorf("leader election: %s", err)
+		}
+		go elector.Run()
+		defer elector.Stop()
+		for _, w := range workers {
+			w.WithLeader(elector)
+		}
+	}
+	// Subscribe to OS signals, the second one quits without waiting for checks in progress
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		s := <-signals
+		log.Printf("Got %s, initiating shutdown, send it again to quit immediately...", s)
+		for _, w := range workers {
+			go w.Shutdown()
+		}
+		s = <-signals
+		log.Printf("Got %s again, quitting", s)
+		os.Exit(cli.ExitError)
+	}()
+	// Start the workers, the first one failing fails the command
+	var wg sync.WaitGroup
+	errC := make(chan error, len(workers))
+	for i, w := range workers {
+		wg.Add(1)
+		go func(w *worker.Worker, warehouse string) {
+			defer wg.Done()
+			if err := w.Run(context.Background()); err != nil {
+				if warehouse != "" {
+					err = fmt.Errorf("warehouse %q: %s", warehouse, err)
+				}
+				log.Printf("Worker failed: %s", err)
+				errC <- err
+			}
+		}(w, configs[i].Warehouse)
+	}
+	if len(workers) > 1 {
+		log.Printf("%d warehouse workers started", len(workers))
+	} else {
+		log.Printf("Worker started")
+	}
+	wg.Wait()
+	log.Printf("Worker exited")
+	close(errC)
+	return <-errC
+}
+
+// newWorker builds a worker checking items of a warehouse and loads its input.
+// Returned function releases worker resources once it is stopped.
+func newWorker(cfg config.Config, registry *metrics.Registry, tracer *trace.Tracer, auditLog *audit.Log) (*worker.Worker, func(), error) {
+	logger := log.New(log.Writer(), log.Prefix(), log.Flags())
+	if cfg.Warehouse != "" {
+		logger = log.New(log.Writer(), "["+cfg.Warehouse+"] ", log.Flags()|log.Lmsgprefix)
+		tracer = tracer.With("warehouse", cfg.Warehouse)
+	}
+	client := api.New(cfg.APIURL).WithTimeout(cfg.APITimeout).WithStrictDecoding(cfg.Strict)
+	if cfg.ItemCache {
+		client.WithCache()
+	}
+	if tracer != nil {
+		client.WithTransport(&trace.Transport{Tracer: tracer})
+	}
+	format, _ := ident.New(cfg.IDFormat)
+	w := worker.New(client).
+		WithWorkersCount(cfg.Workers).
+		WithInterval(cfg.Interval).
+		WithThreshold(cfg.Threshold).
+		WithInstanceID(cfg.InstanceID).
+		WithEscalation(cfg.Escalation).
+		WithDrainTimeout(cfg.DrainTimeout).
+		WithStore(cfg.Store).
+		WithIDFormat(format).
+		WithMaxLineLength(cfg.MaxLine).
+		WithLogger(logger).
+		WithTracer(tracer)
+	if auditLog != nil {
+		if cfg.Warehouse != "" {
+			auditLog = auditLog.WithWarehouse(cfg.Warehouse)
+		}
+		w.WithAuditor(auditLog)
+	}
+	if cfg.Adaptive.Enabled {
+		w.WithLimiter(limit.NewAIMD(cfg.Workers, cfg.Adaptive.MinWorkers, cfg.Adaptive.MaxWorkers, cfg.Adaptive.TargetLatency))
+	}
+	if registry != nil {
+		if cfg.Warehouse != "" {
+			registry = registry.WithLabels("warehouse", cfg.Warehouse)
+		}
+		w.WithMetrics(registry)
+	}
+	loc, _ := time.LoadLocation(cfg.Schedule.TimeZone)
+	if len(cfg.Schedule.Crons) > 0 {
+		s, _ := schedule.Parse(cfg.Schedule.Crons, loc)
+		w.WithSchedule(s)
+		logger.Printf("Checks scheduled at %s", s)
+	}
+	if cfg.AutoInterval.Enabled {
+		w.WithAutoIntervals(cfg.AutoInterval.Min, cfg.AutoInterval.Max)
+	}
+	if len(cfg.Schedule.QuietHours) > 0 {
+		q, _ := schedule.ParseWindows(cfg.Schedule.QuietHours, loc)
+		w.WithQuietHours(q)
+	}
+	w.WithParsers(cfg.Parsers)
+	if cfg.Shard.Count > 1 {
+		s, _ := shard.New(cfg.Shard.Index, cfg.Shard.Count, cfg.Shard.Mode)
+		w.WithSharder(s)
+	}
+	withSinks(w, cfg.Sinks, client, logger)
+	if cfg.RulesFile != "" {
+		set, err := rules.Load(cfg.RulesFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("loading rules: %s", err)
+		}
+		w.WithRules(set)
+	}
+	closeWorker := func() {}
+	if cfg.History.File != "" {
+		h, err := history.Open(cfg.History.File, cfg.History.Window)
+		if err != nil {
+			return nil, nil, fmt.Errorf("opening history: %s", err)
+		}
+		closeWorker = func() { _ = h.Close() }
+		w.WithHistory(h, cfg.History.Horizon)
+	}
+	// Read input data
+	if err := newSource(cfg.Input).ReadAny(cfg.CSVFile, w.ReadUUIDs); err != nil {
+		closeWorker()
+		return nil, nil, fmt.Errorf("reading source file: %s", err)
+	}
+	return w, closeWorker, nil
+}
+
+// withSinks sends alerts to sinks set by severity in `specs`, log sinks write to `logger`
+func withSinks(w *worker.Worker, specs map[string]string, client sink.AlertPoster, logger *log.Logger) {
+	for severity, spec := range specs {
+		s, _ := sink.New(spec, client)
+		if _, ok := s.(sink.Log); ok {
+			s = sink.Log{Logger: logger}
+		}
+		w.WithSink(severity, s)
+	}
+}
+
+// newTracer returns tracer exporting to destination set in `cfg`, nil if tracing is disabled.
+// Returned function exports remaining spans and closes the destination.
+func newTracer(cfg config.TraceConfig) (*trace.Tracer, func(), error) {
+	switch {
+	case cfg.Dest == "":
+		return nil, func() {}, nil
+	case cfg.Dest == "stdout":
+		exporter, err := trace.NewWriterExporter(os.Stdout)
+		if err != nil {
+			return nil, nil, err
+		}
+		t := trace.New(exporter, cfg.Service, cfg.Sample)
+		return t, t.Close, nil
+	case strings.HasPrefix(cfg.Dest, "http://") || strings.HasPrefix(cfg.Dest, "https://"):
+		exporter, err := trace.NewOTLPExporter(cfg.Dest)
+		if err != nil {
+			return nil, nil, err
+		}
+		t := trace.New(exporter, cfg.Service, cfg.Sample)
+		return t, t.Close, nil
+	}
+	f, err := os.OpenFile(cfg.Dest, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	exporter, err := trace.NewWriterExporter(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, err
+	}
+	t := trace.New(exporter, cfg.Service, cfg.Sample)
+	return t, func() {
+		t.Close()
+		_ = f.Close()
+	}, nil
+}
@@ -0,0 +1,181 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron runs cycles at times matching a cron expression in a time zone
+type Cron struct {
+	expr    string
+	loc     *time.Location
+	minute  uint64 // Bit sets of matching values
+	hour    uint64
+	dom     uint64
+	month   uint64
+	dow     uint64
+	domStar bool // Day of month field starts with `*`
+	dowStar bool // Day of week field starts with `*`
+}
+
+// field describes a cron expression field
+type field struct {
+	name  string
+	min   int
+	max   int
+	names []string // Value names starting from `min`, if any
+}
+
+var fields = []field{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	// 7 is Sunday too
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// descriptors are shortcuts for common expressions
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// maxSearch limits how far Next looks for a matching time
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+// ParseCron parses standard 5-field cron expression `minute hour day-of-month month day-of-week`.
+// Fields support `*`, values, ranges `a-b`, steps `*/n` and `a-b/n`, and comma separated lists,
+// months and days of week can be given by three-letter English names. Expressions can also be
+// one of `@yearly`, `@monthly`, `@weekly`, `@daily` or `@hourly`.
+// As in Vixie cron, when both day fields are restricted, a day matching either of them matches.
+func ParseCron(expr string, loc *time.Location) (*Cron, error) {
+	spec := strings.TrimSpace(expr)
+	if d, ok := descriptors[strings.ToLower(spec)]; ok {
+		spec = d
+	}
+	parts := strings.Fields(spec)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("cron expression %q should have %d fields", expr, len(fields))
+	}
+	c := &Cron{expr: expr, loc: loc}
+	sets := []*uint64{&c.minute, &c.hour, &c.dom, &c.month, &c.dow}
+	for i, part := range parts {
+		set, err := fields[i].parse(part)
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q: %s", expr, err)
+		}
+		*sets[i] = set
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domStar = strings.HasPrefix(parts[2], "*")
+	c.dowStar = strings.HasPrefix(parts[4], "*")
+	if c.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("cron expression %q never matches", expr)
+	}
+	return c, nil
+}
+
+// parse returns bit set of values matching comma separated list `s`
+func (f field) parse(s string) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(s, ",") {
+		lo, hi, step := f.min, f.max, 1
+		rng := item
+		if i := strings.IndexByte(item, '/'); i >= 0 {
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step in %s field %q", f.name, item)
+			}
+			step, rng = n, item[:i]
+		}
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if lo, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			switch {
+			case len(bounds) == 2:
+				if hi, err = f.value(bounds[1]); err != nil {
+					return 0, err
+				}
+			case step == 1:
+				hi = lo
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range in %s field %q", f.name, item)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+// value parses a single number or name within field bounds
+func (f field) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s should be in %d-%d range, got %q", f.name, f.min, f.max, s)
+	}
+	return v, nil
+}
+
+// Next returns the first minute after `t` matching the expression.
+// Times skipped by daylight saving transitions do not match.
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.In(c.loc).Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxSearch)
+	for t.Before(limit) {
+		var next time.Time
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			next = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, c.loc)
+		case !c.dayMatches(t):
+			next = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, c.loc)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			// Adding time instead of normalizing the hour steps over daylight saving gaps
+			next = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			next = t.Add(time.Minute)
+		default:
+			return t
+		}
+		if !next.After(t) {
+			// Midnight skipped by daylight saving transition
+			next = t.Add(time.Hour)
+		}
+		t = next
+	}
+	return time.Time{}
+}
+
+// dayMatches tells whether day of `t` matches day of month and day of week fields
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func (c *Cron) String() string {
+	return c.expr + " " + c.loc.String()
+}
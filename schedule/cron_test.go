@@ -0,0 +1,61 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCron(t *testing.T) {
+	for expr, err := range map[string]string{
+		"* * * *":       `cron expression "* * * *" should have 5 fields`,
+		"60 * * * *":    `cron expression "60 * * * *": minute should be in 0-59 range, got "60"`,
+		"* 1-24 * * *":  `cron expression "* 1-24 * * *": hour should be in 0-23 range, got "24"`,
+		"* * 0 * *":     `cron expression "* * 0 * *": day of month should be in 1-31 range, got "0"`,
+		"* * * foo *":   `cron expression "* * * foo *": month should be in 1-12 range, got "foo"`,
+		"*/0 * * * *":   `cron expression "*/0 * * * *": invalid step in minute field "*/0"`,
+		"* 5-1 * * *":   `cron expression "* 5-1 * * *": invalid range in hour field "5-1"`,
+		"0 0 30 feb *":  `cron expression "0 0 30 feb *" never matches`,
+		"@fortnightly":  `cron expression "@fortnightly" should have 5 fields`,
+		"* * * * mon-x": `cron expression "* * * * mon-x": day of week should be in 0-7 range, got "x"`,
+	} {
+		_, e := ParseCron(expr, time.UTC)
+		assert.EqualError(t, e, err, expr)
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	testCases := []struct {
+		expr string
+		loc  *time.Location
+		from string
+		next []string
+	}{
+		{"*/5 9-17 * * mon-fri", time.UTC, "2021-03-05T17:53:10Z", []string{"2021-03-05T17:55:00Z", "2021-03-08T09:00:00Z", "2021-03-08T09:05:00Z"}},
+		{"0 0-8,18-23 * * *", time.UTC, "2021-03-05T08:00:00Z", []string{"2021-03-05T18:00:00Z", "2021-03-05T19:00:00Z"}},
+		{"@daily", time.UTC, "2021-12-31T12:00:00Z", []string{"2022-01-01T00:00:00Z"}},
+		{"30 8 29 feb *", time.UTC, "2021-01-01T00:00:00Z", []string{"2024-02-29T08:30:00Z"}},
+		{"0 12 1 * 0", time.UTC, "2021-08-01T12:00:00Z", []string{"2021-08-08T12:00:00Z", "2021-08-15T12:00:00Z"}},
+		{"0 12 1 * 7", time.UTC, "2021-08-28T00:00:00Z", []string{"2021-08-29T12:00:00Z", "2021-09-01T12:00:00Z"}},
+		{"10/20 * * * *", time.UTC, "2021-08-01T12:00:00Z", []string{"2021-08-01T12:10:00Z", "2021-08-01T12:30:00Z", "2021-08-01T12:50:00Z", "2021-08-01T13:10:00Z"}},
+		{"0 9 * * *", ny, "2021-07-01T14:00:00Z", []string{"2021-07-02T13:00:00Z"}},
+		{"0 9 * * *", ny, "2021-12-01T15:00:00Z", []string{"2021-12-02T14:00:00Z"}},
+		// Spring forward, 02:30 does not exist on March 14
+		{"30 2 * * *", ny, "2021-03-13T08:00:00Z", []string{"2021-03-15T06:30:00Z"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			c, err := ParseCron(tc.expr, tc.loc)
+			require.NoError(t, err)
+			at, _ := time.Parse(time.RFC3339, tc.from)
+			for _, want := range tc.next {
+				at = c.Next(at)
+				assert.Equal(t, want, at.UTC().Format(time.RFC3339))
+			}
+		})
+	}
+}
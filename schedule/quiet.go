@@ -0,0 +1,105 @@
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window is a daily period of time, e.g. 22:00-07:00, in a time zone
+type Window struct {
+	start int // Minutes since midnight, inclusive
+	end   int // Minutes since midnight, exclusive, less than start for windows spanning midnight
+	loc   *time.Location
+}
+
+// ParseWindow parses `HH:MM-HH:MM` daily window in `loc`
+func ParseWindow(s string, loc *time.Location) (Window, error) {
+	bounds := strings.SplitN(s, "-", 2)
+	if len(bounds) != 2 {
+		return Window{}, fmt.Errorf("window %q should be in HH:MM-HH:MM format", s)
+	}
+	w := Window{loc: loc}
+	for i, p := range []*int{&w.start, &w.end} {
+		t, err := time.Parse("15:04", strings.TrimSpace(bounds[i]))
+		if err != nil {
+			return Window{}, fmt.Errorf("window %q should be in HH:MM-HH:MM format", s)
+		}
+		*p = t.Hour()*60 + t.Minute()
+	}
+	if w.start == w.end {
+		return Window{}, fmt.Errorf("window %q is empty", s)
+	}
+	return w, nil
+}
+
+// Contains tells whether `t` falls within the window
+func (w Window) Contains(t time.Time) bool {
+	t = t.In(w.loc)
+	m := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return m >= w.start && m < w.end
+	}
+	return m >= w.start || m < w.end
+}
+
+// End returns when the window containing `t` ends, false if `t` is outside the window
+func (w Window) End(t time.Time) (time.Time, bool) {
+	if !w.Contains(t) {
+		return time.Time{}, false
+	}
+	t = t.In(w.loc)
+	day := t.Day()
+	if w.start > w.end && t.Hour()*60+t.Minute() >= w.start {
+		day++
+	}
+	return time.Date(t.Year(), t.Month(), day, w.end/60, w.end%60, 0, 0, w.loc), true
+}
+
+func (w Window) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d %s", w.start/60, w.start%60, w.end/60, w.end%60, w.loc)
+}
+
+// Windows is a set of possibly overlapping windows
+type Windows []Window
+
+// ParseWindows parses `HH:MM-HH:MM` daily windows in `loc`
+func ParseWindows(specs []string, loc *time.Location) (Windows, error) {
+	ws := make(Windows, 0, len(specs))
+	for _, s := range specs {
+		w, err := ParseWindow(s, loc)
+		if err != nil {
+			return nil, err
+		}
+		ws = append(ws, w)
+	}
+	return ws, nil
+}
+
+// End returns when the period of adjacent or overlapping windows containing `t` ends,
+// false if `t` is outside all windows. Windows covering the whole day end 24 hours after `t`.
+func (ws Windows) End(t time.Time) (time.Time, bool) {
+	end, in, limit := t, false, t.Add(24*time.Hour)
+	for extended := true; extended; {
+		extended = false
+		for _, w := range ws {
+			if e, ok := w.End(end); ok && e.After(end) {
+				end, in, extended = e, true, true
+			}
+		}
+		if end.After(limit) {
+			return limit, in
+		}
+	}
+	return end, in
+}
+
+// AllDay tells whether the windows together cover the whole day
+func (ws Windows) AllDay() bool {
+	if len(ws) == 0 {
+		return false
+	}
+	t := time.Date(2000, 1, 1, 0, 0, 0, 0, ws[0].loc)
+	end, _ := ws.End(t)
+	return !end.Before(t.Add(24 * time.Hour))
+}
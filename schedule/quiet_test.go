@@ -0,0 +1,76 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWindow(t *testing.T) {
+	for s, err := range map[string]string{
+		"22:00":       `window "22:00" should be in HH:MM-HH:MM format`,
+		"22:00-7":     `window "22:00-7" should be in HH:MM-HH:MM format`,
+		"24:00-07:00": `window "24:00-07:00" should be in HH:MM-HH:MM format`,
+		"07:00-07:00": `window "07:00-07:00" is empty`,
+	} {
+		_, e := ParseWindow(s, time.UTC)
+		assert.EqualError(t, e, err, s)
+	}
+	w, err := ParseWindow("22:00 - 07:30", time.UTC)
+	require.NoError(t, err)
+	assert.Equal(t, "22:00-07:30 UTC", w.String())
+}
+
+func TestWindow(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	night, _ := ParseWindow("22:00-07:00", ny)
+	lunch, _ := ParseWindow("12:00-13:00", time.UTC)
+	testCases := []struct {
+		window Window
+		at     string
+		end    string // Empty if outside
+	}{
+		{night, "2021-08-02T01:59:00Z", ""}, // 21:59 EDT
+		{night, "2021-08-02T02:00:00Z", "2021-08-02T11:00:00Z"},
+		{night, "2021-08-02T10:59:59Z", "2021-08-02T11:00:00Z"},
+		{night, "2021-08-02T11:00:00Z", ""},
+		{night, "2021-08-02T01:00:00Z", ""},
+		{lunch, "2021-08-02T11:59:00Z", ""},
+		{lunch, "2021-08-02T12:00:00Z", "2021-08-02T13:00:00Z"},
+		{lunch, "2021-08-02T13:00:00Z", ""},
+	}
+	for _, tc := range testCases {
+		at, _ := time.Parse(time.RFC3339, tc.at)
+		end, ok := tc.window.End(at)
+		assert.Equal(t, tc.end != "", ok, tc.at)
+		assert.Equal(t, tc.end != "", tc.window.Contains(at), tc.at)
+		if ok {
+			assert.Equal(t, tc.end, end.UTC().Format(time.RFC3339), tc.at)
+		}
+	}
+}
+
+func TestWindows(t *testing.T) {
+	ws, err := ParseWindows([]string{"22:00-02:00", "01:00-07:00", "12:00-13:00"}, time.UTC)
+	require.NoError(t, err)
+	at := time.Date(2021, 8, 1, 23, 0, 0, 0, time.UTC)
+	end, ok := ws.End(at)
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2021, 8, 2, 7, 0, 0, 0, time.UTC), end)
+	_, ok = ws.End(time.Date(2021, 8, 1, 9, 0, 0, 0, time.UTC))
+	assert.False(t, ok)
+	assert.False(t, ws.AllDay())
+	_, err = ParseWindows([]string{"12:00-13:00", "noon"}, time.UTC)
+	assert.Error(t, err)
+	// Windows covering the whole day end a day later
+	ws, err = ParseWindows([]string{"00:00-12:00", "12:00-00:00"}, time.UTC)
+	require.NoError(t, err)
+	end, ok = ws.End(at)
+	assert.True(t, ok)
+	assert.Equal(t, at.Add(24*time.Hour), end)
+	assert.True(t, ws.AllDay())
+	assert.False(t, Windows(nil).AllDay())
+}
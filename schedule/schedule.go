@@ -0,0 +1,58 @@
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Schedule tells when check cycles should run
+type Schedule interface {
+	// Next returns the first run time after `t`, zero if there is none
+	Next(t time.Time) time.Time
+}
+
+// Every runs cycles at a fixed interval
+type Every time.Duration
+
+func (e Every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+func (e Every) String() string {
+	return "every " + time.Duration(e).String()
+}
+
+// Union runs cycles whenever any of its schedules does
+type Union []Schedule
+
+func (u Union) Next(t time.Time) time.Time {
+	var next time.Time
+	for _, s := range u {
+		if n := s.Next(t); !n.IsZero() && (next.IsZero() || n.Before(next)) {
+			next = n
+		}
+	}
+	return next
+}
+
+func (u Union) String() string {
+	list := make([]string, len(u))
+	for i, s := range u {
+		list[i] = fmt.Sprint(s)
+	}
+	return strings.Join(list, "; ")
+}
+
+// Parse returns the union of cron expressions `exprs` evaluated in `loc`
+func Parse(exprs []string, loc *time.Location) (Union, error) {
+	u := make(Union, 0, len(exprs))
+	for _, expr := range exprs {
+		c, err := ParseCron(expr, loc)
+		if err != nil {
+			return nil, err
+		}
+		u = append(u, c)
+	}
+	return u, nil
+}
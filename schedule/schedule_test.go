@@ -0,0 +1,32 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvery(t *testing.T) {
+	at := time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, at.Add(time.Minute), Every(time.Minute).Next(at))
+	assert.Equal(t, "every 1m0s", Every(time.Minute).String())
+}
+
+func TestUnion(t *testing.T) {
+	// Every 5 minutes during business hours, hourly at night
+	u, err := Parse([]string{"*/5 9-17 * * *", "0 0-8,18-23 * * *"}, time.UTC)
+	require.NoError(t, err)
+	var runs []string
+	at := time.Date(2021, 8, 1, 17, 44, 0, 0, time.UTC)
+	for i := 0; i < 6; i++ {
+		at = u.Next(at)
+		runs = append(runs, at.Format("15:04"))
+	}
+	assert.Equal(t, []string{"17:45", "17:50", "17:55", "18:00", "19:00", "20:00"}, runs)
+	assert.Equal(t, "*/5 9-17 * * * UTC; 0 0-8,18-23 * * * UTC", u.String())
+	_, err = Parse([]string{"@daily", "bad"}, time.UTC)
+	assert.Error(t, err)
+	assert.True(t, Union{}.Next(at).IsZero())
+}
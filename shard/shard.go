@@ -0,0 +1,84 @@
+package shard
+
+import (
+	"errors"
+	"hash/fnv"
+)
+
+// Key assignment modes
+const (
+	// ModeModulo assigns key to hash(key) mod count shard, most keys move when count changes
+	ModeModulo = "modulo"
+	// ModeRendezvous assigns key to the shard with the highest hash(key, shard),
+	// only keys of added or removed shards move when count changes
+	ModeRendezvous = "rendezvous"
+)
+
+// Sharder decides whether a key belongs to this instance
+type Sharder struct {
+	index int
+	count int
+	owner func(key []byte, count int) int
+}
+
+// New returns Sharder for instance `index` out of `count` instances
+func New(index, count int, mode string) (*Sharder, error) {
+	if count < 1 {
+		return nil, errors.New("shard count should be greater than zero")
+	}
+	if index < 0 || index >= count {
+		return nil, errors.New("shard index should be in [0, count) range")
+	}
+	s := &Sharder{index: index, count: count}
+	switch mode {
+	case ModeModulo:
+		s.owner = modulo
+	case ModeRendezvous:
+		s.owner = rendezvous
+	default:
+		return nil, errors.New("shard mode should be either " + ModeModulo + " or " + ModeRendezvous)
+	}
+	return s, nil
+}
+
+// Owns tells whether `key` belongs to this instance
+func (s *Sharder) Owns(key []byte) bool {
+	return s.owner(key, s.count) == s.index
+}
+
+// Owner returns the shard index `key` belongs to
+func (s *Sharder) Owner(key []byte) int {
+	return s.owner(key, s.count)
+}
+
+func modulo(key []byte, count int) int {
+	return int(hash(key) % uint64(count))
+}
+
+func rendezvous(key []byte, count int) int {
+	base := hash(key)
+	best, bestScore := 0, uint64(0)
+	for i := 0; i < count; i++ {
+		if score := mix(base ^ mix(uint64(i)+1)); score > bestScore || i == 0 {
+			best, bestScore = i, score
+		}
+	}
+	return best
+}
+
+// hash returns FNV-1a hash of `key`
+func hash(key []byte) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write(key)
+	return mix(h.Sum64())
+}
+
+// mix is splitmix64 finalizer, spreads close inputs over the whole range
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
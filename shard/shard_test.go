@@ -0,0 +1,74 @@
+package shard
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	_, err := New(0, 0, ModeModulo)
+	assert.EqualError(t, err, "shard count should be greater than zero")
+	_, err = New(2, 2, ModeModulo)
+	assert.EqualError(t, err, "shard index should be in [0, count) range")
+	_, err = New(-1, 2, ModeModulo)
+	assert.EqualError(t, err, "shard index should be in [0, count) range")
+	_, err = New(0, 2, "random")
+	assert.EqualError(t, err, "shard mode should be either modulo or rendezvous")
+}
+
+func TestDisjoint(t *testing.T) {
+	for _, mode := range []string{ModeModulo, ModeRendezvous} {
+		t.Run(mode, func(t *testing.T) {
+			const count, keys = 5, 10000
+			var shards []*Sharder
+			for i := 0; i < count; i++ {
+				s, err := New(i, count, mode)
+				if err != nil {
+					panic(err)
+				}
+				shards = append(shards, s)
+			}
+			sizes := make([]int, count)
+			for k := 0; k < keys; k++ {
+				key := testKey(k)
+				owners := 0
+				for i, s := range shards {
+					if s.Owns(key) {
+						owners++
+						sizes[i]++
+					}
+				}
+				assert.Equal(t, 1, owners, "every key should have exactly one owner")
+			}
+			for _, size := range sizes {
+				assert.InDelta(t, keys/count, size, keys/count/10, "keys should be spread evenly")
+			}
+		})
+	}
+}
+
+func TestRebalance(t *testing.T) {
+	const keys = 10000
+	moved := func(mode string) int {
+		before, _ := New(0, 4, mode)
+		after, _ := New(0, 5, mode)
+		n := 0
+		for k := 0; k < keys; k++ {
+			if before.Owner(testKey(k)) != after.Owner(testKey(k)) {
+				n++
+			}
+		}
+		return n
+	}
+	// Ideally 1/5 of keys move to the new shard
+	assert.InDelta(t, keys/5, moved(ModeRendezvous), keys/50)
+	assert.Greater(t, moved(ModeModulo), keys/2)
+}
+
+func testKey(k int) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key[8:], uint64(k))
+	return key
+}
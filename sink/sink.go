@@ -0,0 +1,140 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmitry-vovk/csv-chg-go/api"
+)
+
+// Sink delivers alerts
+type Sink interface {
+	Send(uuid string, alert *api.Alert) error
+}
+
+// ContextSink is a Sink making requests with context, e.g. to carry trace span
+type ContextSink interface {
+	Sink
+	SendContext(ctx context.Context, uuid string, alert *api.Alert) error
+}
+
+// AlertPoster is implemented by warehouse API client
+type AlertPoster interface {
+	PostAlert(uuid string, alert *api.Alert) error
+}
+
+// contextAlertPoster is implemented by API clients making requests with context
+type contextAlertPoster interface {
+	PostAlertContext(ctx context.Context, uuid string, alert *api.Alert) error
+}
+
+// API delivers alerts to warehouse API `/low-stock-alert/{uuid}` endpoint
+type API struct {
+	Client AlertPoster
+}
+
+func (s API) Send(uuid string, alert *api.Alert) error {
+	return s.Client.PostAlert(uuid, alert)
+}
+
+func (s API) SendContext(ctx context.Context, uuid string, alert *api.Alert) error {
+	if c, ok := s.Client.(contextAlertPoster); ok {
+		return c.PostAlertContext(ctx, uuid, alert)
+	}
+	return s.Client.PostAlert(uuid, alert)
+}
+
+// Log writes alerts to a logger
+type Log struct {
+	Logger *log.Logger // Nil for the standard logger
+}
+
+func (s Log) Send(uuid string, alert *api.Alert) error {
+	printf := log.Printf
+	if s.Logger != nil {
+		printf = s.Logger.Printf
+	}
+	printf("Alert %s for item %q: quantity %d, reason %s, rules %s", alert.Severity, uuid, alert.Quantity, alert.Reason, strings.Join(alert.Rules, ", "))
+	return nil
+}
+
+// Webhook posts alerts as JSON to an arbitrary URL
+type Webhook struct {
+	url        string
+	httpClient *http.Client
+}
+
+const webhookTimeout = 30 * time.Second
+
+// NewWebhook returns Webhook sink posting to `url`
+func NewWebhook(url string) *Webhook {
+	return &Webhook{
+		url:        url,
+		httpClient: &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+// webhookPayload is alert with item UUID
+type webhookPayload struct {
+	UUID string `json:"uuid"`
+	*api.Alert
+}
+
+func (s *Webhook) Send(uuid string, alert *api.Alert) error {
+	return s.SendContext(context.Background(), uuid, alert)
+}
+
+func (s *Webhook) SendContext(ctx context.Context, uuid string, alert *api.Alert) error {
+	b, err := json.Marshal(webhookPayload{UUID: uuid, Alert: alert})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", alert.IdempotencyKey(uuid))
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return ErrBadResponseCode{code: resp.StatusCode}
+	}
+	return nil
+}
+
+// ErrBadResponseCode is returned when webhook responds with non-2xx status code
+type ErrBadResponseCode struct {
+	code int
+}
+
+func (e ErrBadResponseCode) Error() string {
+	return "webhook responded with status code " + strconv.Itoa(e.code)
+}
+
+// ErrUnknownSink is returned for sink specification that can't be parsed
+var ErrUnknownSink = errors.New("sink should be 'api', 'log' or http(s) URL")
+
+// New returns sink by specification:
+// `api` for warehouse API, `log` for logging, or webhook URL
+func New(spec string, client AlertPoster) (Sink, error) {
+	switch {
+	case spec == "api":
+		return API{Client: client}, nil
+	case spec == "log":
+		return Log{}, nil
+	case strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://"):
+		return NewWebhook(spec), nil
+	}
+	return nil, ErrUnknownSink
+}
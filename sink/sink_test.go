@@ -0,0 +1,123 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dmitry-vovk/csv-chg-go/api"
+	"github.com/stretchr/testify/assert"
+)
+
+const uuid = "767d967f-b55b-4457-bfee-685eaa6d0583"
+
+var alert = &api.Alert{
+	Quantity:   0,
+	Threshold:  5,
+	Name:       "item",
+	ObservedAt: time.Date(2021, 2, 9, 10, 0, 0, 0, time.UTC),
+	Reason:     api.ReasonRule,
+	Severity:   "critical",
+	Rules:      []string{"out_of_stock"},
+}
+
+func TestNew(t *testing.T) {
+	c := &poster{}
+	if s, err := New("api", c); assert.NoError(t, err) {
+		assert.NoError(t, s.Send(uuid, alert))
+		assert.Equal(t, []string{uuid}, c.posted)
+	}
+	if s, err := New("log", c); assert.NoError(t, err) {
+		assert.Equal(t, Log{}, s)
+	}
+	if s, err := New("https://hooks.example.com/alerts", c); assert.NoError(t, err) {
+		assert.Equal(t, "https://hooks.example.com/alerts", s.(*Webhook).url)
+	}
+	_, err := New("smtp://mail", c)
+	assert.Equal(t, ErrUnknownSink, err)
+}
+
+func TestLog(t *testing.T) {
+	logBuffer := &bytes.Buffer{}
+	log.SetOutput(logBuffer)
+	log.SetFlags(0)
+	defer log.SetOutput(os.Stderr)
+	assert.NoError(t, Log{}.Send(uuid, alert))
+	assert.Equal(t, "Alert critical for item \"767d967f-b55b-4457-bfee-685eaa6d0583\": quantity 0, reason rule, rules out_of_stock\n", logBuffer.String())
+	own := &bytes.Buffer{}
+	assert.NoError(t, Log{Logger: log.New(own, "[london] ", 0)}.Send(uuid, alert))
+	assert.Equal(t, "[london] Alert critical for item \"767d967f-b55b-4457-bfee-685eaa6d0583\": quantity 0, reason rule, rules out_of_stock\n", own.String())
+}
+
+func TestWebhook(t *testing.T) {
+	var (
+		body   []byte
+		header http.Header
+	)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bad" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, _ = ioutil.ReadAll(r.Body)
+		header = r.Header
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	if assert.NoError(t, NewWebhook(s.URL).Send(uuid, alert)) {
+		var payload map[string]interface{}
+		if assert.NoError(t, json.Unmarshal(body, &payload)) {
+			assert.Equal(t, uuid, payload["uuid"])
+			assert.Equal(t, "critical", payload["severity"])
+		}
+		assert.Equal(t, "application/json", header.Get("Content-Type"))
+		assert.Equal(t, alert.IdempotencyKey(uuid), header.Get("Idempotency-Key"))
+	}
+	if err := NewWebhook(s.URL+"/bad").Send(uuid, alert); assert.Error(t, err) {
+		assert.Equal(t, "webhook responded with status code 500", err.Error())
+	}
+	s.Close()
+	assert.Error(t, NewWebhook(s.URL).Send(uuid, alert))
+	assert.Error(t, NewWebhook("http://bad host").Send(uuid, alert))
+}
+
+func TestSendContext(t *testing.T) {
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "span")
+	c := &contextPoster{}
+	assert.NoError(t, API{Client: c}.SendContext(ctx, uuid, alert))
+	assert.Equal(t, "span", c.ctx.Value(key{}))
+	p := &poster{}
+	assert.NoError(t, API{Client: p}.SendContext(ctx, uuid, alert))
+	assert.Equal(t, []string{uuid}, p.posted)
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	err := NewWebhook("http://127.0.0.1:1").SendContext(canceled, uuid, alert)
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+type poster struct {
+	posted []string
+}
+
+func (p *poster) PostAlert(uuid string, _ *api.Alert) error {
+	p.posted = append(p.posted, uuid)
+	return nil
+}
+
+type contextPoster struct {
+	poster
+	ctx context.Context
+}
+
+func (p *contextPoster) PostAlertContext(ctx context.Context, uuid string, alert *api.Alert) error {
+	p.ctx = ctx
+	return p.PostAlert(uuid, alert)
+}
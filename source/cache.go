@@ -0,0 +1,96 @@
+package source
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// cache keeps remote content on local disk along with its validators
+type cache struct {
+	dir string
+}
+
+// cacheMeta holds validators of cached content
+type cacheMeta struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// setConditions adds conditional request headers
+func (m cacheMeta) setConditions(h http.Header) {
+	if m.ETag != "" {
+		h.Set("If-None-Match", m.ETag)
+	}
+	if m.LastModified != "" {
+		h.Set("If-Modified-Since", m.LastModified)
+	}
+}
+
+// hash returns hex encoded SHA-256 of `src`
+func hash(src string) string {
+	sum := sha256.Sum256([]byte(src))
+	return hex.EncodeToString(sum[:])
+}
+
+// key returns file name prefix for `src`, its hash, so credentials in URL are not written to disk
+func (c cache) key(src string) string {
+	return filepath.Join(c.dir, hash(src))
+}
+
+func (c cache) dataPath(src string) string { return c.key(src) + ".data" }
+func (c cache) metaPath(src string) string { return c.key(src) + ".meta" }
+
+// meta returns validators of cached `src`, or nil if there is no usable cache entry
+func (c cache) meta(src string) *cacheMeta {
+	b, err := ioutil.ReadFile(c.metaPath(src))
+	if err != nil {
+		return nil
+	}
+	var m cacheMeta
+	if err = json.Unmarshal(b, &m); err != nil || (m.ETag == "" && m.LastModified == "") {
+		return nil
+	}
+	if _, err = os.Stat(c.dataPath(src)); err != nil {
+		return nil
+	}
+	return &m
+}
+
+// store saves response body and validators,
+// partially written files never replace previous cache entry
+func (c cache) store(src string, resp *http.Response) error {
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(c.dir, "download-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err = io.Copy(tmp, resp.Body); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	// Drop stale validators before replacing data
+	_ = os.Remove(c.metaPath(src))
+	if err = os.Rename(tmp.Name(), c.dataPath(src)); err != nil {
+		return err
+	}
+	b, err := json.Marshal(cacheMeta{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.metaPath(src), b, 0o644)
+}
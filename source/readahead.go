@@ -0,0 +1,96 @@
+package source
+
+import (
+	"io"
+	"sync"
+)
+
+const (
+	readAheadBuffers = 4         // Buffers filled ahead of the consumer
+	readAheadSize    = 256 << 10 // Size of a buffer
+)
+
+// readAhead reads from the underlying reader in its own goroutine, so decompression
+// runs in parallel with the consumer instead of taking turns with it
+type readAhead struct {
+	filled  chan []byte   // Buffers holding data, closed after the last one
+	free    chan []byte   // Buffers consumed and ready to be filled again
+	done    chan struct{} // Closed to stop reading
+	stopped chan struct{} // Closed once reading has stopped
+	once    sync.Once
+	err     error  // Error the underlying reader ended with, io.EOF at the end of data
+	held    []byte // Buffer being consumed
+	rest    []byte // Unread part of `held`
+}
+
+// newReadAhead starts reading `r` ahead, Close should be called once the reader is not needed
+func newReadAhead(r io.Reader) *readAhead {
+	ra := &readAhead{
+		filled:  make(chan []byte, readAheadBuffers),
+		free:    make(chan []byte, readAheadBuffers),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	for i := 0; i < readAheadBuffers; i++ {
+		ra.free <- make([]byte, readAheadSize)
+	}
+	go ra.fill(r)
+	return ra
+}
+
+// fill reads `r` into free buffers until the data ends or the reader is closed
+func (ra *readAhead) fill(r io.Reader) {
+	defer close(ra.stopped)
+	defer close(ra.filled)
+	for {
+		var b []byte
+		select {
+		case b = <-ra.free:
+		case <-ra.done:
+			return
+		}
+		n, err := io.ReadFull(r, b[:cap(b)])
+		if n > 0 {
+			select {
+			case ra.filled <- b[:n]:
+			case <-ra.done:
+				return
+			}
+		}
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		if err != nil {
+			ra.err = err
+			return
+		}
+	}
+}
+
+func (ra *readAhead) Read(p []byte) (int, error) {
+	if len(ra.rest) == 0 {
+		if ra.held != nil {
+			ra.free <- ra.held[:cap(ra.held)]
+			ra.held = nil
+		}
+		b, ok := <-ra.filled
+		if !ok {
+			if ra.err == nil {
+				return 0, io.ErrClosedPipe
+			}
+			return 0, ra.err
+		}
+		ra.held, ra.rest = b, b
+	}
+	n := copy(p, ra.rest)
+	ra.rest = ra.rest[n:]
+	return n, nil
+}
+
+// Close stops reading ahead and waits for the read in progress to finish,
+// so the underlying reader can be closed after it, it is not closed by Close
+func (ra *readAhead) Close() error {
+	ra.once.Do(func() { close(ra.done) })
+	<-ra.stopped
+	return nil
+}
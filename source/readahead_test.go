@@ -0,0 +1,73 @@
+package source
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadAhead(t *testing.T) {
+	// Several times the buffers, so they get reused
+	data := make([]byte, 3*readAheadBuffers*readAheadSize+123)
+	rand.New(rand.NewSource(1)).Read(data)
+	ra := newReadAhead(bytes.NewReader(data))
+	b, err := ioutil.ReadAll(ra)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(data, b))
+	assert.NoError(t, ra.Close())
+	// Error of the underlying reader follows the data read before it
+	failed := errors.New("failed")
+	ra = newReadAhead(io.MultiReader(bytes.NewReader([]byte("data")), errorReader{failed}))
+	b, err = ioutil.ReadAll(ra)
+	assert.Equal(t, failed, err)
+	assert.Equal(t, []byte("data"), b)
+	assert.NoError(t, ra.Close())
+	// Closing stops reading ahead
+	ra = newReadAhead(bytes.NewReader(data))
+	assert.NoError(t, ra.Close())
+	assert.NoError(t, ra.Close())
+	// Buffers filled before closing can still be read
+	for err = nil; err == nil; {
+		_, err = ra.Read(make([]byte, readAheadSize))
+	}
+	assert.Equal(t, io.ErrClosedPipe, err)
+	// Closing waits for the read in progress
+	r := &blockingReader{started: make(chan struct{}), release: make(chan struct{})}
+	ra = newReadAhead(r)
+	<-r.started
+	closed := make(chan struct{})
+	go func() {
+		assert.NoError(t, ra.Close())
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("closed while reading")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(r.release)
+	<-closed
+}
+
+// blockingReader blocks in the first read until released
+type blockingReader struct {
+	started, release chan struct{}
+}
+
+func (r *blockingReader) Read([]byte) (int, error) {
+	close(r.started)
+	<-r.release
+	return 0, io.EOF
+}
+
+type errorReader struct {
+	err error
+}
+
+func (r errorReader) Read([]byte) (int, error) { return 0, r.err }
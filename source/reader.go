@@ -3,35 +3,36 @@ package source
 import (
 	"compress/bzip2"
 	"compress/gzip"
-	"errors"
 	"io"
-	"net/http"
 	"os"
-	"strconv"
 	"strings"
 )
 
 // ReadAny attempts to call `fn` with `io.Reader` made from `src`.
 // `src` may be a path to a local file (can be compressed gzip/bzip2),
-// or URL, or `--` for OS stdin stream
+// or URL, or `--` for OS stdin stream.
+// Remote sources are fetched with default Reader settings.
 func ReadAny(src string, fn func(io.Reader) error) error {
+	return New().ReadAny(src, fn)
+}
+
+// ReadAny is the same as package level ReadAny, but uses `r` settings to fetch remote sources
+func (r *Reader) ReadAny(src string, fn func(io.Reader) error) error {
 	// StdIn
 	if src == "--" {
 		return fn(os.Stdin)
 	}
 	// Remote URL
 	if strings.HasPrefix(src, "https://") || strings.HasPrefix(src, "http://") {
-		resp, err := http.Get(src)
-		if err != nil {
-			return err
-		}
-		defer func() { _ = resp.Body.Close() }()
-		if resp.StatusCode == http.StatusOK {
-			return fn(resp.Body)
-		}
-		return errors.New("bad response code " + strconv.Itoa(resp.StatusCode))
+		return r.fetch(src, fn)
 	}
 	// Local file
+	return readFile(src, fn)
+}
+
+// readFile opens local file `src` and calls `fn` with its (decompressed if needed) content.
+// Compressed content is decompressed ahead in a separate goroutine.
+func readFile(src string, fn func(io.Reader) error) error {
 	f, err := os.Open(src)
 	if err != nil {
 		return err
@@ -44,9 +45,16 @@ func ReadAny(src string, fn func(io.Reader) error) error {
 			return err
 		}
 		defer func() { _ = z.Close() }()
-		return fn(z)
+		return readAheadOf(z, fn)
 	} else if strings.HasSuffix(src, ".bz2") {
-		return fn(bzip2.NewReader(f))
+		return readAheadOf(bzip2.NewReader(f), fn)
 	}
 	return fn(f)
 }
+
+// readAheadOf calls `fn` with `r` read ahead
+func readAheadOf(r io.Reader, fn func(io.Reader) error) error {
+	ra := newReadAhead(r)
+	defer func() { _ = ra.Close() }()
+	return fn(ra)
+}
@@ -0,0 +1,162 @@
+package source
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Reader holds settings used to fetch remote sources
+type Reader struct {
+	header       http.Header   // Extra headers sent with every request
+	timeout      time.Duration // Overall request timeout, zero means no timeout
+	retries      int           // Number of retries after failed attempt
+	backoff      time.Duration // Delay before the first retry, doubled for every next one
+	maxRedirects int           // Maximum number of redirects to follow, zero disables following
+	cache        *cache        // Local cache for conditional requests, nil if disabled
+}
+
+const (
+	defaultBackoff      = time.Second
+	defaultMaxRedirects = 10
+)
+
+// ErrTooManyRedirects is returned when remote source redirects more than allowed
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+// ErrBadResponseCode is returned when remote source responds with unexpected status code
+type ErrBadResponseCode struct {
+	code int
+}
+
+func (e ErrBadResponseCode) Error() string {
+	return "bad response code " + strconv.Itoa(e.code)
+}
+
+// New returns an instance of Reader with default settings
+func New() *Reader {
+	return &Reader{
+		header:       make(http.Header),
+		backoff:      defaultBackoff,
+		maxRedirects: defaultMaxRedirects,
+	}
+}
+
+// WithHeader adds a header to be sent with remote requests
+func (r *Reader) WithHeader(key, value string) *Reader {
+	r.header.Add(key, value)
+	return r
+}
+
+// WithBearerToken sets bearer token authorization for remote requests
+func (r *Reader) WithBearerToken(token string) *Reader {
+	r.header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+// WithBasicAuth sets basic authorization for remote requests
+func (r *Reader) WithBasicAuth(username, password string) *Reader {
+	req := http.Request{Header: make(http.Header)}
+	req.SetBasicAuth(username, password)
+	r.header.Set("Authorization", req.Header.Get("Authorization"))
+	return r
+}
+
+// WithTimeout sets the overall remote request timeout, including reading the body
+func (r *Reader) WithTimeout(timeout time.Duration) *Reader {
+	r.timeout = timeout
+	return r
+}
+
+// WithRetries sets the number of retries and initial delay between them
+func (r *Reader) WithRetries(retries int, backoff time.Duration) *Reader {
+	r.retries = retries
+	r.backoff = backoff
+	return r
+}
+
+// WithMaxRedirects sets the number of redirects to follow, zero disables redirects
+func (r *Reader) WithMaxRedirects(n int) *Reader {
+	r.maxRedirects = n
+	return r
+}
+
+// WithCacheDir enables conditional requests with remote content cached in `dir`
+func (r *Reader) WithCacheDir(dir string) *Reader {
+	r.cache = &cache{dir: dir}
+	return r
+}
+
+// httpClient builds HTTP client according to settings
+func (r *Reader) httpClient() *http.Client {
+	return &http.Client{
+		Timeout: r.timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > r.maxRedirects {
+				return ErrTooManyRedirects
+			}
+			return nil
+		},
+	}
+}
+
+// fetch requests `src` and calls `fn` with response body,
+// or cached content if remote has not been modified since last fetch
+func (r *Reader) fetch(src string, fn func(io.Reader) error) error {
+	req, err := http.NewRequest(http.MethodGet, src, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range r.header {
+		req.Header[k] = v
+	}
+	var meta *cacheMeta
+	if r.cache != nil {
+		if meta = r.cache.meta(src); meta != nil {
+			meta.setConditions(req.Header)
+		}
+	}
+	resp, err := r.do(r.httpClient(), req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	switch {
+	case resp.StatusCode == http.StatusNotModified && meta != nil:
+		return readFile(r.cache.dataPath(src), fn)
+	case resp.StatusCode != http.StatusOK:
+		return ErrBadResponseCode{code: resp.StatusCode}
+	case r.cache != nil:
+		if err = r.cache.store(src, resp); err != nil {
+			return err
+		}
+		return readFile(r.cache.dataPath(src), fn)
+	}
+	return fn(resp.Body)
+}
+
+// do performs the request, retrying on network errors and server side failures
+func (r *Reader) do(client *http.Client, req *http.Request) (*http.Response, error) {
+	delay := r.backoff
+	for attempt := 0; ; attempt++ {
+		resp, err := client.Do(req)
+		if attempt == r.retries || !retryable(resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// retryable tells whether request could succeed if repeated
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, ErrTooManyRedirects)
+	}
+	return resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests
+}
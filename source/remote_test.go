@@ -0,0 +1,140 @@
+package source
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReaderHeaders(t *testing.T) {
+	var got http.Header
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		_, _ = w.Write(expect)
+	}))
+	defer s.Close()
+	t.Run("bearer", func(t *testing.T) {
+		r := reader{}
+		if err := New().WithBearerToken("secret").WithHeader("X-Team", "stock").ReadAny(s.URL, r.read); assert.NoError(t, err) {
+			assert.Equal(t, expect, r.content)
+			assert.Equal(t, "Bearer secret", got.Get("Authorization"))
+			assert.Equal(t, "stock", got.Get("X-Team"))
+		}
+	})
+	t.Run("basic", func(t *testing.T) {
+		r := reader{}
+		if err := New().WithBasicAuth("user", "pass").ReadAny(s.URL, r.read); assert.NoError(t, err) {
+			assert.Equal(t, "Basic dXNlcjpwYXNz", got.Get("Authorization"))
+		}
+	})
+}
+
+func TestReaderRetries(t *testing.T) {
+	var calls int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write(expect)
+	}))
+	defer s.Close()
+	t.Run("exhausted", func(t *testing.T) {
+		r := reader{}
+		if err := New().WithRetries(1, time.Millisecond).ReadAny(s.URL, r.read); assert.Error(t, err) {
+			assert.Equal(t, ErrBadResponseCode{code: http.StatusServiceUnavailable}, err)
+			assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+		}
+	})
+	t.Run("recovered", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		r := reader{}
+		if err := New().WithRetries(2, time.Millisecond).ReadAny(s.URL, r.read); assert.NoError(t, err) {
+			assert.Equal(t, expect, r.content)
+			assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+		}
+	})
+}
+
+func TestReaderTimeout(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		_, _ = w.Write(expect)
+	}))
+	defer s.Close()
+	r := reader{}
+	assert.Error(t, New().WithTimeout(10*time.Millisecond).ReadAny(s.URL, r.read))
+}
+
+func TestReaderRedirects(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/file" {
+			_, _ = w.Write(expect)
+			return
+		}
+		http.Redirect(w, r, "/file", http.StatusFound)
+	}))
+	defer s.Close()
+	t.Run("followed", func(t *testing.T) {
+		r := reader{}
+		if err := New().ReadAny(s.URL+"/moved", r.read); assert.NoError(t, err) {
+			assert.Equal(t, expect, r.content)
+		}
+	})
+	t.Run("disabled", func(t *testing.T) {
+		r := reader{}
+		if err := New().WithMaxRedirects(0).WithRetries(3, time.Millisecond).ReadAny(s.URL+"/moved", r.read); assert.Error(t, err) {
+			assert.True(t, errors.Is(err, ErrTooManyRedirects))
+		}
+	})
+}
+
+func TestReaderCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "source-cache")
+	if err != nil {
+		panic(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	var downloads int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		atomic.AddInt32(&downloads, 1)
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write(expect)
+	}))
+	defer s.Close()
+	src := New().WithCacheDir(dir)
+	for i := 0; i < 3; i++ {
+		r := reader{}
+		if err = src.ReadAny(s.URL, r.read); assert.NoError(t, err) {
+			assert.Equal(t, expect, r.content)
+		}
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&downloads))
+	// Cache entry without data is ignored
+	assert.NoError(t, os.Remove(src.cache.dataPath(s.URL)))
+	r := reader{}
+	if err = src.ReadAny(s.URL, r.read); assert.NoError(t, err) {
+		assert.Equal(t, expect, r.content)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&downloads))
+	// Credentials in URL are not written to the cache
+	withAuth := strings.Replace(s.URL, "://", "://user:pass@", 1)
+	if err = src.ReadAny(withAuth, r.read); assert.NoError(t, err) {
+		b, err := ioutil.ReadFile(src.cache.metaPath(withAuth))
+		if assert.NoError(t, err) {
+			assert.NotContains(t, string(b), "pass")
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package trace
+
+import (
+	"context"
+	"io"
+	"net/url"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+)
+
+// NewWriterExporter returns exporter writing spans to `w` as JSON, e.g. to stdout or a file
+func NewWriterExporter(w io.Writer) (sdktrace.SpanExporter, error) {
+	return stdouttrace.New(stdouttrace.WithWriter(w))
+}
+
+// NewOTLPExporter returns exporter sending spans to OTLP/HTTP collector at `collectorURL`,
+// e.g. `http://localhost:4318/v1/traces`
+func NewOTLPExporter(collectorURL string) (sdktrace.SpanExporter, error) {
+	u, err := url.Parse(collectorURL)
+	if err != nil {
+		return nil, err
+	}
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host)}
+	if u.Path != "" {
+		opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+	}
+	if u.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	return otlptracehttp.New(context.Background(), opts...)
+}
+
+// serviceResource describes the service producing spans
+func serviceResource(service string) *resource.Resource {
+	return resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(service))
+}
@@ -0,0 +1,210 @@
+// Package trace records check cycles, item checks and API requests as OpenTelemetry spans
+package trace
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// Span kinds used by the service
+const (
+	KindInternal = oteltrace.SpanKindInternal
+	KindClient   = oteltrace.SpanKindClient
+)
+
+// Batching of finished spans
+const (
+	maxBatch  = 512
+	queueSize = 4096
+)
+
+// Tracer starts spans and exports sampled ones in batches in the background.
+// Methods of nil Tracer and nil Span do nothing, so tracing can be disabled at no cost.
+type Tracer struct {
+	provider  *sdktrace.TracerProvider
+	tracer    oteltrace.Tracer
+	gate      *gate
+	closeOnce *sync.Once
+	attrs     []attribute.KeyValue // Added to every span started by the tracer
+}
+
+// New returns a tracer exporting spans of `service` with `exporter`, it should be closed to export remaining spans.
+// Only `ratio` of traces started by the tracer, from 0 to 1, are sampled and exported.
+func New(exporter sdktrace.SpanExporter, service string, ratio float64) *Tracer {
+	g := &gate{}
+	g.SpanProcessor = sdktrace.NewBatchSpanProcessor(
+		&gatedExporter{SpanExporter: exporter, gate: g},
+		sdktrace.WithMaxQueueSize(queueSize),
+		sdktrace.WithMaxExportBatchSize(maxBatch),
+	)
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithSpanProcessor(g),
+		sdktrace.WithResource(serviceResource(service)),
+	)
+	return &Tracer{
+		provider:  provider,
+		tracer:    provider.Tracer("github.com/dmitry-vovk/csv-chg-go"),
+		gate:      g,
+		closeOnce: &sync.Once{},
+	}
+}
+
+// With returns a tracer adding `key`, `value` attribute to its spans, sharing the export with `t`
+func (t *Tracer) With(key string, value interface{}) *Tracer {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	c.attrs = append(append([]attribute.KeyValue(nil), t.attrs...), attributeOf(key, value))
+	return &c
+}
+
+// Start starts an internal span, child of the span in `ctx` if any, and returns context carrying it
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	return t.StartKind(ctx, name, KindInternal)
+}
+
+// StartKind starts a span of `kind`, child of the span in `ctx` if any, and returns context carrying it
+func (t *Tracer) StartKind(ctx context.Context, name string, kind oteltrace.SpanKind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	ctx, s := t.tracer.Start(ctx, name, oteltrace.WithSpanKind(kind), oteltrace.WithAttributes(t.attrs...))
+	return ctx, &Span{span: s}
+}
+
+// Flush exports spans finished so far
+func (t *Tracer) Flush() {
+	if t == nil {
+		return
+	}
+	_ = t.provider.ForceFlush(context.Background())
+}
+
+// Close exports remaining spans and stops the tracer, spans ending later are not exported
+func (t *Tracer) Close() {
+	if t == nil {
+		return
+	}
+	t.closeOnce.Do(func() {
+		if err := t.provider.Shutdown(context.Background()); err != nil {
+			log.Printf("Error exporting spans: %s", err)
+		}
+		if dropped := t.Dropped(); dropped > 0 {
+			log.Printf("Dropped %d spans as export could not keep up, consider lowering -trace-sample", dropped)
+		}
+	})
+}
+
+// Dropped returns the number of sampled spans dropped because export could not keep up
+func (t *Tracer) Dropped() uint64 {
+	if t == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&t.gate.dropped)
+}
+
+// gate limits sampled spans waiting for export to the batch processor queue size
+// and counts the spans it turns away, the batch processor drops them without telling
+type gate struct {
+	queued  int64  // Spans passed to the batch processor and not exported yet, first for atomic alignment
+	dropped uint64 // Spans turned away for full queue
+	sdktrace.SpanProcessor
+}
+
+func (g *gate) OnEnd(s sdktrace.ReadOnlySpan) {
+	if !s.SpanContext().IsSampled() {
+		return
+	}
+	if atomic.AddInt64(&g.queued, 1) > queueSize {
+		atomic.AddInt64(&g.queued, -1)
+		atomic.AddUint64(&g.dropped, 1)
+		return
+	}
+	g.SpanProcessor.OnEnd(s)
+}
+
+// gatedExporter releases exported spans from the gate
+type gatedExporter struct {
+	sdktrace.SpanExporter
+	gate *gate
+}
+
+func (e *gatedExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	defer atomic.AddInt64(&e.gate.queued, -int64(len(spans)))
+	return e.SpanExporter.ExportSpans(ctx, spans)
+}
+
+// Span is an operation being traced
+type Span struct {
+	span oteltrace.Span
+}
+
+// FromContext returns the span carried by `ctx`, nil if none
+func FromContext(ctx context.Context) *Span {
+	s := oteltrace.SpanFromContext(ctx)
+	if !s.SpanContext().IsValid() {
+		return nil
+	}
+	return &Span{span: s}
+}
+
+// Context returns IDs of the span to propagate to other services
+func (s *Span) Context() oteltrace.SpanContext {
+	if s == nil {
+		return oteltrace.SpanContext{}
+	}
+	return s.span.SpanContext()
+}
+
+// SetAttribute records `key`, `value` property of the span
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.span.SetAttributes(attributeOf(key, value))
+}
+
+// SetError marks the span failed with `err`, nil error is ignored
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// End finishes the span and queues it for export if sampled, later calls do nothing
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.span.End()
+}
+
+// attributeOf converts `value` to a span attribute, unknown types are formatted as strings
+func attributeOf(key string, value interface{}) attribute.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case float64:
+		return attribute.Float64(key, v)
+	case fmt.Stringer:
+		return attribute.Stringer(key, v)
+	}
+	return attribute.String(key, fmt.Sprint(value))
+}
@@ -0,0 +1,183 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// recorder is an exporter keeping exported spans after shutdown
+type recorder struct {
+	*tracetest.InMemoryExporter
+}
+
+func newRecorder() recorder {
+	return recorder{InMemoryExporter: tracetest.NewInMemoryExporter()}
+}
+
+func (recorder) Shutdown(context.Context) error { return nil }
+
+func TestTracer(t *testing.T) {
+	r := newRecorder()
+	tracer := New(r, "svc", 1).With("warehouse", "london")
+	ctx, cycle := tracer.Start(context.Background(), "cycle")
+	_, process := tracer.StartKind(ctx, "process", KindClient)
+	process.SetAttribute("item.id", "1")
+	process.SetAttribute("item.quantity", 2)
+	process.SetError(errors.New("failed"))
+	process.SetError(nil)
+	process.End()
+	process.End()
+	cycle.End()
+	assert.Equal(t, cycle.Context(), FromContext(ctx).Context())
+	tracer.Flush()
+	spans := r.GetSpans()
+	if assert.Len(t, spans, 2) {
+		p, c := spans[0], spans[1]
+		assert.Equal(t, "process", p.Name)
+		assert.Equal(t, oteltrace.SpanKindClient, p.SpanKind)
+		assert.Equal(t, c.SpanContext.TraceID(), p.SpanContext.TraceID())
+		assert.Equal(t, c.SpanContext.SpanID(), p.Parent.SpanID())
+		assert.NotEqual(t, c.SpanContext.SpanID(), p.SpanContext.SpanID())
+		assert.Equal(t, []attribute.KeyValue{
+			attribute.String("warehouse", "london"),
+			attribute.String("item.id", "1"),
+			attribute.Int("item.quantity", 2),
+		}, p.Attributes)
+		assert.Equal(t, sdktrace.Status{Code: codes.Error, Description: "failed"}, p.Status)
+		assert.Equal(t, "cycle", c.Name)
+		assert.Equal(t, oteltrace.SpanKindInternal, c.SpanKind)
+		assert.False(t, c.Parent.IsValid())
+		assert.False(t, c.EndTime.Before(c.StartTime))
+		assert.Contains(t, c.Resource.Attributes(), attribute.String("service.name", "svc"))
+	}
+	// Another root span starts another trace
+	_, other := tracer.Start(context.Background(), "cycle")
+	other.End()
+	tracer.Close()
+	tracer.Close()
+	if spans = r.GetSpans(); assert.Len(t, spans, 3) {
+		assert.NotEqual(t, spans[1].SpanContext.TraceID(), spans[2].SpanContext.TraceID())
+	}
+	// Spans ending after close are not exported
+	_, late := tracer.Start(context.Background(), "late")
+	late.End()
+	tracer.Flush()
+	assert.Len(t, r.GetSpans(), 3)
+	assert.Zero(t, tracer.Dropped())
+}
+
+func TestSampling(t *testing.T) {
+	r := newRecorder()
+	tracer := New(r, "svc", 0)
+	ctx, cycle := tracer.Start(context.Background(), "cycle")
+	_, process := tracer.Start(ctx, "process")
+	assert.True(t, process.Context().IsValid(), "unsampled spans still carry trace context")
+	assert.False(t, process.Context().IsSampled())
+	process.End()
+	cycle.End()
+	tracer.Close()
+	assert.Empty(t, r.GetSpans())
+	// Children follow the decision of their parent
+	r = newRecorder()
+	tracer = New(r, "svc", 0.5)
+	sampled := 0
+	for i := 0; i < 1000; i++ {
+		ctx, cycle := tracer.Start(context.Background(), "cycle")
+		_, process := tracer.Start(ctx, "process")
+		process.End()
+		cycle.End()
+		if cycle.Context().IsSampled() {
+			sampled++
+		}
+	}
+	tracer.Close()
+	assert.InDelta(t, 500, sampled, 100)
+	assert.Len(t, r.GetSpans(), 2*sampled)
+}
+
+// blockingExporter holds exports until released
+type blockingExporter struct {
+	recorder
+	releaseC chan struct{}
+}
+
+func (e *blockingExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	<-e.releaseC
+	return e.recorder.ExportSpans(ctx, spans)
+}
+
+func TestDropped(t *testing.T) {
+	r := &blockingExporter{recorder: newRecorder(), releaseC: make(chan struct{})}
+	tracer := New(r, "svc", 1)
+	for i := 0; i < queueSize+10; i++ {
+		_, s := tracer.Start(context.Background(), "span")
+		s.End()
+	}
+	assert.Equal(t, uint64(10), tracer.Dropped())
+	close(r.releaseC)
+	tracer.Close()
+	assert.Len(t, r.GetSpans(), queueSize)
+}
+
+func TestNilTracer(t *testing.T) {
+	var tracer *Tracer
+	ctx, s := tracer.With("k", "v").Start(context.Background(), "span")
+	assert.Nil(t, s)
+	assert.Nil(t, FromContext(ctx))
+	s.SetAttribute("k", "v")
+	s.SetError(errors.New("failed"))
+	s.End()
+	assert.False(t, s.Context().IsValid())
+	tracer.Flush()
+	tracer.Close()
+	assert.Zero(t, tracer.Dropped())
+}
+
+func TestWriterExporter(t *testing.T) {
+	var buf bytes.Buffer
+	exporter, err := NewWriterExporter(&buf)
+	if !assert.NoError(t, err) {
+		return
+	}
+	tracer := New(exporter, "svc", 1)
+	_, s := tracer.Start(context.Background(), "cycle")
+	s.SetAttribute("items", 2)
+	s.End()
+	tracer.Close()
+	assert.Contains(t, buf.String(), `"Name":"cycle"`)
+	assert.Contains(t, buf.String(), `"Key":"items"`)
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var path, contentType string
+	var body []byte
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, contentType = r.URL.Path, r.Header.Get("Content-Type")
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer s.Close()
+	exporter, err := NewOTLPExporter(s.URL + "/v1/traces")
+	if !assert.NoError(t, err) {
+		return
+	}
+	tracer := New(exporter, "svc", 1)
+	_, span := tracer.Start(context.Background(), "cycle")
+	span.End()
+	tracer.Close()
+	assert.Equal(t, "/v1/traces", path)
+	assert.Equal(t, "application/x-protobuf", contentType)
+	assert.Contains(t, string(body), "cycle")
+	assert.Contains(t, string(body), "svc")
+}
@@ -0,0 +1,45 @@
+package trace
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Transport records HTTP requests as client spans, children of the span in request context,
+// and propagates the trace to servers in W3C `traceparent` header
+type Transport struct {
+	Tracer *Tracer
+	Next   http.RoundTripper // Transport making requests, http.DefaultTransport if nil
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	ctx, span := t.Tracer.StartKind(req.Context(), "HTTP "+req.Method, KindClient)
+	if span == nil {
+		return next.RoundTrip(req)
+	}
+	defer span.End()
+	req = req.Clone(ctx)
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", req.URL.Redacted())
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	span.SetAttribute("http.status_code", resp.StatusCode)
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetError(statusError(resp.Status))
+	}
+	return resp, nil
+}
+
+// statusError describes failed response status
+type statusError string
+
+func (e statusError) Error() string { return "status " + string(e) }
@@ -0,0 +1,72 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+func TestTransport(t *testing.T) {
+	var traceparent string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+	r := newRecorder()
+	tracer := New(r, "svc", 1)
+	client := &http.Client{Transport: &Transport{Tracer: tracer}}
+	ctx, parent := tracer.Start(context.Background(), "process")
+	for _, path := range []string{"/item", "/missing"} {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, s.URL+path, nil)
+		resp, err := client.Do(req)
+		if assert.NoError(t, err) {
+			_ = resp.Body.Close()
+		}
+		assert.Empty(t, req.Header.Get("traceparent"), "request should not be modified")
+		sc := oteltrace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(),
+			propagation.HeaderCarrier{"Traceparent": []string{traceparent}}))
+		if assert.True(t, sc.IsValid(), traceparent) {
+			assert.Equal(t, parent.Context().TraceID(), sc.TraceID())
+		}
+	}
+	parent.End()
+	// Unreachable server
+	s.Close()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	_, err := client.Do(req)
+	assert.Error(t, err)
+	tracer.Close()
+	if spans := r.GetSpans(); assert.Len(t, spans, 4) {
+		ok, missing, unreachable := spans[0], spans[1], spans[3]
+		assert.Equal(t, "HTTP GET", ok.Name)
+		assert.Equal(t, KindClient, ok.SpanKind)
+		assert.Equal(t, parent.Context().SpanID(), ok.Parent.SpanID())
+		assert.Contains(t, ok.Attributes, attribute.Int("http.status_code", 200))
+		assert.Contains(t, ok.Attributes, attribute.String("http.url", s.URL+"/item"))
+		assert.Equal(t, codes.Unset, ok.Status.Code)
+		assert.Equal(t, sdktrace.Status{Code: codes.Error, Description: "status 404 Not Found"}, missing.Status)
+		assert.Equal(t, codes.Error, unreachable.Status.Code)
+	}
+	// Without tracer requests pass through
+	traceparent = ""
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer s.Close()
+	resp, err := (&http.Client{Transport: &Transport{}}).Get(s.URL)
+	if assert.NoError(t, err) {
+		_ = resp.Body.Close()
+	}
+	assert.Empty(t, traceparent)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dmitry-vovk/csv-chg-go/cli"
+	"github.com/dmitry-vovk/csv-chg-go/config"
+	"github.com/dmitry-vovk/csv-chg-go/ident"
+	"github.com/dmitry-vovk/csv-chg-go/validate"
+)
+
+// validateCommand checks input for bad lines and prints a summary,
+// fails with findings exit code if any line was rejected
+func validateCommand(cfg config.ValidateConfig, args []string) error {
+	if len(args) != 1 {
+		return cli.Usage(errors.New("exactly one input should be specified"))
+	}
+	cfg.Source = args[0]
+	if err := cfg.Validate(); err != nil {
+		return cli.Usage(err)
+	}
+	format, _ := ident.New(cfg.IDFormat)
+	v := validate.New(format).WithMaxLineLength(cfg.MaxLine)
+	var files []io.Closer
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	create := func(path string) (io.Writer, error) {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("creating output file: %s", err)
+		}
+		files = append(files, f)
+		return f, nil
+	}
+	if cfg.Clean != "" {
+		f, err := create(cfg.Clean)
+		if err != nil {
+			return err
+		}
+		v.WithClean(f)
+	}
+	if cfg.Rejects != "" {
+		f, err := create(cfg.Rejects)
+		if err != nil {
+			return err
+		}
+		v.WithRejects(f)
+	}
+	if err := newSource(cfg.Input).ReadAny(cfg.Source, v.Read); err != nil {
+		return fmt.Errorf("reading input: %s", err)
+	}
+	r := v.Report()
+	fmt.Printf("Lines:                 %d\n", r.Lines)
+	fmt.Printf("Valid:                 %d\n", r.Valid)
+	fmt.Printf("Invalid:               %d\n", r.Invalid)
+	fmt.Printf("Too long:              %d\n", r.TooLong)
+	fmt.Printf("Duplicates:            %d\n", r.Duplicates)
+	fmt.Printf("Normalized duplicates: %d\n", r.NormalizedDuplicates)
+	if r.Rejected() > 0 {
+		return cli.ExitCode(cli.ExitFindings)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+// Package validate checks input lists for invalid and duplicate item identifiers
+package validate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"hash/fnv"
+	"io"
+	"strconv"
+
+	"github.com/dmitry-vovk/csv-chg-go/ident"
+)
+
+// Reasons of line rejection
+const (
+	ReasonInvalid             = "invalid"
+	ReasonTooLong             = "too_long"
+	ReasonDuplicate           = "duplicate"
+	ReasonNormalizedDuplicate = "normalized_duplicate"
+)
+
+// Report counts input lines by outcome
+type Report struct {
+	Lines                int // Total lines read
+	Valid                int // First occurrences of valid identifiers
+	Invalid              int // Lines not matching identifier format
+	TooLong              int // Lines exceeding the length limit
+	Duplicates           int // Exact repetitions of earlier lines
+	NormalizedDuplicates int // Lines differing from earlier ones but having the same normalized identifier, e.g. in case
+}
+
+// Rejected returns the number of lines not making it to the clean output
+func (r Report) Rejected() int {
+	return r.Invalid + r.TooLong + r.Duplicates + r.NormalizedDuplicates
+}
+
+// Validator checks input lines one by one
+type Validator struct {
+	format  ident.Format
+	maxLine int
+	clean   *bufio.Writer
+	rejects *csv.Writer
+	seen    map[string]occurrence // First occurrences by binary key
+	report  Report
+}
+
+// occurrence tells where identifier has been seen first
+type occurrence struct {
+	line int
+	hash uint64 // Hash of the line as it was, to tell exact duplicates from normalized ones
+}
+
+const defaultMaxLineLength = 4096
+
+// New returns Validator of identifiers in `format`
+func New(format ident.Format) *Validator {
+	return &Validator{
+		format:  format,
+		maxLine: defaultMaxLineLength,
+		seen:    make(map[string]occurrence),
+	}
+}
+
+// WithMaxLineLength sets the length above which lines are rejected
+func (v *Validator) WithMaxLineLength(n int) *Validator {
+	v.maxLine = n
+	return v
+}
+
+// WithClean makes the validator write normalized unique identifiers to `w`, one per line
+func (v *Validator) WithClean(w io.Writer) *Validator {
+	v.clean = bufio.NewWriter(w)
+	return v
+}
+
+// WithRejects makes the validator write rejected lines to `w` as CSV with line number, reason,
+// line number of the first occurrence for duplicates, and line content
+func (v *Validator) WithRejects(w io.Writer) *Validator {
+	v.rejects = csv.NewWriter(w)
+	return v
+}
+
+// Report returns counters of lines read so far
+func (v *Validator) Report() Report {
+	return v.report
+}
+
+// Read checks lines of `r`, can be called several times to validate concatenated inputs
+func (v *Validator) Read(r io.Reader) error {
+	if v.rejects != nil && v.report.Lines == 0 {
+		if err := v.rejects.Write([]string{"line", "reason", "first_line", "value"}); err != nil {
+			return err
+		}
+	}
+	lr := ident.NewLineReader(r, v.maxLine)
+	var key []byte
+	for {
+		// Read error is kept apart from check errors, the last line may come along with it
+		b, tooLong, readErr := lr.Next()
+		var err error
+		switch {
+		case tooLong:
+			v.report.Lines++
+			v.report.TooLong++
+			err = v.reject(ReasonTooLong, 0, nil)
+		case len(b) > 0:
+			v.report.Lines++
+			key, err = v.check(key[:0], bytes.TrimSpace(b))
+		}
+		if err != nil {
+			return err
+		}
+		if readErr == io.EOF {
+			break
+		} else if readErr != nil {
+			return readErr
+		}
+	}
+	if v.clean != nil {
+		if err := v.clean.Flush(); err != nil {
+			return err
+		}
+	}
+	if v.rejects != nil {
+		v.rejects.Flush()
+		return v.rejects.Error()
+	}
+	return nil
+}
+
+// check classifies a single line, `key` is a buffer for the binary identifier
+func (v *Validator) check(key, line []byte) ([]byte, error) {
+	id, interval, ok := ident.SplitLine(line)
+	if ok {
+		key, ok = v.format.Parse(key, id)
+	}
+	if !ok {
+		v.report.Invalid++
+		return key, v.reject(ReasonInvalid, 0, line)
+	}
+	h := fnv.New64a()
+	_, _ = h.Write(line)
+	if first, ok := v.seen[string(key)]; ok {
+		if first.hash == h.Sum64() {
+			v.report.Duplicates++
+			return key, v.reject(ReasonDuplicate, first.line, line)
+		}
+		v.report.NormalizedDuplicates++
+		return key, v.reject(ReasonNormalizedDuplicate, first.line, line)
+	}
+	v.seen[string(key)] = occurrence{line: v.report.Lines, hash: h.Sum64()}
+	v.report.Valid++
+	if v.clean != nil {
+		clean := v.format.String(key)
+		if interval > 0 {
+			clean += "," + interval.String()
+		}
+		if _, err := v.clean.WriteString(clean + "\n"); err != nil {
+			return key, err
+		}
+	}
+	return key, nil
+}
+
+// reject writes current line to rejects output if one is set
+func (v *Validator) reject(reason string, firstLine int, line []byte) error {
+	if v.rejects == nil {
+		return nil
+	}
+	first := ""
+	if firstLine > 0 {
+		first = strconv.Itoa(firstLine)
+	}
+	return v.rejects.Write([]string{strconv.Itoa(v.report.Lines), reason, first, string(line)})
+}
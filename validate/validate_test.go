@@ -0,0 +1,107 @@
+package validate
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/dmitry-vovk/csv-chg-go/ident"
+	"github.com/stretchr/testify/assert"
+)
+
+const input = `767d967f-b55b-4457-bfee-685eaa6d0583
+ee88ff32-f753-4a49-abf1-2885fdfcafba
+ee88ff32-f753-4a49-abf1-2885fdfcafbaee88ff32-f753-4a49-abf1-2885fdfcafba
+ee88ff32-f753-4a49-abf1-2885fdfcafbz
+
+9e2cb4dd-bd6e-48aa-9c0d-696a058226ed
+...
+9E2CB4dd-bd6e-48aa-9c0d-696a058226ed
+767d967f-b55b-4457-bfee-685eaa6d0583
+`
+
+func TestValidator(t *testing.T) {
+	var clean, rejects bytes.Buffer
+	v := New(ident.UUID{}).WithMaxLineLength(64).WithClean(&clean).WithRejects(&rejects)
+	assert.NoError(t, v.Read(strings.NewReader(input)))
+	report := Report{
+		Lines:                9,
+		Valid:                3,
+		Invalid:              3,
+		TooLong:              1,
+		Duplicates:           1,
+		NormalizedDuplicates: 1,
+	}
+	assert.Equal(t, report, v.Report())
+	assert.Equal(t, 6, v.Report().Rejected())
+	assert.Equal(t, `767d967f-b55b-4457-bfee-685eaa6d0583
+ee88ff32-f753-4a49-abf1-2885fdfcafba
+9e2cb4dd-bd6e-48aa-9c0d-696a058226ed
+`, clean.String())
+	assert.Equal(t, `line,reason,first_line,value
+3,too_long,,
+4,invalid,,ee88ff32-f753-4a49-abf1-2885fdfcafbz
+5,invalid,,
+7,invalid,,...
+8,normalized_duplicate,6,9E2CB4dd-bd6e-48aa-9c0d-696a058226ed
+9,duplicate,1,767d967f-b55b-4457-bfee-685eaa6d0583
+`, rejects.String())
+}
+
+func TestValidatorNormalizesNotation(t *testing.T) {
+	var clean bytes.Buffer
+	v := New(ident.UUIDAny{}).WithClean(&clean)
+	assert.NoError(t, v.Read(strings.NewReader("{767D967F-B55B-4457-BFEE-685EAA6D0583}\r\nurn:uuid:767d967f-b55b-4457-bfee-685eaa6d0583\n")))
+	assert.Equal(t, Report{Lines: 2, Valid: 1, NormalizedDuplicates: 1}, v.Report())
+	assert.Equal(t, "767d967f-b55b-4457-bfee-685eaa6d0583\n", clean.String())
+}
+
+func TestValidatorIntervals(t *testing.T) {
+	var clean, rejects bytes.Buffer
+	v := New(ident.UUID{}).WithClean(&clean).WithRejects(&rejects)
+	assert.NoError(t, v.Read(strings.NewReader("767d967f-b55b-4457-bfee-685eaa6d0583, 90s\nee88ff32-f753-4a49-abf1-2885fdfcafba,often\n")))
+	assert.Equal(t, Report{Lines: 2, Valid: 1, Invalid: 1}, v.Report())
+	assert.Equal(t, "767d967f-b55b-4457-bfee-685eaa6d0583,1m30s\n", clean.String())
+	assert.Contains(t, rejects.String(), "2,invalid,,\"ee88ff32-f753-4a49-abf1-2885fdfcafba,often\"\n")
+}
+
+func TestValidatorError(t *testing.T) {
+	v := New(ident.SKU{})
+	err := v.Read(io.MultiReader(strings.NewReader("A-1\n"), errReader{io.ErrUnexpectedEOF}))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	assert.Equal(t, Report{Lines: 1, Valid: 1}, v.Report())
+	// Read error coming along with the last partial line is not lost
+	v = New(ident.SKU{})
+	err = v.Read(&onceErrReader{data: "A-1\nA-2", err: io.ErrUnexpectedEOF})
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	assert.Equal(t, Report{Lines: 2, Valid: 2}, v.Report())
+	v = New(ident.SKU{}).WithRejects(errWriter{})
+	assert.Error(t, v.Read(strings.NewReader("A-1\n")))
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+// onceErrReader returns all data along with the error, and io.EOF afterwards
+type onceErrReader struct {
+	data string
+	err  error
+}
+
+func (r *onceErrReader) Read(b []byte) (int, error) {
+	if r.err == nil {
+		return 0, io.EOF
+	}
+	n, err := copy(b, r.data), r.err
+	r.err = nil
+	return n, err
+}
+
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) { return 0, errors.New("write failed") }
@@ -0,0 +1,50 @@
+package worker
+
+import (
+	"time"
+)
+
+const (
+	minBackoff = time.Minute    // Delay of the first check after a permanent API error
+	maxBackoff = 24 * time.Hour // Longest delay between checks of an item failing permanently
+)
+
+// backoff delays checks of an item the API keeps rejecting
+type backoff struct {
+	failures int       // Consecutive permanent errors
+	until    time.Time // When the item is checked again
+}
+
+// backOff records a permanent error of the item at `now` and returns how long its checks are delayed,
+// doubling with every consecutive error
+func (w *Worker) backOff(id key, now time.Time) time.Duration {
+	w.backoffsM.Lock()
+	defer w.backoffsM.Unlock()
+	b, ok := w.backoffs[id]
+	if !ok {
+		b = &backoff{}
+		w.backoffs[id] = b
+	}
+	b.failures++
+	delay := maxBackoff
+	if b.failures <= 32 && minBackoff<<(b.failures-1) < maxBackoff {
+		delay = minBackoff << (b.failures - 1)
+	}
+	b.until = now.Add(delay)
+	return delay
+}
+
+// backingOff tells whether checks of the item are delayed at `now`
+func (w *Worker) backingOff(id key, now time.Time) bool {
+	w.backoffsM.Lock()
+	defer w.backoffsM.Unlock()
+	b, ok := w.backoffs[id]
+	return ok && now.Before(b.until)
+}
+
+// recovered resets delay of the item once it is checked successfully
+func (w *Worker) recovered(id key) {
+	w.backoffsM.Lock()
+	delete(w.backoffs, id)
+	w.backoffsM.Unlock()
+}
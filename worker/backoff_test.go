@@ -0,0 +1,67 @@
+package worker
+
+import (
+	"bytes"
+	"log"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dmitry-vovk/csv-chg-go/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	w := New(nil)
+	id := keyOf("00000000-0000-0000-0000-000000000001")
+	now := time.Now()
+	assert.False(t, w.backingOff(id, now))
+	assert.Equal(t, minBackoff, w.backOff(id, now))
+	assert.True(t, w.backingOff(id, now))
+	assert.False(t, w.backingOff(id, now.Add(minBackoff)))
+	assert.Equal(t, 2*minBackoff, w.backOff(id, now))
+	assert.Equal(t, 4*minBackoff, w.backOff(id, now))
+	for i := 0; i < 100; i++ {
+		w.backOff(id, now)
+	}
+	assert.Equal(t, maxBackoff, w.backOff(id, now))
+	w.recovered(id)
+	assert.False(t, w.backingOff(id, now))
+	assert.Equal(t, minBackoff, w.backOff(id, now))
+}
+
+// forbiddenClient rejects every item permanently
+type forbiddenClient struct {
+	gets int32
+}
+
+func (c *forbiddenClient) GetItem(uuid string) (*api.Item, error) {
+	atomic.AddInt32(&c.gets, 1)
+	return nil, &api.StatusError{Method: "GET", URL: "http://api/item/" + uuid, UUID: uuid, StatusCode: 403}
+}
+
+func (c *forbiddenClient) PostAlert(string, *api.Alert) error { return nil }
+
+func TestBackoffChecks(t *testing.T) {
+	c := &forbiddenClient{}
+	logBuffer := &bytes.Buffer{}
+	w := New(c).WithLogger(log.New(logBuffer, "", 0))
+	uuid := "00000000-0000-0000-0000-000000000001"
+	assert.NoError(t, w.Add(uuid, "00000000-0000-0000-0000-000000000002"))
+	w.queue.add(keyOf("00000000-0000-0000-0000-000000000002"), time.Second, time.Now())
+	// Items failing permanently are not checked again by cycles or when due, until the delay passes
+	w.cycle()
+	w.checkDue(time.Now())
+	w.wg.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&c.gets))
+	w.cycle()
+	w.checkDue(time.Now().Add(30 * time.Second))
+	w.wg.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&c.gets))
+	assert.Equal(t, 1, w.queue.len())
+	assert.False(t, w.queue.next().IsZero(), "due item backing off is queued again")
+	w.recovered(keyOf(uuid))
+	w.cycle()
+	assert.Equal(t, int32(3), atomic.LoadInt32(&c.gets))
+	assert.Contains(t, logBuffer.String(), `Permanent API error, checking "00000000-0000-0000-0000-000000000001" again in 1m0s: GET http://api/item/00000000-0000-0000-0000-000000000001: unexpected status code 403`)
+}
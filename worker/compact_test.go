@@ -1,36 +1,28 @@
 package worker
 
 import (
+	"bytes"
 	"testing"
 
+	"github.com/dmitry-vovk/csv-chg-go/ident"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestCompact(t *testing.T) {
-	uuid := "767d967f-b55b-4457-bfee-685eaa6d0583"
-	expected := compact{
-		0x76, 0x7d, 0x96, 0x7f,
-		0xb5, 0x5b,
-		0x44, 0x57,
-		0xbf, 0xee,
-		0x68, 0x5e, 0xaa, 0x6d, 0x05, 0x83,
-	}
-	if id := fromUUID(uuid); assert.Equal(t, expected, id) {
-		assert.Equal(t, uuid, id.String())
+	ids := randomIDs(1000, 4)
+	for i := 1; i < len(ids); i++ {
+		a, b := ids[i-1], ids[i]
+		assert.Equal(t, bytes.Compare(a[:], b[:]) < 0, a.less(b))
+		assert.Equal(t, a, toCompact(a[:]))
 	}
+	assert.False(t, ids[0].less(ids[0]))
 }
 
-// BenchmarkCompact-12
-// 8261254
-// 133 ns/op
-// 96 B/op
-// 2 allocs/op
-func BenchmarkCompact(b *testing.B) {
-	uuid := "767d967f-b55b-4457-bfee-685eaa6d0583"
-	b.ReportAllocs()
-	for i := 0; i < b.N; i++ {
-		if uuid2 := fromUUID(uuid).String(); uuid2 != uuid {
-			b.Fail()
-		}
+// keyOf returns binary key of valid `uuid`
+func keyOf(uuid string) key {
+	b, ok := ident.UUID{}.Parse(nil, []byte(uuid))
+	if !ok {
+		panic("invalid UUID " + uuid)
 	}
+	return key(b)
 }
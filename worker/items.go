@@ -0,0 +1,97 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidID is returned by Add for identifiers not in the worker format
+var ErrInvalidID = errors.New("invalid item ID")
+
+// change is an addition or removal of an item identifier
+type change struct {
+	id     key
+	remove bool
+}
+
+// Add adds items to be checked on the worker schedule, ignoring ones already present or owned by other shards.
+// Nothing is added if any of `uuids` is invalid.
+// Items added while a check cycle runs are checked from the next cycle on.
+func (w *Worker) Add(uuids ...string) error {
+	ids := make([]key, 0, len(uuids))
+	for _, uuid := range uuids {
+		id, ok := w.format.Parse(nil, []byte(uuid))
+		if !ok {
+			return fmt.Errorf("%w %q", ErrInvalidID, uuid)
+		}
+		if w.sharder == nil || w.sharder.Owns(id) {
+			ids = append(ids, key(id))
+		}
+	}
+	for _, id := range ids {
+		w.change(change{id: id})
+	}
+	return nil
+}
+
+// Remove stops checking items and drops their state, invalid and unknown identifiers are ignored.
+// Items removed while a check cycle runs are removed once it is over.
+func (w *Worker) Remove(uuids ...string) {
+	for _, uuid := range uuids {
+		if id, ok := w.format.Parse(nil, []byte(uuid)); ok {
+			w.change(change{id: key(id), remove: true})
+		}
+	}
+}
+
+// List returns identifiers of items being checked, in store order.
+// Changes postponed until the running check cycle is over are not reflected.
+func (w *Worker) List() []string {
+	var list []string
+	w.iterate(func(id key) bool {
+		list = append(list, w.format.String([]byte(id)))
+		return true
+	})
+	return list
+}
+
+// change applies `c`, or postpones it if the store is being iterated
+func (w *Worker) change(c change) {
+	w.uuidsM.Lock()
+	defer w.uuidsM.Unlock()
+	if w.iterating > 0 {
+		w.postponed = append(w.postponed, c)
+		return
+	}
+	w.applyChange(c)
+}
+
+// applyChange adds or removes identifier, removed item state is dropped
+func (w *Worker) applyChange(c change) {
+	if !c.remove {
+		w.uuids.add([]byte(c.id))
+		return
+	}
+	w.uuids.remove([]byte(c.id))
+	w.forget(c.id)
+}
+
+// iterate calls `fn` for every identifier until it returns false.
+// The store is not locked meanwhile, so cycles don't block Add and Remove, whose changes are applied afterwards.
+func (w *Worker) iterate(fn func(id key) bool) {
+	w.uuidsM.Lock()
+	if w.iterating == 0 {
+		w.uuids.settle()
+	}
+	w.iterating++
+	w.uuidsM.Unlock()
+	w.uuids.each(fn)
+	w.uuidsM.Lock()
+	if w.iterating--; w.iterating == 0 {
+		for _, c := range w.postponed {
+			w.applyChange(c)
+		}
+		w.postponed = nil
+	}
+	w.uuidsM.Unlock()
+}
@@ -0,0 +1,60 @@
+package worker
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestItems(t *testing.T) {
+	ids := []string{
+		"767d967f-b55b-4457-bfee-685eaa6d0583",
+		"9e2cb4dd-bd6e-48aa-9c0d-696a058226ed",
+		"ee88ff32-f753-4a49-abf1-2885fdfcafba",
+	}
+	for _, kind := range []string{StoreMap, StoreSorted} {
+		w := New(nil).WithStore(kind)
+		assert.NoError(t, w.Add(ids[2], ids[0]))
+		assert.NoError(t, w.Add("9E2CB4DD-BD6E-48AA-9C0D-696A058226ED", ids[0]))
+		assert.Equal(t, ids, sorted(w.List()), kind)
+		// Nothing is added if any ID is invalid
+		err := w.Add("00000000-0000-0000-0000-000000000001", "bad")
+		assert.True(t, errors.Is(err, ErrInvalidID))
+		assert.EqualError(t, err, `invalid item ID "bad"`)
+		assert.Len(t, w.List(), 3)
+		// Removed item state is dropped
+		w.transition(keyOf(ids[1]), 3, "warning", time.Now())
+		w.Remove(ids[1], "bad", "00000000-0000-0000-0000-000000000001")
+		assert.Equal(t, []string{ids[0], ids[2]}, sorted(w.List()))
+		_, ok := w.previous(keyOf(ids[1]))
+		assert.False(t, ok)
+	}
+}
+
+func TestItemsSharded(t *testing.T) {
+	owned := keyOf("767d967f-b55b-4457-bfee-685eaa6d0583")
+	w := New(nil).WithSharder(mockSharder(func(id []byte) bool { return string(id) == string(owned) }))
+	assert.NoError(t, w.Add("767d967f-b55b-4457-bfee-685eaa6d0583", "ee88ff32-f753-4a49-abf1-2885fdfcafba"))
+	assert.Equal(t, []string{"767d967f-b55b-4457-bfee-685eaa6d0583"}, w.List())
+}
+
+func TestItemsPostponed(t *testing.T) {
+	w := New(nil)
+	assert.NoError(t, w.Add("767d967f-b55b-4457-bfee-685eaa6d0583"))
+	// Changes made while a cycle iterates the store are applied once it is over
+	w.iterate(func(id key) bool {
+		assert.NoError(t, w.Add("ee88ff32-f753-4a49-abf1-2885fdfcafba"))
+		w.Remove("767d967f-b55b-4457-bfee-685eaa6d0583")
+		assert.Equal(t, []string{"767d967f-b55b-4457-bfee-685eaa6d0583"}, w.List())
+		return true
+	})
+	assert.Equal(t, []string{"ee88ff32-f753-4a49-abf1-2885fdfcafba"}, w.List())
+}
+
+func sorted(list []string) []string {
+	sort.Strings(list)
+	return list
+}
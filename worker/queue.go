@@ -0,0 +1,188 @@
+package worker
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// adaptInterval derives check interval of the item from consumption since the previous observation,
+// so that it is checked about twice before it is projected to fall below threshold.
+// Items without previous observation or below threshold follow the worker schedule.
+func (w *Worker) adaptInterval(id key, quantity int, now time.Time) {
+	prev, at, ok := w.lastObservation(id)
+	elapsed := now.Sub(at)
+	if !ok || elapsed <= 0 || quantity < w.threshold {
+		w.queue.unadapt(id)
+		return
+	}
+	interval := w.maxAuto
+	if consumed := prev - quantity; consumed > 0 {
+		// Float avoids overflow of long periods multiplied by large stock
+		if d := float64(elapsed) * float64(quantity-w.threshold) / float64(consumed) / 2; d < float64(w.maxAuto) {
+			interval = time.Duration(d)
+		}
+	}
+	if interval < w.minAuto {
+		interval = w.minAuto
+	}
+	w.queue.adapt(id, interval)
+}
+
+// queued is an item checked at its own interval rather than on the worker schedule
+type queued struct {
+	id       key
+	due      time.Time     // When the item should be checked next
+	interval time.Duration // Delay between checks
+	fixed    bool          // Whether the interval comes from input, otherwise it is derived from consumption
+	index    int           // Position in the heap, -1 while the item is being checked
+}
+
+// itemQueue orders items having their own check intervals by due time.
+// Items are popped when due and pushed back once checked, so an item is never checked twice at once.
+type itemQueue struct {
+	m       sync.Mutex
+	heap    queueHeap
+	entries map[key]*queued
+	wakeC   chan struct{} // Signalled when an item is pushed, so the run loop can wake up earlier
+}
+
+func newItemQueue() *itemQueue {
+	return &itemQueue{
+		entries: make(map[key]*queued),
+		wakeC:   make(chan struct{}, 1),
+	}
+}
+
+// add queues item with fixed `interval` to be checked at `due`, replacing its entry if any
+func (q *itemQueue) add(id key, interval time.Duration, due time.Time) {
+	q.m.Lock()
+	defer q.m.Unlock()
+	q.removeLocked(id)
+	e := &queued{id: id, due: due, interval: interval, fixed: true}
+	q.entries[id] = e
+	heap.Push(&q.heap, e)
+	q.wake()
+}
+
+// adapt sets derived `interval` of an item being checked, queueing it if it is not queued yet.
+// Items with fixed intervals are not affected.
+func (q *itemQueue) adapt(id key, interval time.Duration) {
+	q.m.Lock()
+	defer q.m.Unlock()
+	if e, ok := q.entries[id]; ok {
+		if !e.fixed {
+			e.interval = interval
+		}
+		return
+	}
+	q.entries[id] = &queued{id: id, interval: interval, index: -1}
+}
+
+// unadapt returns an item with derived interval back to the worker schedule
+func (q *itemQueue) unadapt(id key) {
+	q.m.Lock()
+	defer q.m.Unlock()
+	if e, ok := q.entries[id]; ok && !e.fixed {
+		q.removeLocked(id)
+	}
+}
+
+// has tells whether the item is checked at its own interval
+func (q *itemQueue) has(id key) bool {
+	q.m.Lock()
+	defer q.m.Unlock()
+	_, ok := q.entries[id]
+	return ok
+}
+
+// remove drops the item from the queue
+func (q *itemQueue) remove(id key) {
+	q.m.Lock()
+	defer q.m.Unlock()
+	q.removeLocked(id)
+}
+
+func (q *itemQueue) removeLocked(id key) {
+	if e, ok := q.entries[id]; ok {
+		if e.index >= 0 {
+			heap.Remove(&q.heap, e.index)
+		}
+		delete(q.entries, id)
+	}
+}
+
+// popDue removes and returns items due at `now`
+func (q *itemQueue) popDue(now time.Time) []key {
+	q.m.Lock()
+	defer q.m.Unlock()
+	var ids []key
+	for len(q.heap) > 0 && !q.heap[0].due.After(now) {
+		e := heap.Pop(&q.heap).(*queued)
+		ids = append(ids, e.id)
+	}
+	return ids
+}
+
+// requeue pushes back a checked item to be checked again one interval after `now`
+func (q *itemQueue) requeue(id key, now time.Time) {
+	q.m.Lock()
+	defer q.m.Unlock()
+	if e, ok := q.entries[id]; ok && e.index < 0 {
+		e.due = now.Add(e.interval)
+		heap.Push(&q.heap, e)
+		q.wake()
+	}
+}
+
+// next returns when the earliest item is due, zero if none is queued
+func (q *itemQueue) next() time.Time {
+	q.m.Lock()
+	defer q.m.Unlock()
+	if len(q.heap) == 0 {
+		return time.Time{}
+	}
+	return q.heap[0].due
+}
+
+// len returns the number of items checked at their own intervals
+func (q *itemQueue) len() int {
+	q.m.Lock()
+	defer q.m.Unlock()
+	return len(q.entries)
+}
+
+// wake signals the run loop without blocking
+func (q *itemQueue) wake() {
+	select {
+	case q.wakeC <- struct{}{}:
+	default:
+	}
+}
+
+// queueHeap implements `heap.Interface` ordering entries by due time
+type queueHeap []*queued
+
+func (h queueHeap) Len() int           { return len(h) }
+func (h queueHeap) Less(i, j int) bool { return h[i].due.Before(h[j].due) }
+
+func (h queueHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *queueHeap) Push(x interface{}) {
+	e := x.(*queued)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *queueHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	e.index = -1
+	*h = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,172 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestItemQueue(t *testing.T) {
+	q := newItemQueue()
+	a, b, c := keyOf("00000000-0000-0000-0000-00000000000a"), keyOf("00000000-0000-0000-0000-00000000000b"), keyOf("00000000-0000-0000-0000-00000000000c")
+	start := time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC)
+	assert.True(t, q.next().IsZero())
+	q.add(a, time.Minute, start.Add(time.Minute))
+	q.add(b, time.Hour, start.Add(time.Hour))
+	q.add(c, 10*time.Second, start.Add(10*time.Second))
+	assert.Len(t, q.wakeC, 1)
+	assert.Equal(t, 3, q.len())
+	assert.Equal(t, start.Add(10*time.Second), q.next())
+	assert.Empty(t, q.popDue(start))
+	assert.Equal(t, []key{c, a}, q.popDue(start.Add(time.Minute)))
+	assert.True(t, q.has(a), "items being checked stay in the queue")
+	assert.Equal(t, start.Add(time.Hour), q.next())
+	// Checked items come back one interval later, items in the heap are not affected
+	q.requeue(c, start.Add(time.Minute))
+	q.requeue(b, start.Add(time.Minute))
+	assert.Equal(t, start.Add(70*time.Second), q.next())
+	// Derived intervals do not override fixed ones
+	q.adapt(a, time.Hour)
+	q.unadapt(a)
+	q.requeue(a, start.Add(time.Minute))
+	assert.Equal(t, []key{c, a}, q.popDue(start.Add(2*time.Minute)))
+	q.remove(a)
+	q.remove(b)
+	assert.False(t, q.has(a))
+	assert.Equal(t, 1, q.len())
+	// Items with derived intervals are queued once checked, and can be returned to the worker schedule
+	q.adapt(a, 5*time.Minute)
+	assert.True(t, q.has(a))
+	assert.True(t, q.next().IsZero())
+	q.requeue(a, start)
+	q.adapt(a, time.Minute)
+	assert.Equal(t, start.Add(5*time.Minute), q.next())
+	q.unadapt(a)
+	assert.False(t, q.has(a))
+	assert.True(t, q.next().IsZero())
+}
+
+func TestAdaptInterval(t *testing.T) {
+	w := New(nil).WithAutoIntervals(time.Minute, 24*time.Hour)
+	id := keyOf("00000000-0000-0000-0000-000000000001")
+	interval := func() time.Duration {
+		w.queue.m.Lock()
+		defer w.queue.m.Unlock()
+		if e, ok := w.queue.entries[id]; ok {
+			return e.interval
+		}
+		return 0
+	}
+	start := time.Now()
+	observe := func(quantity int, at time.Duration) {
+		w.adaptInterval(id, quantity, start.Add(at))
+		w.transition(id, quantity, "", start.Add(at))
+	}
+	observe(105, 0)
+	assert.Equal(t, time.Duration(0), interval(), "no consumption observed yet")
+	// 10 consumed in an hour, 90 left above threshold, crossing projected in 9 hours
+	observe(95, time.Hour)
+	assert.Equal(t, 4*time.Hour+30*time.Minute, interval())
+	// Nothing consumed
+	observe(95, 2*time.Hour)
+	assert.Equal(t, 24*time.Hour, interval())
+	// Fast consumption
+	observe(15, 2*time.Hour+10*time.Minute)
+	assert.Equal(t, time.Minute, interval())
+	// Below threshold
+	observe(4, 3*time.Hour)
+	assert.False(t, w.queue.has(id))
+}
+
+func TestWorkerReaderIntervals(t *testing.T) {
+	logBuffer := &bytes.Buffer{}
+	w := New(nil).WithLogger(log.New(logBuffer, "", 0))
+	input := strings.Join([]string{
+		"767d967f-b55b-4457-bfee-685eaa6d0583,1m",
+		"ee88ff32-f753-4a49-abf1-2885fdfcafba",
+		"9e2cb4dd-bd6e-48aa-9c0d-696a058226ed, 24h",
+		"00000000-0000-0000-0000-000000000001,often",
+		"767d967f-b55b-4457-bfee-685eaa6d0583,5m",
+	}, "\n")
+	start := time.Now()
+	assert.NoError(t, w.ReadUUIDs(strings.NewReader(input)))
+	assert.Equal(t, 3, w.uuids.len())
+	assert.Equal(t, 2, w.queue.len())
+	assert.True(t, w.queue.has(keyOf("767d967f-b55b-4457-bfee-685eaa6d0583")))
+	assert.WithinDuration(t, start.Add(time.Minute), w.queue.next(), time.Second)
+	assert.Contains(t, logBuffer.String(), `Invalid ID in line 4: "00000000-0000-0000-0000-000000000001,often"`)
+	assert.Contains(t, logBuffer.String(), `Duplicate ID in line 5: "767d967f-b55b-4457-bfee-685eaa6d0583,5m"`)
+	assert.Contains(t, logBuffer.String(), "2 records have own check intervals")
+}
+
+func TestRunQueue(t *testing.T) {
+	c := &mockAPIClient{}
+	w := New(c).WithInterval(time.Hour)
+	input := "00000000-0000-0000-0000-000000000001,1s\n00000000-0000-0000-0000-000000000003\n"
+	assert.NoError(t, w.ReadUUIDs(strings.NewReader(input)))
+	go w.Run(context.Background())
+	time.Sleep(2*time.Second + 500*time.Millisecond)
+	w.Shutdown()
+	// Only the item with own interval is due, twice
+	assert.Equal(t, 2, c.gets)
+}
+
+// Run loop wake-up with 1000 queued items, none due, go test -run=- -bench=Wake ./worker
+// BenchmarkWake/items_10000      14530195     93.79 ns/op
+// BenchmarkWake/items_1000000    11621655    107.9 ns/op
+func BenchmarkWake(b *testing.B) {
+	for _, n := range []int{10000, 1000000} {
+		b.Run(fmt.Sprintf("items %d", n), func(b *testing.B) {
+			w := New(nil).WithInterval(time.Hour)
+			now := time.Now()
+			for i, id := range randomIDs(n, 1) {
+				w.uuids.add(id[:])
+				if i < 1000 {
+					w.queue.add(key(id[:]), time.Hour, now.Add(time.Hour))
+				}
+			}
+			next := now.Add(time.Hour)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w.release(now)
+				w.checkDue(now)
+				_ = w.untilWake(next, now)
+			}
+		})
+	}
+}
+
+// Cycle walk over the store with every tenth item queued, go test -run=- -bench=CycleScan ./worker
+// BenchmarkCycleScan/map      7   193889317 ns/op   193.9 ns/item
+// BenchmarkCycleScan/sorted   6   172123778 ns/op   172.1 ns/item
+func BenchmarkCycleScan(b *testing.B) {
+	const n = 1000000
+	ids := randomIDs(n, 1)
+	for _, kind := range []string{StoreMap, StoreSorted} {
+		b.Run(kind, func(b *testing.B) {
+			w := New(nil).WithStore(kind)
+			for i, id := range ids {
+				w.uuids.add(id[:])
+				if i%10 == 0 {
+					w.queue.add(key(id[:]), time.Hour, time.Now().Add(time.Hour))
+				}
+			}
+			b.ResetTimer()
+			start := time.Now()
+			scheduled := 0
+			for i := 0; i < b.N; i++ {
+				w.scheduled(func(key) { scheduled++ })
+			}
+			b.ReportMetric(float64(time.Since(start).Nanoseconds())/float64(n*b.N), "ns/item")
+			if scheduled != n*b.N*9/10 {
+				b.Fatalf("%d items scheduled", scheduled)
+			}
+		})
+	}
+}
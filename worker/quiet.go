@@ -0,0 +1,107 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/dmitry-vovk/csv-chg-go/api"
+	"github.com/dmitry-vovk/csv-chg-go/audit"
+)
+
+// idleWait is how long the run loop sleeps when there is nothing scheduled
+const idleWait = time.Hour
+
+// deferred is an alert held back during quiet hours
+type deferred struct {
+	item  *api.Item
+	alert *api.Alert
+}
+
+// deliver sends the alert, or holds it back until quiet hours end.
+// Only the latest alert of an item is kept.
+func (w *Worker) deliver(ctx context.Context, id key, item *api.Item, alert *api.Alert) {
+	end, quiet := w.quiet.End(alert.ObservedAt)
+	if !quiet {
+		w.send(ctx, id, Result{UUID: item.UUID, Item: item, Alert: alert, Decision: audit.DecisionAlert})
+		return
+	}
+	w.report(Result{UUID: item.UUID, Item: item, Alert: alert, Decision: audit.DecisionDeferred})
+	w.deferredM.Lock()
+	w.deferred[id] = deferred{item: item, alert: alert}
+	if end.After(w.releaseAt) {
+		w.releaseAt = end
+	}
+	w.deferredM.Unlock()
+}
+
+// cancel drops deferred alert of an item that no longer raises one
+func (w *Worker) cancel(id key) {
+	w.deferredM.Lock()
+	delete(w.deferred, id)
+	w.deferredM.Unlock()
+}
+
+// release delivers deferred alerts in a batch in the background once quiet hours are over
+func (w *Worker) release(now time.Time) {
+	w.deferredM.Lock()
+	if len(w.deferred) == 0 || now.Before(w.releaseAt) {
+		w.deferredM.Unlock()
+		return
+	}
+	batch := w.deferred
+	w.deferred = make(map[key]deferred)
+	w.deferredM.Unlock()
+	w.logf("Quiet hours are over, delivering %d deferred alerts", len(batch))
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		for id, d := range batch {
+			w.limiter.Acquire()
+			if w.stopping() {
+				w.limiter.Release()
+				w.hold(id, d)
+				continue
+			}
+			w.wg.Add(1)
+			go func(id key, d deferred) {
+				w.send(w.ctx, id, Result{UUID: d.item.UUID, Item: d.item, Alert: d.alert, Decision: audit.DecisionReleased})
+				w.limiter.Release()
+				w.wg.Done()
+			}(id, d)
+		}
+	}()
+}
+
+// hold puts back the deferred alert not delivered due to shutdown, unless the item raised a newer one
+func (w *Worker) hold(id key, d deferred) {
+	w.deferredM.Lock()
+	if _, ok := w.deferred[id]; !ok {
+		w.deferred[id] = d
+	}
+	w.deferredM.Unlock()
+}
+
+// untilWake returns how long the run loop should sleep before the `next` cycle, the next queued item is due,
+// or quiet hours end if alerts are deferred
+func (w *Worker) untilWake(next, now time.Time) time.Duration {
+	wake := next
+	if due := w.queue.next(); !due.IsZero() && (wake.IsZero() || due.Before(wake)) {
+		wake = due
+	}
+	w.deferredM.Lock()
+	if len(w.deferred) > 0 && (wake.IsZero() || w.releaseAt.Before(wake)) {
+		wake = w.releaseAt
+	}
+	w.deferredM.Unlock()
+	if wake.IsZero() {
+		return idleWait
+	}
+	return wake.Sub(now)
+}
+
+// deferredCount returns the number of alerts held back
+func (w *Worker) deferredCount() int {
+	w.deferredM.Lock()
+	defer w.deferredM.Unlock()
+	return len(w.deferred)
+}
@@ -0,0 +1,82 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dmitry-vovk/csv-chg-go/api"
+	"github.com/dmitry-vovk/csv-chg-go/audit"
+	"github.com/dmitry-vovk/csv-chg-go/schedule"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuietHours(t *testing.T) {
+	quiet, err := schedule.ParseWindows([]string{"22:00-07:00"}, time.UTC)
+	require.NoError(t, err)
+	c := &mockAPIClient{}
+	a := &mockAuditor{}
+	w := New(c).WithQuietHours(quiet).WithAuditor(a)
+	night := time.Date(2021, 8, 1, 23, 0, 0, 0, time.UTC)
+	morning := time.Date(2021, 8, 2, 7, 0, 0, 0, time.UTC)
+	alert := func(at time.Time) *api.Alert {
+		return &api.Alert{Quantity: 4, Threshold: defaultThreshold, ObservedAt: at}
+	}
+	item := func(uuid string) *api.Item {
+		return &api.Item{UUID: uuid, Quantity: 4}
+	}
+	ids := []string{
+		"00000000-0000-0000-0000-000000000001",
+		"00000000-0000-0000-0000-000000000003",
+		"00000000-0000-0000-0000-000000000008",
+	}
+	// Alerts are held back, only the latest one per item is kept
+	for _, uuid := range ids {
+		w.deliver(context.Background(), keyOf(uuid), item(uuid), alert(night))
+	}
+	w.deliver(context.Background(), keyOf(ids[0]), item(ids[0]), alert(night.Add(time.Hour)))
+	assert.Equal(t, 0, c.posts)
+	assert.Equal(t, 3, w.deferredCount())
+	assert.Equal(t, night.Add(time.Hour), w.deferred[keyOf(ids[0])].alert.ObservedAt)
+	// Recovered and removed items are dropped
+	w.cancel(keyOf(ids[1]))
+	w.forget(keyOf(ids[2]))
+	assert.Equal(t, 1, w.deferredCount())
+	// Run loop wakes up at the end of quiet hours if the next cycle is later
+	next := morning.Add(time.Hour)
+	assert.Equal(t, 8*time.Hour, w.untilWake(next, night))
+	assert.Equal(t, time.Hour, w.untilWake(morning.Add(-7*time.Hour), night))
+	w.release(morning.Add(-time.Second))
+	assert.Equal(t, 0, c.posts)
+	w.release(morning)
+	w.wg.Wait()
+	assert.Equal(t, 1, c.posts)
+	assert.Equal(t, 0, w.deferredCount())
+	assert.Equal(t, 2*time.Hour, w.untilWake(next, morning.Add(-time.Hour)))
+	assert.Equal(t, idleWait, w.untilWake(time.Time{}, morning))
+	// Alerts outside quiet hours are sent right away
+	w.deliver(context.Background(), keyOf(ids[0]), item(ids[0]), alert(morning))
+	assert.Equal(t, 2, c.posts)
+	assert.Equal(t, 0, w.deferredCount())
+	var decisions []string
+	for _, r := range a.records {
+		decisions = append(decisions, r.Decision)
+	}
+	assert.Equal(t, []string{
+		audit.DecisionDeferred, audit.DecisionDeferred, audit.DecisionDeferred, audit.DecisionDeferred,
+		audit.DecisionReleased, audit.DecisionAlert,
+	}, decisions)
+}
+
+func TestNextCycle(t *testing.T) {
+	s, err := schedule.Parse([]string{"*/5 * * * *"}, time.UTC)
+	require.NoError(t, err)
+	w := New(nil).WithSchedule(s)
+	at := time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, at.Add(5*time.Minute), w.nextCycle(at, at.Add(time.Minute)))
+	// Cycles missed while the previous one was running are skipped
+	assert.Equal(t, at.Add(15*time.Minute), w.nextCycle(at, at.Add(11*time.Minute)))
+	w.WithInterval(time.Minute)
+	assert.Equal(t, at.Add(time.Minute), w.nextCycle(at, at.Add(30*time.Second)))
+}
@@ -1,35 +1,195 @@
 package worker
 
 import (
-	"bufio"
+	"bytes"
 	"io"
-	"log"
-	"regexp"
-	"strings"
+	"sync"
 	"time"
+
+	"github.com/dmitry-vovk/csv-chg-go/ident"
+)
+
+const (
+	defaultMaxLineLength = 4096      // Longer lines are rejected without being read into memory
+	chunkSize            = 256 << 10 // Approximate amount of input handed to a parser at once
+	maxLoggedLines       = 100       // Invalid and duplicate lines logged individually
+)
+
+// chunk is a batch of consecutive input lines
+type chunk struct {
+	seq   int      // Chunk sequence number
+	first int      // Number of the first line
+	lines [][]byte // Lines without line breaks, nil for lines exceeding the length limit
+}
+
+// lineKind classifies a parsed line
+type lineKind int
+
+const (
+	lineValid lineKind = iota
+	lineInvalid
+	lineTooLong
+	lineForeign
 )
 
-// ReadUUIDs scans `r` for UUIDs, one per line
+// entry is a parsed input line
+type entry struct {
+	kind     lineKind
+	id       []byte        // Binary key
+	interval time.Duration // Own check interval, 0 to follow the worker schedule
+	line     []byte        // Trimmed line content
+}
+
+// parsed is a chunk processed by a parser
+type parsed struct {
+	seq     int
+	first   int
+	entries []entry
+}
+
+// readStats counts outcomes of input lines
+type readStats struct {
+	skipped int // Invalid, too long and duplicate lines
+	foreign int // Lines belonging to other shards
+	logged  int // Lines reported in the log
+}
+
+// ReadUUIDs scans `r` for item identifiers in the configured format, one per line.
+// Lines are split by a single goroutine and validated by a pool of parsers,
+// while results are applied in input order, so line numbers and duplicates are reported consistently.
+// It should be called before Run, Add adds items to a running worker.
 func (w *Worker) ReadUUIDs(r io.Reader) error {
-	rUUID := regexp.MustCompile(`(?i)^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
-	scanner := bufio.NewScanner(r)
-	skipped := 0
 	start := time.Now()
-	for line := 1; scanner.Scan(); line++ {
-		uuid := strings.TrimSpace(scanner.Text())
-		if !rUUID.MatchString(uuid) {
-			log.Printf("Invalid UUID in line %d: %q", line, uuid)
-			skipped++
+	chunks := make(chan chunk, w.parsers)
+	results := make(chan parsed, w.parsers)
+	var wg sync.WaitGroup
+	for i := 0; i < w.parsers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range chunks {
+				results <- w.parse(c)
+			}
+		}()
+	}
+	var err error
+	go func() {
+		err = w.split(r, chunks)
+		close(chunks)
+		wg.Wait()
+		close(results)
+	}()
+	var stats readStats
+	pending := make(map[int]parsed)
+	next := 0
+	for p := range results {
+		pending[p.seq] = p
+		for p, ok := pending[next]; ok; p, ok = pending[next] {
+			delete(pending, next)
+			w.apply(p, &stats)
+			next++
+		}
+	}
+	w.logf("%d records loaded, %d skipped in %s", w.uuids.len(), stats.skipped, time.Since(start))
+	if n := w.queue.len(); n > 0 {
+		w.logf("%d records have own check intervals", n)
+	}
+	if stats.logged > maxLoggedLines {
+		w.logf("%d more invalid or duplicate lines not logged", stats.logged-maxLoggedLines)
+	}
+	if stats.foreign > 0 {
+		w.logf("%d records belong to other shards", stats.foreign)
+	}
+	return err
+}
+
+// split reads lines from `r` and sends them to `chunks` in batches
+func (w *Worker) split(r io.Reader, chunks chan<- chunk) error {
+	lr := ident.NewLineReader(r, w.maxLine)
+	newChunk := func(seq, first int) (chunk, []byte) {
+		// Extra capacity for one line, so line slices never get reallocated
+		return chunk{seq: seq, first: first}, make([]byte, 0, chunkSize+w.maxLine+1)
+	}
+	c, buf := newChunk(0, 1)
+	for {
+		b, tooLong, err := lr.Next()
+		switch {
+		case tooLong:
+			c.lines = append(c.lines, nil)
+			continue
+		case len(b) > 0:
+			start := len(buf)
+			buf = append(buf, bytes.TrimSuffix(b, []byte{'\n'})...)
+			c.lines = append(c.lines, buf[start:len(buf):len(buf)])
+		}
+		if len(c.lines) > 0 && (len(buf) >= chunkSize || err != nil) {
+			chunks <- c
+			c, buf = newChunk(c.seq+1, c.first+len(c.lines))
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// parse validates lines of the chunk
+func (w *Worker) parse(c chunk) parsed {
+	p := parsed{seq: c.seq, first: c.first, entries: make([]entry, len(c.lines))}
+	// Keys of all lines share a buffer, slices of it stay valid if it gets reallocated
+	keys := make([]byte, 0, len(c.lines)*len(compact{}))
+	for i, line := range c.lines {
+		e := &p.entries[i]
+		if line == nil {
+			e.kind = lineTooLong
 			continue
 		}
-		compactUUID := fromUUID(uuid)
-		if _, ok := w.uuids[compactUUID]; ok {
-			log.Printf("Duplicate UUID in line %d: %q", line, uuid)
-			skipped++
-		} else {
-			w.uuids[compactUUID] = struct{}{}
+		e.line = bytes.TrimSpace(line)
+		id, interval, ok := ident.SplitLine(e.line)
+		if !ok {
+			e.kind = lineInvalid
+			continue
+		}
+		e.interval = interval
+		start := len(keys)
+		if keys, ok = w.format.Parse(keys, id); !ok {
+			e.kind = lineInvalid
+			continue
+		}
+		e.id = keys[start:len(keys):len(keys)]
+		if w.sharder != nil && !w.sharder.Owns(e.id) {
+			e.kind = lineForeign
+		}
+	}
+	return p
+}
+
+// apply adds valid identifiers to the store and reports bad lines
+func (w *Worker) apply(p parsed, stats *readStats) {
+	logLine := func(format string, args ...interface{}) {
+		if stats.logged++; stats.logged <= maxLoggedLines {
+			w.logf(format, args...)
+		}
+	}
+	now := time.Now()
+	for i, e := range p.entries {
+		switch e.kind {
+		case lineForeign:
+			stats.foreign++
+		case lineInvalid:
+			logLine("Invalid ID in line %d: %q", p.first+i, e.line)
+			stats.skipped++
+		case lineTooLong:
+			logLine("Line %d is longer than %d bytes", p.first+i, w.maxLine)
+			stats.skipped++
+		default:
+			if !w.uuids.add(e.id) {
+				logLine("Duplicate ID in line %d: %q", p.first+i, e.line)
+				stats.skipped++
+			} else if e.interval > 0 {
+				w.queue.add(key(e.id), e.interval, now.Add(e.interval))
+			}
 		}
 	}
-	log.Printf("%d records loaded, %d skipped in %s", len(w.uuids), skipped, time.Since(start))
-	return scanner.Err()
 }
@@ -2,10 +2,20 @@ package worker
 
 import (
 	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/dmitry-vovk/csv-chg-go/ident"
+	"github.com/dmitry-vovk/csv-chg-go/source"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -18,17 +28,182 @@ func TestWorkerReader(t *testing.T) {
 	defer func() { _ = f.Close() }()
 	// capture error log
 	logBuffer := &bytes.Buffer{}
-	log.SetOutput(logBuffer)
-	log.SetFlags(0)
+	w.WithLogger(log.New(logBuffer, "", 0))
 	if assert.NoError(t, w.ReadUUIDs(f)) {
-		assert.Equal(t, 3, len(w.uuids))
+		assert.Equal(t, 3, w.uuids.len())
 	}
 	// check for logged error messages
 	logString := logBuffer.String()
-	assert.Contains(t, logString, `Invalid UUID in line 3: "ee88ff32-f753-4a49-abf1-2885fdfcafbaee88ff32-f753-4a49-abf1-2885fdfcafba"`)
-	assert.Contains(t, logString, `Invalid UUID in line 4: "ee88ff32-f753-4a49-abf1-2885fdfcafbz"`)
-	assert.Contains(t, logString, `Invalid UUID in line 5: ""`)
-	assert.Contains(t, logString, `Invalid UUID in line 7: "..."`)
-	assert.Contains(t, logString, `Duplicate UUID in line 8: "9E2CB4dd-bd6e-48aa-9c0d-696a058226ed"`)
+	assert.Contains(t, logString, `Invalid ID in line 3: "ee88ff32-f753-4a49-abf1-2885fdfcafbaee88ff32-f753-4a49-abf1-2885fdfcafba"`)
+	assert.Contains(t, logString, `Invalid ID in line 4: "ee88ff32-f753-4a49-abf1-2885fdfcafbz"`)
+	assert.Contains(t, logString, `Invalid ID in line 5: ""`)
+	assert.Contains(t, logString, `Invalid ID in line 7: "..."`)
+	assert.Contains(t, logString, `Duplicate ID in line 8: "9E2CB4dd-bd6e-48aa-9c0d-696a058226ed"`)
 	assert.Contains(t, logString, `3 records loaded, 5 skipped in `)
 }
+
+func TestWorkerReaderSharded(t *testing.T) {
+	owned := keyOf("767d967f-b55b-4457-bfee-685eaa6d0583")
+	w := New(nil).WithSharder(mockSharder(func(id []byte) bool { return string(id) == string(owned) }))
+	f, err := os.Open("test_data/file.csv")
+	if err != nil {
+		panic(err)
+	}
+	defer func() { _ = f.Close() }()
+	logBuffer := &bytes.Buffer{}
+	w.WithLogger(log.New(logBuffer, "", 0))
+	if assert.NoError(t, w.ReadUUIDs(f)) {
+		assert.Equal(t, mapStore{toCompact([]byte(owned)): {}}, w.uuids)
+	}
+	assert.Contains(t, logBuffer.String(), "1 records loaded, 4 skipped in ")
+	assert.Contains(t, logBuffer.String(), "3 records belong to other shards")
+}
+
+func TestWorkerReaderFormats(t *testing.T) {
+	for _, c := range []struct {
+		format   ident.Format
+		input    string
+		expected []string
+	}{
+		{
+			format:   ident.UUIDAny{},
+			input:    "{767d967f-b55b-4457-bfee-685eaa6d0583}\nURN:UUID:9e2cb4dd-bd6e-48aa-9c0d-696a058226ed\n9E2CB4DDBD6E48AA9C0D696A058226ED\n",
+			expected: []string{"767d967f-b55b-4457-bfee-685eaa6d0583", "9e2cb4dd-bd6e-48aa-9c0d-696a058226ed"},
+		},
+		{
+			format:   ident.ULID{},
+			input:    "01ARZ3NDEKTSV4RRFFQ69G5FAV\n01arz3ndektsv4rrffq69g5fav\n767d967f-b55b-4457-bfee-685eaa6d0583\n",
+			expected: []string{"01ARZ3NDEKTSV4RRFFQ69G5FAV"},
+		},
+		{
+			format:   ident.SKU{},
+			input:    "A-100\n  B.200_x \nA-100\nC 300\n",
+			expected: []string{"A-100", "B.200_x"},
+		},
+	} {
+		w := New(nil).WithIDFormat(c.format)
+		if assert.NoError(t, w.ReadUUIDs(strings.NewReader(c.input))) {
+			var ids []string
+			w.uuids.each(func(id key) bool {
+				ids = append(ids, c.format.String([]byte(id)))
+				return true
+			})
+			assert.ElementsMatch(t, c.expected, ids)
+		}
+	}
+}
+
+type mockSharder func(key []byte) bool
+
+func (m mockSharder) Owns(key []byte) bool { return m(key) }
+
+func TestWorkerReaderLimits(t *testing.T) {
+	// Input spanning several chunks with long lines and many bad lines
+	var input bytes.Buffer
+	ids := randomIDs(chunkSize/20, 5)
+	for i, id := range ids {
+		switch i {
+		case 10:
+			input.WriteString(strings.Repeat("x", 100) + "\n")
+		case 20:
+			input.WriteString(strings.Repeat("x", 50) + "\r\n")
+		}
+		input.WriteString(ident.UUID{}.String(id[:]) + "\n")
+	}
+	for i := 0; i < maxLoggedLines; i++ {
+		input.WriteString("bad\n")
+	}
+	input.WriteString(strings.Repeat("y", 1000))
+	w := New(nil).WithMaxLineLength(64).WithParsers(3)
+	logBuffer := &bytes.Buffer{}
+	w.WithLogger(log.New(logBuffer, "", 0))
+	if assert.NoError(t, w.ReadUUIDs(&input)) {
+		assert.Equal(t, len(ids), w.uuids.len())
+	}
+	logString := logBuffer.String()
+	assert.Contains(t, logString, "Line 11 is longer than 64 bytes\n")
+	assert.Contains(t, logString, `Invalid ID in line 22: "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx"`)
+	assert.Contains(t, logString, fmt.Sprintf("Invalid ID in line %d: \"bad\"\n", len(ids)+3))
+	assert.NotContains(t, logString, fmt.Sprintf("Invalid ID in line %d: \"bad\"\n", len(ids)+3+maxLoggedLines-2))
+	assert.Contains(t, logString, fmt.Sprintf("%d records loaded, %d skipped in ", len(ids), maxLoggedLines+3))
+	assert.Contains(t, logString, "3 more invalid or duplicate lines not logged")
+}
+
+func TestWithParsers(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		w := New(nil).WithParsers(n)
+		assert.Equal(t, runtime.GOMAXPROCS(0), w.parsers)
+		assert.NoError(t, w.ReadUUIDs(strings.NewReader("767d967f-b55b-4457-bfee-685eaa6d0583\n")))
+		assert.Equal(t, 1, w.uuids.len())
+	}
+}
+
+func TestWorkerReaderError(t *testing.T) {
+	w := New(nil)
+	err := w.ReadUUIDs(io.MultiReader(strings.NewReader("767d967f-b55b-4457-bfee-685eaa6d0583\n"), errReader{io.ErrUnexpectedEOF}))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	assert.Equal(t, 1, w.uuids.len())
+}
+
+// Throughput on 1M UUIDs, go test -run=- -bench=WorkerReader ./worker
+// BenchmarkWorkerReader/plain     3    491634438 ns/op   2034035 lines/s
+// BenchmarkWorkerReader/gzip      2    979847914 ns/op   1020568 lines/s
+// BenchmarkWorkerReader/gz_file   2    932637426 ns/op   1072758 lines/s
+func BenchmarkWorkerReader(b *testing.B) {
+	const n = 1000000
+	var plain, compressed bytes.Buffer
+	for _, id := range randomIDs(n, 1) {
+		plain.WriteString(ident.UUID{}.String(id[:]) + "\n")
+	}
+	z := gzip.NewWriter(&compressed)
+	_, _ = z.Write(plain.Bytes())
+	_ = z.Close()
+	b.Run("plain", func(b *testing.B) {
+		start := time.Now()
+		for i := 0; i < b.N; i++ {
+			if err := New(nil).ReadUUIDs(bytes.NewReader(plain.Bytes())); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(n*b.N)/time.Since(start).Seconds(), "lines/s")
+	})
+	b.Run("gzip", func(b *testing.B) {
+		start := time.Now()
+		for i := 0; i < b.N; i++ {
+			z, err := gzip.NewReader(bytes.NewReader(compressed.Bytes()))
+			if err != nil {
+				b.Fatal(err)
+			}
+			if err = New(nil).ReadUUIDs(z); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(n*b.N)/time.Since(start).Seconds(), "lines/s")
+	})
+	// Compressed file is decompressed ahead, in parallel with parsing
+	b.Run("gz file", func(b *testing.B) {
+		dir, err := ioutil.TempDir("", "reader")
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer func() { _ = os.RemoveAll(dir) }()
+		path := filepath.Join(dir, "input.csv.gz")
+		if err = ioutil.WriteFile(path, compressed.Bytes(), 0o644); err != nil {
+			b.Fatal(err)
+		}
+		b.ResetTimer()
+		start := time.Now()
+		for i := 0; i < b.N; i++ {
+			if err = source.ReadAny(path, New(nil).ReadUUIDs); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(n*b.N)/time.Since(start).Seconds(), "lines/s")
+	})
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
@@ -1,57 +1,479 @@
 package worker
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dmitry-vovk/csv-chg-go/api"
+	"github.com/dmitry-vovk/csv-chg-go/audit"
+	"github.com/dmitry-vovk/csv-chg-go/history"
+	"github.com/dmitry-vovk/csv-chg-go/rules"
+	"github.com/dmitry-vovk/csv-chg-go/sink"
 )
 
-// Run is the main worker loop
-func (w *Worker) Run() {
-	t := time.NewTicker(w.interval)
+// ErrStarted is returned by Run if the worker has already been started
+var ErrStarted = errors.New("worker has already been started")
+
+// ErrNoSchedule is returned by Run if neither interval nor schedule is set
+var ErrNoSchedule = errors.New("worker has no interval or schedule")
+
+// Run is the main worker loop.
+// Items following the worker schedule are checked in cycles running in the background,
+// items with their own intervals are checked whenever they are due, also during cycles.
+// It stops when Shutdown is called or `ctx` is cancelled, and returns once checks in progress complete
+// or the drain timeout is exceeded, with the context error if it was cancelled.
+func (w *Worker) Run(ctx context.Context) error {
+	if w.schedule == nil {
+		return ErrNoSchedule
+	}
+	w.startedM.Lock()
+	if w.started {
+		w.startedM.Unlock()
+		return ErrStarted
+	}
+	w.started = true
+	w.startedM.Unlock()
+	next := w.nextCycle(time.Now(), time.Now())
+	t := time.NewTimer(w.untilWake(next, time.Now()))
+	cycleDoneC := make(chan struct{}, 1)
+	cycling := false
 out:
 	for {
 		select {
 		case <-w.doneC:
 			break out
-		case id := <-w.deleteC:
-			delete(w.uuids, id)
+		case <-ctx.Done():
+			w.stopOnce.Do(func() { close(w.doneC) })
+			break out
+		case <-cycleDoneC:
+			cycling = false
+			continue
+		case <-w.queue.wakeC:
 		case <-t.C:
-			for id := range w.uuids {
-				w.limitC <- struct{}{}
+		}
+		now := time.Now()
+		w.release(now)
+		if !next.IsZero() && !now.Before(next) {
+			switch {
+			case cycling:
+				w.logf("Previous cycle is still running, skipping")
+			case w.isActive():
+				cycling = true
 				w.wg.Add(1)
-				go w.process(id)
+				go func() {
+					defer w.wg.Done()
+					w.cycle()
+					cycleDoneC <- struct{}{}
+				}()
 			}
-			w.wg.Wait()
+			next = w.nextCycle(next, now)
 		}
+		w.checkDue(now)
+		if !t.Stop() {
+			select {
+			case <-t.C:
+			default:
+			}
+		}
+		t.Reset(w.untilWake(next, time.Now()))
 	}
 	t.Stop()
+	w.drainChecks()
+	w.summarize()
 	close(w.stoppedC)
+	return ctx.Err()
+}
+
+// abortWait is how long aborted checks are given to return before they are abandoned
+const abortWait = time.Second
+
+// drainChecks waits for checks in progress to complete.
+// Once drain timeout is exceeded their requests are cancelled, and checks still running are abandoned.
+func (w *Worker) drainChecks() {
+	drainedC := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(drainedC)
+	}()
+	if w.drain <= 0 {
+		<-drainedC
+		return
+	}
+	t := time.NewTimer(w.drain)
+	defer t.Stop()
+	select {
+	case <-drainedC:
+		return
+	case <-t.C:
+	}
+	w.logf("Drain timeout of %s exceeded, aborting %d checks in progress", w.drain, len(w.checking()))
+	w.abort()
+	t.Reset(abortWait)
+	select {
+	case <-drainedC:
+	case <-t.C:
+	}
+}
+
+// maxListed limits the number of abandoned items listed in the shutdown summary
+const maxListed = 10
+
+// summarize logs what was left unprocessed at shutdown
+func (w *Worker) summarize() {
+	skipped := atomic.LoadInt64(&w.skipped)
+	abandoned := w.checking()
+	deferred := w.deferredCount()
+	if skipped == 0 && len(abandoned) == 0 && deferred == 0 {
+		w.logf("Shutdown complete, nothing left unprocessed")
+		return
+	}
+	w.logf("Shutdown left %d items not checked, %d checks abandoned, %d deferred alerts not delivered", skipped, len(abandoned), deferred)
+	if len(abandoned) > maxListed {
+		abandoned = append(abandoned[:maxListed], "...")
+	}
+	if len(abandoned) > 0 {
+		w.logf("Abandoned checks: %s", strings.Join(abandoned, ", "))
+	}
+}
+
+// checking returns sorted UUIDs of items being checked
+func (w *Worker) checking() []string {
+	w.inFlightM.Lock()
+	defer w.inFlightM.Unlock()
+	list := make([]string, 0, len(w.inFlight))
+	for id := range w.inFlight {
+		list = append(list, w.format.String([]byte(id)))
+	}
+	sort.Strings(list)
+	return list
 }
 
-// process takes a UUID and runs API queries against it
-func (w *Worker) process(id compact) {
-	uuid := id.String()
-	if item, err := w.client.GetItem(uuid); err != nil {
-		if err == api.ErrBadRequest {
-			log.Printf("API indicated UUID %q not found, removing", uuid)
-			go func() { w.deleteC <- id }()
+// cycle checks items following the worker schedule and waits for requests to complete,
+// it stops dispatching checks on shutdown, counting items left unchecked
+func (w *Worker) cycle() {
+	ctx, span := w.tracer.Start(w.ctx, "cycle")
+	defer span.End()
+	var (
+		wg    sync.WaitGroup
+		items int
+		now   = time.Now()
+	)
+	w.scheduled(func(id key) {
+		if w.backingOff(id, now) {
+			return
+		}
+		if w.stopping() {
+			atomic.AddInt64(&w.skipped, 1)
+			return
+		}
+		wg.Add(1)
+		items++
+		w.dispatch(ctx, id, wg.Done)
+	})
+	wg.Wait()
+	span.SetAttribute("items", items)
+}
+
+// scheduled calls `fn` for items following the worker schedule, skipping items with own intervals.
+// The store is only walked by cycles, which check every item it holds anyway, while items with own
+// intervals are popped from the queue when due, so waking up for them does not depend on the store size.
+// Scheduled items are not queued individually to keep the memory of compact stores small.
+func (w *Worker) scheduled(fn func(id key)) {
+	w.iterate(func(id key) bool {
+		if !w.queue.has(id) {
+			fn(id)
+		}
+		return true
+	})
+}
+
+// checkDue checks items with own intervals that are due at `now` in the background.
+// While standby, due items are rescheduled without checking, as are items backing off.
+func (w *Worker) checkDue(now time.Time) {
+	due := w.queue.popDue(now)
+	if len(due) == 0 {
+		return
+	}
+	active := w.isActive()
+	ids := due[:0]
+	for _, id := range due {
+		if active && !w.backingOff(id, now) {
+			ids = append(ids, id)
 		} else {
-			log.Printf("API error: %s", err)
+			w.queue.requeue(id, now)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		for _, id := range ids {
+			w.dispatch(w.ctx, id, nil)
 		}
+	}()
+}
+
+// dispatch checks the item in a new goroutine once the limiter allows, then calls `done` unless nil.
+// Items with own intervals are queued again after the check.
+// Items are not checked once shutdown is requested.
+func (w *Worker) dispatch(ctx context.Context, id key, done func()) {
+	w.limiter.Acquire()
+	if w.stopping() {
+		w.limiter.Release()
+		atomic.AddInt64(&w.skipped, 1)
+		if done != nil {
+			done()
+		}
+		return
+	}
+	w.inFlightM.Lock()
+	w.inFlight[id] = struct{}{}
+	w.inFlightM.Unlock()
+	w.wg.Add(1)
+	go func() {
+		w.process(ctx, id)
+		w.inFlightM.Lock()
+		delete(w.inFlight, id)
+		w.inFlightM.Unlock()
+		w.limiter.Release()
+		w.queue.requeue(id, time.Now())
+		if done != nil {
+			done()
+		}
+		w.wg.Done()
+	}()
+}
+
+// nextCycle returns the first scheduled cycle after `prev` that is not in the past,
+// skipping cycles missed while the previous one was running, zero if there are no more cycles
+func (w *Worker) nextCycle(prev, now time.Time) time.Time {
+	next := w.schedule.Next(prev)
+	if !next.IsZero() && next.Before(now) {
+		next = w.schedule.Next(now)
+	}
+	return next
+}
+
+// isActive tells whether check cycle should run, logging leadership changes
+func (w *Worker) isActive() bool {
+	active := w.leader == nil || w.leader.IsLeader()
+	if active == w.standby {
+		if active {
+			w.logf("Leader, running checks")
+		} else {
+			w.logf("Standby, skipping checks")
+		}
+	}
+	w.standby = !active
+	return active
+}
+
+// process takes an item identifier and runs API queries against it
+func (w *Worker) process(ctx context.Context, id key) {
+	uuid := w.format.String([]byte(id))
+	ctx, span := w.tracer.Start(ctx, "process")
+	defer span.End()
+	span.SetAttribute("item.id", uuid)
+	start := time.Now()
+	item, err := w.getItem(ctx, uuid)
+	w.limiter.Observe(time.Since(start), overloaded(err))
+	w.requests.Inc()
+	if err != nil {
+		span.SetError(err)
+		w.apiErrors.Inc()
+		w.handleError(id, uuid, err)
+		w.report(Result{UUID: uuid, Decision: audit.DecisionError, Err: err})
 	} else if item.UUID != uuid {
-		log.Printf("APi returned wrong item, expected %q, got %q", uuid, item.UUID)
-	} else if item.Quantity < 5 {
-		if err = w.client.PostAlert(uuid); err != nil {
-			if err == api.ErrBadRequest {
-				log.Printf("API indicated UUID %q not found, removing", uuid)
-				go func() { w.deleteC <- id }()
-			} else {
-				log.Printf("API error: %s", err)
-			}
+		err = fmt.Errorf("API returned item %q", item.UUID)
+		span.SetError(err)
+		w.logf("APi returned wrong item, expected %q, got %q", uuid, item.UUID)
+		w.report(Result{UUID: uuid, Decision: audit.DecisionError, Err: err})
+	} else if alert := w.check(id, item); alert != nil {
+		span.SetAttribute("item.quantity", item.Quantity)
+		span.SetAttribute("alert.severity", alert.Severity)
+		w.deliver(ctx, id, item, alert)
+	} else {
+		span.SetAttribute("item.quantity", item.Quantity)
+		w.cancel(id)
+		w.report(Result{UUID: uuid, Item: item, Decision: audit.DecisionNoAlert})
+	}
+}
+
+// getItem requests the item with `ctx` if the client supports it
+func (w *Worker) getItem(ctx context.Context, uuid string) (*api.Item, error) {
+	if c, ok := w.client.(contextAPIClient); ok {
+		return c.GetItemContext(ctx, uuid)
+	}
+	return w.client.GetItem(uuid)
+}
+
+// send delivers the alert to the sink of its severity and reports the result.
+// Only errors of the API sink affect further checks of the item, other sinks' errors are just logged.
+func (w *Worker) send(ctx context.Context, id key, res Result) {
+	ctx, span := w.tracer.Start(ctx, "send alert")
+	defer span.End()
+	span.SetAttribute("item.id", res.UUID)
+	span.SetAttribute("alert.severity", res.Alert.Severity)
+	s := w.sinkFor(res.Alert.Severity)
+	var err error
+	if cs, ok := s.(sink.ContextSink); ok {
+		err = cs.SendContext(ctx, res.UUID, res.Alert)
+	} else {
+		err = s.Send(res.UUID, res.Alert)
+	}
+	if err != nil {
+		span.SetError(err)
+		if _, ok := s.(sink.API); ok {
+			w.handleError(id, res.UUID, err)
+		} else {
+			w.logf("Error sending alert about %q to %s sink: %s", res.UUID, sinkName(s), err)
+		}
+	}
+	res.Sink, res.Err = sinkName(s), err
+	w.report(res)
+}
+
+// report passes check result to the result hook and the auditor
+func (w *Worker) report(res Result) {
+	if w.onResult != nil {
+		w.onResult(res)
+	}
+	if w.auditor == nil {
+		return
+	}
+	r := audit.Record{UUID: res.UUID, Threshold: w.threshold, Decision: res.Decision, Sink: res.Sink}
+	r.SetError(res.Err)
+	if res.Item != nil {
+		quantity := res.Item.Quantity
+		r.Quantity = &quantity
+	}
+	if a := res.Alert; a != nil {
+		quantity := a.Quantity
+		r.Quantity, r.Threshold, r.Rules, r.Reason, r.Severity = &quantity, a.Threshold, a.Rules, a.Reason, a.Severity
+	}
+	if err := w.auditor.Record(r); err != nil {
+		w.logf("Error recording audit: %s", err)
+	}
+}
+
+// overloaded tells whether `err` indicates API overload or outage, rather than a rejected request
+func overloaded(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, api.ErrServerError) || errors.Is(err, api.ErrTooManyRequests) {
+		return true
+	}
+	var timeout interface{ Timeout() bool }
+	return errors.As(err, &timeout) && timeout.Timeout()
+}
+
+// handleError logs API error, removing the item if API does not know it.
+// Items failing for retryable reasons are checked again as usual,
+// while checks of items failing permanently are delayed more with every error.
+func (w *Worker) handleError(id key, uuid string, err error) {
+	switch {
+	case errors.Is(err, api.ErrNotFound), errors.Is(err, api.ErrBadRequest):
+		w.logf("API indicated UUID %q not found, removing", uuid)
+		w.change(change{id: id, remove: true})
+	case api.Retryable(err):
+		w.logf("API error: %s", err)
+	default:
+		delay := w.backOff(id, time.Now())
+		w.logf("Permanent API error, checking %q again in %s: %s", uuid, delay, err)
+	}
+}
+
+// check records the item observation and returns an alert if one should be raised
+func (w *Worker) check(id key, item *api.Item) *api.Alert {
+	now := time.Now().UTC()
+	w.recovered(id)
+	if w.maxAuto > 0 {
+		w.adaptInterval(id, item.Quantity, now)
+	}
+	if w.history != nil {
+		if err := w.history.Record(history.Observation{UUID: item.UUID, Quantity: item.Quantity, At: now}); err != nil {
+			w.logf("Error recording history: %s", err)
+		}
+	}
+	previous, hasPrevious := w.previous(id)
+	alert := w.evaluate(item, previous, hasPrevious, now)
+	severity := ""
+	if alert != nil {
+		severity = alert.Severity
+	}
+	state := w.transition(id, item.Quantity, severity, now)
+	if alert == nil {
+		return nil
+	}
+	alert.StateSince = &state.since
+	alert.Cycles = state.cycles
+	if w.escalation > 0 && state.cycles >= w.escalation {
+		w.logf("Item %q has been %s for %d cycles since %s, escalating", item.UUID, state.severity, state.cycles, state.since.Format(time.RFC3339))
+		alert.Severity = SeverityEscalation
+	}
+	return alert
+}
+
+// Evaluate returns the alert the worker would raise for `item` now, nil if none,
+// without recording the observation or changing item state.
+// Items not observed by the worker yet are compared to their last observation in history, if it is set.
+func (w *Worker) Evaluate(item *api.Item) *api.Alert {
+	id, _ := w.format.Parse(nil, []byte(item.UUID))
+	previous, ok := w.previous(key(id))
+	if h, recent := w.history.(recentHistory); !ok && recent {
+		if obs := h.Recent(item.UUID); len(obs) > 0 {
+			previous, ok = obs[len(obs)-1].Quantity, true
+		}
+	}
+	return w.evaluate(item, previous, ok, time.Now().UTC())
+}
+
+// Send delivers `alert` about `uuid` to the sink of its severity and returns the sink name
+func (w *Worker) Send(uuid string, alert *api.Alert) (string, error) {
+	s := w.sinkFor(alert.Severity)
+	return sinkName(s), s.Send(uuid, alert)
+}
+
+// evaluate applies rules and stockout prediction to the item, `previous` quantity is set if `hasPrevious`
+func (w *Worker) evaluate(item *api.Item, previous int, hasPrevious bool, now time.Time) *api.Alert {
+	alert := &api.Alert{
+		Quantity:   item.Quantity,
+		Threshold:  w.threshold,
+		Name:       item.Name,
+		ObservedAt: now,
+		InstanceID: w.instanceID,
+	}
+	env := &rules.Env{
+		UUID:      item.UUID,
+		Name:      item.Name,
+		Quantity:  item.Quantity,
+		Threshold: w.threshold,
+	}
+	env.Previous, env.HasPrevious = previous, hasPrevious
+	if matched := w.rules.Evaluate(env); len(matched) > 0 {
+		alert.Reason = api.ReasonRule
+		alert.Severity = matched.Severity()
+		alert.Rules = matched.Names()
+		w.logf("Item %q matched rules %s, severity %s", item.UUID, strings.Join(alert.Rules, ", "), alert.Severity)
+		return alert
+	}
+	if w.history != nil && w.horizon > 0 {
+		if at, ok := w.history.StockoutAt(item.UUID); ok && at.Before(now.Add(w.horizon)) {
+			w.logf("Item %q is projected to run out of stock at %s", item.UUID, at.Format(time.RFC3339))
+			alert.Reason = api.ReasonPredictedStockout
+			alert.Severity = rules.SeverityWarning
+			alert.PredictedStockoutAt = &at
+			return alert
 		}
 	}
-	<-w.limitC
-	w.wg.Done()
+	return nil
 }
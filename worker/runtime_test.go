@@ -2,15 +2,32 @@ package worker
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/dmitry-vovk/csv-chg-go/api"
+	"github.com/dmitry-vovk/csv-chg-go/audit"
+	"github.com/dmitry-vovk/csv-chg-go/history"
+	"github.com/dmitry-vovk/csv-chg-go/limit"
+	"github.com/dmitry-vovk/csv-chg-go/metrics"
+	"github.com/dmitry-vovk/csv-chg-go/rules"
+	"github.com/dmitry-vovk/csv-chg-go/sink"
+	"github.com/dmitry-vovk/csv-chg-go/trace"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 type testCase struct {
@@ -60,10 +77,8 @@ func TestRuntime(t *testing.T) {
 	assert.NoError(t, w.ReadUUIDs(strings.NewReader(strings.Join(ids, "\n"))))
 	// capture error log
 	logBuffer := &bytes.Buffer{}
-	log.SetOutput(logBuffer)
-	log.SetFlags(0)
-	defer log.SetOutput(os.Stderr)
-	go w.Run()
+	w.WithLogger(log.New(logBuffer, "", 0))
+	go w.Run(context.Background())
 	// Sleep for little longer than 'runtime' full cycles
 	time.Sleep(2*time.Second + 70*time.Millisecond)
 	w.Shutdown()
@@ -101,11 +116,14 @@ func (m *mockAPIClient) GetItem(uuid string) (*api.Item, error) {
 	return nil, api.ErrBadRequest
 }
 
-func (m *mockAPIClient) PostAlert(uuid string) error {
+func (m *mockAPIClient) PostAlert(uuid string, alert *api.Alert) error {
 	m.m.Lock()
 	defer m.m.Unlock()
 	time.Sleep(10 * time.Millisecond)
 	m.posts++
+	if alert == nil || alert.Threshold != defaultThreshold || alert.Quantity >= alert.Threshold {
+		panic("unexpected alert payload")
+	}
 	if u, ok := testCases[uuid]; ok {
 		if u.postError != nil {
 			return u.postError
@@ -113,3 +131,415 @@ func (m *mockAPIClient) PostAlert(uuid string) error {
 	}
 	return nil
 }
+
+func TestOverloaded(t *testing.T) {
+	assert.False(t, overloaded(nil))
+	assert.False(t, overloaded(api.ErrBadRequest))
+	assert.True(t, overloaded(api.ErrServerError))
+	assert.True(t, overloaded(fmt.Errorf("getting item: %w", api.ErrServerError)))
+	assert.True(t, overloaded(&url.Error{Op: "Get", URL: "http://api", Err: timeoutError{}}))
+	assert.False(t, overloaded(errors.New("connection refused")))
+	assert.True(t, overloaded(&api.StatusError{StatusCode: 429}))
+	assert.True(t, overloaded(&api.StatusError{StatusCode: 503}))
+	assert.False(t, overloaded(&api.StatusError{StatusCode: 404}))
+}
+
+func TestHandleError(t *testing.T) {
+	logBuffer := &bytes.Buffer{}
+	w := New(nil).WithLogger(log.New(logBuffer, "", 0))
+	uuid := "00000000-0000-0000-0000-000000000001"
+	id := keyOf(uuid)
+	assert.NoError(t, w.Add(uuid))
+	w.handleError(id, uuid, fmt.Errorf("getting item: %w", &api.StatusError{StatusCode: 404}))
+	assert.Empty(t, w.List())
+	w.handleError(id, uuid, &api.StatusError{Method: "GET", URL: "http://api/item", StatusCode: 503})
+	w.handleError(id, uuid, &api.StatusError{Method: "GET", URL: "http://api/item", StatusCode: 403})
+	assert.Equal(t, `API indicated UUID "00000000-0000-0000-0000-000000000001" not found, removing
+API error: GET http://api/item: unexpected status code 503
+Permanent API error, checking "00000000-0000-0000-0000-000000000001" again in 1m0s: GET http://api/item: unexpected status code 403
+`, logBuffer.String())
+	assert.True(t, w.backingOff(id, time.Now()))
+}
+
+func TestSendSinkError(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer s.Close()
+	logBuffer := &bytes.Buffer{}
+	var results []Result
+	w := New(&mockAPIClient{}).
+		WithSink(rules.SeverityWarning, sink.NewWebhook(s.URL)).
+		WithResultHook(func(res Result) { results = append(results, res) }).
+		WithLogger(log.New(logBuffer, "", 0))
+	uuid := "00000000-0000-0000-0000-000000000001"
+	id := keyOf(uuid)
+	assert.NoError(t, w.Add(uuid))
+	w.send(context.Background(), id, Result{UUID: uuid, Alert: &api.Alert{Severity: rules.SeverityWarning}, Decision: audit.DecisionAlert})
+	assert.False(t, w.backingOff(id, time.Now()), "webhook errors do not stop checks")
+	assert.Equal(t, []string{uuid}, w.List())
+	assert.Contains(t, logBuffer.String(), `Error sending alert about "00000000-0000-0000-0000-000000000001" to webhook sink: `)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "webhook", results[0].Sink)
+		assert.True(t, errors.As(results[0].Err, &sink.ErrBadResponseCode{}))
+	}
+}
+
+func TestProcessLimiter(t *testing.T) {
+	c := &mockAPIClient{}
+	l := limit.NewAIMD(10, 1, 10, time.Second)
+	r := metrics.NewRegistry()
+	w := New(c).WithLimiter(l).WithMetrics(r)
+	for _, uuid := range []string{"00000000-0000-0000-0000-000000000001", "00000000-0000-0000-0000-000000000005"} {
+		w.dispatch(context.Background(), keyOf(uuid), nil)
+		w.wg.Wait()
+	}
+	assert.Equal(t, 9, l.Limit(), "limit is cut on server error")
+	assert.Equal(t, 0, l.InFlight())
+	var buf bytes.Buffer
+	_, err := r.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "\ncsvchg_concurrency_limit 9\n")
+	assert.Contains(t, buf.String(), "\ncsvchg_requests_in_flight 0\n")
+	assert.Contains(t, buf.String(), "\ncsvchg_api_requests_total 2\n")
+	assert.Contains(t, buf.String(), "\ncsvchg_api_errors_total 1\n")
+}
+
+func TestProcessTimeout(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer s.Close()
+	// Latency target is never reached, so only timed out requests shrink the limit
+	l := limit.NewAIMD(10, 1, 10, time.Hour)
+	w := New(api.New(s.URL).WithTimeout(20 * time.Millisecond)).WithLimiter(l)
+	w.dispatch(context.Background(), keyOf("00000000-0000-0000-0000-000000000001"), nil)
+	w.wg.Wait()
+	assert.Equal(t, 9, l.Limit(), "limit is cut on timeout")
+	assert.Equal(t, 0, l.InFlight())
+}
+
+// spanRecorder is a trace exporter keeping exported spans after shutdown
+type spanRecorder struct {
+	*tracetest.InMemoryExporter
+}
+
+func (spanRecorder) Shutdown(context.Context) error { return nil }
+
+func TestTracing(t *testing.T) {
+	r := spanRecorder{InMemoryExporter: tracetest.NewInMemoryExporter()}
+	tracer := trace.New(r, "csv-chg-go", 1)
+	w := New(&mockAPIClient{}).WithTracer(tracer)
+	ids := []string{"00000000-0000-0000-0000-000000000007", "00000000-0000-0000-0000-000000000005"}
+	assert.NoError(t, w.ReadUUIDs(strings.NewReader(strings.Join(ids, "\n"))))
+	w.cycle()
+	tracer.Close()
+	byName := make(map[string][]tracetest.SpanStub)
+	for _, s := range r.GetSpans() {
+		byName[s.Name] = append(byName[s.Name], s)
+	}
+	if assert.Len(t, byName["cycle"], 1) && assert.Len(t, byName["process"], 2) && assert.Len(t, byName["send alert"], 1) {
+		cycle := byName["cycle"][0]
+		assert.Contains(t, cycle.Attributes, attribute.Int("items", 2))
+		for _, p := range byName["process"] {
+			assert.Equal(t, cycle.SpanContext.TraceID(), p.SpanContext.TraceID())
+			assert.Equal(t, cycle.SpanContext.SpanID(), p.Parent.SpanID())
+			if p.Attributes[0].Value.AsString() == ids[1] {
+				assert.Equal(t, "internal server error", p.Status.Description)
+			} else {
+				assert.Contains(t, p.Attributes, attribute.String("alert.severity", rules.SeverityWarning))
+				send := byName["send alert"][0]
+				assert.Equal(t, p.SpanContext.SpanID(), send.Parent.SpanID())
+				assert.Equal(t, "internal server error", send.Status.Description)
+			}
+		}
+	}
+}
+
+// mockAuditor keeps recorded alert decisions
+type mockAuditor struct {
+	m       sync.Mutex
+	records []audit.Record
+}
+
+func (a *mockAuditor) Record(r audit.Record) error {
+	a.m.Lock()
+	defer a.m.Unlock()
+	a.records = append(a.records, r)
+	return nil
+}
+
+// byUUID returns recorded decisions by item UUID
+func (a *mockAuditor) byUUID() map[string]audit.Record {
+	a.m.Lock()
+	defer a.m.Unlock()
+	m := make(map[string]audit.Record)
+	for _, r := range a.records {
+		m[r.UUID] = r
+	}
+	return m
+}
+
+func TestAudit(t *testing.T) {
+	a := &mockAuditor{}
+	w := New(&mockAPIClient{}).WithAuditor(a).WithLogger(log.New(ioutil.Discard, "", 0))
+	ids := []string{
+		"00000000-0000-0000-0000-000000000001",
+		"00000000-0000-0000-0000-000000000004",
+		"00000000-0000-0000-0000-000000000005",
+		"00000000-0000-0000-0000-000000000007",
+	}
+	assert.NoError(t, w.ReadUUIDs(strings.NewReader(strings.Join(ids, "\n"))))
+	w.cycle()
+	quantity := func(q int) *int { return &q }
+	assert.Equal(t, map[string]audit.Record{
+		ids[0]: {UUID: ids[0], Quantity: quantity(10), Threshold: defaultThreshold, Decision: audit.DecisionNoAlert},
+		ids[1]: {UUID: ids[1], Threshold: defaultThreshold, Decision: audit.DecisionError, Error: `API returned item "00000000-dead-beef-0000-000000000004"`},
+		ids[2]: {UUID: ids[2], Threshold: defaultThreshold, Decision: audit.DecisionError, Error: "internal server error"},
+		ids[3]: {
+			UUID:      ids[3],
+			Quantity:  quantity(4),
+			Threshold: defaultThreshold,
+			Rules:     []string{"below_threshold"},
+			Reason:    api.ReasonRule,
+			Severity:  rules.SeverityWarning,
+			Decision:  audit.DecisionAlert,
+			Sink:      "api",
+			Error:     "internal server error",
+		},
+	}, a.byUUID())
+	assert.Len(t, a.records, 4)
+}
+
+func TestResultHook(t *testing.T) {
+	var (
+		m       sync.Mutex
+		results = make(map[string]Result)
+	)
+	w := New(&mockAPIClient{}).WithResultHook(func(r Result) {
+		m.Lock()
+		results[r.UUID] = r
+		m.Unlock()
+	})
+	ids := []string{
+		"00000000-0000-0000-0000-000000000001",
+		"00000000-0000-0000-0000-000000000005",
+		"00000000-0000-0000-0000-000000000007",
+	}
+	assert.NoError(t, w.Add(ids...))
+	w.cycle()
+	if assert.Len(t, results, 3) {
+		ok, failed, alerted := results[ids[0]], results[ids[1]], results[ids[2]]
+		assert.Equal(t, Result{UUID: ids[0], Item: &api.Item{UUID: ids[0], Quantity: 10}, Decision: audit.DecisionNoAlert}, ok)
+		assert.Equal(t, Result{UUID: ids[1], Decision: audit.DecisionError, Err: api.ErrServerError}, failed)
+		assert.Equal(t, &api.Item{UUID: ids[2], Quantity: 4}, alerted.Item)
+		if assert.NotNil(t, alerted.Alert) {
+			assert.Equal(t, rules.SeverityWarning, alerted.Alert.Severity)
+		}
+		assert.Equal(t, audit.DecisionAlert, alerted.Decision)
+		assert.Equal(t, "api", alerted.Sink)
+		assert.Equal(t, api.ErrServerError, alerted.Err)
+	}
+}
+
+// hungClient is an API client whose item requests hang until their context is cancelled
+type hungClient struct {
+	mockAPIClient
+}
+
+func (c *hungClient) GetItemContext(ctx context.Context, uuid string) (*api.Item, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestDrainTimeout(t *testing.T) {
+	logBuffer := &bytes.Buffer{}
+	ids := []string{
+		"00000000-0000-0000-0000-000000000001",
+		"00000000-0000-0000-0000-000000000002",
+		"00000000-0000-0000-0000-000000000003",
+	}
+	w := New(&hungClient{}).
+		WithInterval(10 * time.Millisecond).
+		WithDrainTimeout(50 * time.Millisecond).
+		WithLogger(log.New(logBuffer, "", 0))
+	assert.NoError(t, w.ReadUUIDs(strings.NewReader(strings.Join(ids, "\n"))))
+	go func() { assert.NoError(t, w.Run(context.Background())) }()
+	time.Sleep(30 * time.Millisecond) // Wait for the first cycle to start
+	start := time.Now()
+	w.Shutdown()
+	assert.WithinDuration(t, start.Add(50*time.Millisecond), time.Now(), 40*time.Millisecond)
+	// One item is checked at a time, the rest are left unchecked
+	assert.Contains(t, logBuffer.String(), "Drain timeout of 50ms exceeded, aborting 1 checks in progress\n")
+	assert.Contains(t, logBuffer.String(), "Shutdown left 2 items not checked, 0 checks abandoned, 0 deferred alerts not delivered\n")
+}
+
+func TestAbandonedChecks(t *testing.T) {
+	logBuffer := &bytes.Buffer{}
+	w := New(nil).WithLogger(log.New(logBuffer, "", 0)).WithWorkersCount(20)
+	for i := 0; i < 12; i++ {
+		w.inFlight[keyOf(fmt.Sprintf("00000000-0000-0000-0000-%012d", i))] = struct{}{}
+	}
+	w.deferred[keyOf("00000000-0000-0000-0000-000000000001")] = deferred{}
+	w.summarize()
+	assert.Equal(t, `Shutdown left 0 items not checked, 12 checks abandoned, 1 deferred alerts not delivered
+Abandoned checks: 00000000-0000-0000-0000-000000000000, 00000000-0000-0000-0000-000000000001, `+
+		`00000000-0000-0000-0000-000000000002, 00000000-0000-0000-0000-000000000003, 00000000-0000-0000-0000-000000000004, `+
+		`00000000-0000-0000-0000-000000000005, 00000000-0000-0000-0000-000000000006, 00000000-0000-0000-0000-000000000007, `+
+		`00000000-0000-0000-0000-000000000008, 00000000-0000-0000-0000-000000000009, ...
+`, logBuffer.String())
+	// Nothing is dispatched after shutdown
+	c := &mockAPIClient{}
+	w = New(c).WithLogger(log.New(logBuffer, "", 0))
+	assert.NoError(t, w.ReadUUIDs(strings.NewReader("00000000-0000-0000-0000-000000000001")))
+	w.Shutdown()
+	w.cycle()
+	assert.Zero(t, c.gets)
+	assert.Equal(t, int64(1), w.skipped)
+	logBuffer.Reset()
+	w = New(nil).WithLogger(log.New(logBuffer, "", 0))
+	w.summarize()
+	assert.Equal(t, "Shutdown complete, nothing left unprocessed\n", logBuffer.String())
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestCheck(t *testing.T) {
+	h := &mockHistory{stockouts: map[string]time.Duration{
+		"00000000-0000-0000-0000-000000000001": time.Hour,
+		"00000000-0000-0000-0000-000000000002": 48 * time.Hour,
+	}}
+	w := New(nil).WithInstanceID("worker-1").WithHistory(h, 24*time.Hour)
+	t.Run("below threshold", func(t *testing.T) {
+		if alert := w.check(keyOf("00000000-0000-0000-0000-000000000003"), &api.Item{UUID: "00000000-0000-0000-0000-000000000003", Name: "item", Quantity: 4}); assert.NotNil(t, alert) {
+			assert.Equal(t, api.ReasonRule, alert.Reason)
+			assert.Equal(t, rules.SeverityWarning, alert.Severity)
+			assert.Equal(t, []string{"below_threshold"}, alert.Rules)
+			assert.Equal(t, 4, alert.Quantity)
+			assert.Equal(t, defaultThreshold, alert.Threshold)
+			assert.Equal(t, "item", alert.Name)
+			assert.Equal(t, "worker-1", alert.InstanceID)
+			assert.Nil(t, alert.PredictedStockoutAt)
+		}
+	})
+	t.Run("predicted", func(t *testing.T) {
+		if alert := w.check(keyOf("00000000-0000-0000-0000-000000000001"), &api.Item{UUID: "00000000-0000-0000-0000-000000000001", Quantity: 10}); assert.NotNil(t, alert) {
+			assert.Equal(t, api.ReasonPredictedStockout, alert.Reason)
+			assert.NotNil(t, alert.PredictedStockoutAt)
+		}
+	})
+	t.Run("beyond horizon", func(t *testing.T) {
+		assert.Nil(t, w.check(keyOf("00000000-0000-0000-0000-000000000002"), &api.Item{UUID: "00000000-0000-0000-0000-000000000002", Quantity: 10}))
+	})
+	t.Run("no prediction", func(t *testing.T) {
+		assert.Nil(t, w.check(keyOf("00000000-0000-0000-0000-000000000004"), &api.Item{UUID: "00000000-0000-0000-0000-000000000004", Quantity: 10}))
+	})
+	assert.Equal(t, 4, len(h.recorded))
+}
+
+func TestCheckRules(t *testing.T) {
+	set, err := rules.Parse(strings.NewReader(`
+out_of_stock critical quantity == 0
+sudden_drop  warning  has_previous && drop_pct >= 50
+`))
+	if err != nil {
+		panic(err)
+	}
+	w := New(nil).WithRules(set)
+	id := keyOf("00000000-0000-0000-0000-000000000001")
+	item := &api.Item{UUID: "00000000-0000-0000-0000-000000000001", Quantity: 10}
+	assert.Nil(t, w.check(id, item), "first observation has nothing to compare to")
+	item.Quantity = 4
+	if alert := w.check(id, item); assert.NotNil(t, alert) {
+		assert.Equal(t, []string{"sudden_drop"}, alert.Rules)
+		assert.Equal(t, rules.SeverityWarning, alert.Severity)
+	}
+	item.Quantity = 0
+	if alert := w.check(id, item); assert.NotNil(t, alert) {
+		assert.Equal(t, []string{"out_of_stock", "sudden_drop"}, alert.Rules)
+		assert.Equal(t, rules.SeverityCritical, alert.Severity)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	w := New(nil).WithThreshold(5)
+	item := &api.Item{UUID: "00000000-0000-0000-0000-000000000001", Name: "item", Quantity: 4}
+	for i := 0; i < 2; i++ {
+		if alert := w.Evaluate(item); assert.NotNil(t, alert) {
+			assert.Equal(t, rules.SeverityWarning, alert.Severity)
+			assert.Equal(t, []string{"below_threshold"}, alert.Rules)
+			assert.Equal(t, 0, alert.Cycles, "state should not be tracked")
+		}
+	}
+	assert.Empty(t, w.states)
+	item.Quantity = 5
+	assert.Nil(t, w.Evaluate(item))
+}
+
+func TestEvaluatePrevious(t *testing.T) {
+	set, err := rules.Parse(strings.NewReader("sudden_drop warning has_previous && drop_pct >= 50\n"))
+	if err != nil {
+		panic(err)
+	}
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		panic(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	h, err := history.Open(filepath.Join(dir, "history.jsonl"), time.Hour)
+	if err != nil {
+		panic(err)
+	}
+	defer func() { _ = h.Close() }()
+	w := New(nil).WithRules(set)
+	item := &api.Item{UUID: "00000000-0000-0000-0000-000000000001", Quantity: 4}
+	assert.Nil(t, w.Evaluate(item), "no previous observation without history")
+	w.WithHistory(h, 0)
+	assert.Nil(t, w.Evaluate(item), "no previous observation in history")
+	assert.NoError(t, h.Record(history.Observation{UUID: item.UUID, Quantity: 20, At: time.Now().Add(-time.Minute)}))
+	assert.NoError(t, h.Record(history.Observation{UUID: item.UUID, Quantity: 10, At: time.Now()}))
+	if alert := w.Evaluate(item); assert.NotNil(t, alert) {
+		assert.Equal(t, []string{"sudden_drop"}, alert.Rules)
+	}
+	// Item state of the worker goes first
+	w.transition(keyOf(item.UUID), 5, "", time.Now())
+	assert.Nil(t, w.Evaluate(item))
+}
+
+type mockHistory struct {
+	recorded  []history.Observation
+	stockouts map[string]time.Duration // time till stockout by UUID
+}
+
+func (m *mockHistory) Record(o history.Observation) error {
+	m.recorded = append(m.recorded, o)
+	return nil
+}
+
+func (m *mockHistory) StockoutAt(uuid string) (time.Time, bool) {
+	d, ok := m.stockouts[uuid]
+	return time.Now().Add(d), ok
+}
+
+func TestIsActive(t *testing.T) {
+	logBuffer := &bytes.Buffer{}
+	assert.True(t, New(nil).isActive())
+	l := &mockLeader{}
+	w := New(nil).WithLeader(l).WithLogger(log.New(logBuffer, "", 0))
+	assert.False(t, w.isActive())
+	assert.False(t, w.isActive())
+	l.leader = true
+	assert.True(t, w.isActive())
+	assert.True(t, w.isActive())
+	assert.Equal(t, "Standby, skipping checks\nLeader, running checks\n", logBuffer.String())
+}
+
+type mockLeader struct {
+	leader bool
+}
+
+func (m *mockLeader) IsLeader() bool { return m.leader }
@@ -0,0 +1,72 @@
+package worker
+
+import (
+	"time"
+)
+
+// SeverityEscalation is assigned to alerts about items staying in the same alert state for too long
+const SeverityEscalation = "escalation"
+
+// itemState tracks item observations between cycles
+type itemState struct {
+	quantity int       // Last observed quantity
+	observed time.Time // When the quantity was observed
+	severity string    // Current alert severity, empty if no alert
+	since    time.Time // When the current severity was entered
+	cycles   int       // Number of consecutive cycles with the current severity
+}
+
+// previous returns quantity observed in the previous cycle
+func (w *Worker) previous(id key) (int, bool) {
+	w.statesM.Lock()
+	defer w.statesM.Unlock()
+	if s, ok := w.states[id]; ok {
+		return s.quantity, true
+	}
+	return 0, false
+}
+
+// lastObservation returns quantity observed in the previous cycle and when it was observed
+func (w *Worker) lastObservation(id key) (int, time.Time, bool) {
+	w.statesM.Lock()
+	defer w.statesM.Unlock()
+	if s, ok := w.states[id]; ok {
+		return s.quantity, s.observed, true
+	}
+	return 0, time.Time{}, false
+}
+
+// transition records the observation and returns updated item state
+func (w *Worker) transition(id key, quantity int, severity string, at time.Time) itemState {
+	w.statesM.Lock()
+	defer w.statesM.Unlock()
+	s, ok := w.states[id]
+	if !ok {
+		s = &itemState{}
+		w.states[id] = s
+	}
+	if !ok || s.severity != severity {
+		s.severity = severity
+		s.since = at
+		s.cycles = 0
+	}
+	s.quantity = quantity
+	s.observed = at
+	s.cycles++
+	return *s
+}
+
+// forget drops item state, deferred alert, own check interval and cached details
+func (w *Worker) forget(id key) {
+	if c, ok := w.client.(cacheForgetter); ok {
+		c.Forget(w.format.String([]byte(id)))
+	}
+	w.queue.remove(id)
+	w.statesM.Lock()
+	delete(w.states, id)
+	w.statesM.Unlock()
+	w.recovered(id)
+	w.deferredM.Lock()
+	delete(w.deferred, id)
+	w.deferredM.Unlock()
+}
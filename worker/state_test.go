@@ -0,0 +1,93 @@
+package worker
+
+import (
+	"bytes"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/dmitry-vovk/csv-chg-go/api"
+	"github.com/dmitry-vovk/csv-chg-go/rules"
+	"github.com/dmitry-vovk/csv-chg-go/sink"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransition(t *testing.T) {
+	w := New(nil)
+	id := keyOf("00000000-0000-0000-0000-000000000001")
+	start := time.Now()
+	_, ok := w.previous(id)
+	assert.False(t, ok)
+	s := w.transition(id, 10, "", start)
+	assert.Equal(t, itemState{quantity: 10, observed: start, since: start, cycles: 1}, s)
+	s = w.transition(id, 4, rules.SeverityWarning, start.Add(time.Minute))
+	assert.Equal(t, itemState{quantity: 4, observed: start.Add(time.Minute), severity: rules.SeverityWarning, since: start.Add(time.Minute), cycles: 1}, s)
+	s = w.transition(id, 3, rules.SeverityWarning, start.Add(2*time.Minute))
+	assert.Equal(t, itemState{quantity: 3, observed: start.Add(2 * time.Minute), severity: rules.SeverityWarning, since: start.Add(time.Minute), cycles: 2}, s)
+	if q, ok := w.previous(id); assert.True(t, ok) {
+		assert.Equal(t, 3, q)
+	}
+	w.forget(id)
+	_, ok = w.previous(id)
+	assert.False(t, ok)
+}
+
+func TestForgetCachedItem(t *testing.T) {
+	c := &mockCachingClient{}
+	w := New(c)
+	w.forget(keyOf("00000000-0000-0000-0000-000000000001"))
+	assert.Equal(t, []string{"00000000-0000-0000-0000-000000000001"}, c.forgotten)
+}
+
+type mockCachingClient struct {
+	mockAPIClient
+	forgotten []string
+}
+
+func (m *mockCachingClient) Forget(uuid string) { m.forgotten = append(m.forgotten, uuid) }
+
+func TestEscalation(t *testing.T) {
+	w := New(nil).WithEscalation(3)
+	id := keyOf("00000000-0000-0000-0000-000000000001")
+	item := &api.Item{UUID: "00000000-0000-0000-0000-000000000001", Quantity: 4}
+	for i := 1; i <= 2; i++ {
+		if alert := w.check(id, item); assert.NotNil(t, alert) {
+			assert.Equal(t, rules.SeverityWarning, alert.Severity)
+			assert.Equal(t, i, alert.Cycles)
+		}
+	}
+	if alert := w.check(id, item); assert.NotNil(t, alert) {
+		assert.Equal(t, SeverityEscalation, alert.Severity)
+		assert.Equal(t, 3, alert.Cycles)
+		assert.NotNil(t, alert.StateSince)
+	}
+	// Recovery resets the state
+	item.Quantity = 10
+	assert.Nil(t, w.check(id, item))
+	item.Quantity = 4
+	if alert := w.check(id, item); assert.NotNil(t, alert) {
+		assert.Equal(t, rules.SeverityWarning, alert.Severity)
+		assert.Equal(t, 1, alert.Cycles)
+	}
+}
+
+func TestSinkFor(t *testing.T) {
+	c := &mockAPIClient{}
+	w := New(c).WithSink(rules.SeverityCritical, sink.Log{})
+	assert.Equal(t, sink.Log{}, w.sinkFor(rules.SeverityCritical))
+	assert.Equal(t, sink.API{Client: c}, w.sinkFor(rules.SeverityWarning))
+}
+
+func TestSend(t *testing.T) {
+	var buf bytes.Buffer
+	c := &mockAPIClient{}
+	w := New(c).WithSink(rules.SeverityCritical, sink.Log{Logger: log.New(&buf, "", 0)})
+	name, err := w.Send("00000000-0000-0000-0000-000000000001", &api.Alert{Severity: rules.SeverityCritical, Reason: api.ReasonRule, Rules: []string{"out_of_stock"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "log", name)
+	assert.Equal(t, "Alert critical for item \"00000000-0000-0000-0000-000000000001\": quantity 0, reason rule, rules out_of_stock\n", buf.String())
+	name, err = w.Send("00000000-0000-0000-0000-000000000001", &api.Alert{Severity: rules.SeverityWarning, Quantity: 1, Threshold: defaultThreshold})
+	assert.NoError(t, err)
+	assert.Equal(t, "api", name)
+	assert.Equal(t, 1, c.posts)
+}
@@ -0,0 +1,233 @@
+package worker
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+// key is binary item identifier, safe to retain and use as map key
+type key string
+
+// store is a set of binary item identifiers
+type store interface {
+	add(id []byte) bool        // Adds `id`, returns false if it is already present
+	remove(id []byte)          // Removes `id` if present
+	has(id []byte) bool        // Tells whether `id` is present
+	len() int                  // Number of identifiers
+	each(fn func(id key) bool) // Calls `fn` for every identifier until it returns false
+	settle()                   // Completes deferred work, so that `each` does not modify the store
+}
+
+// Store kinds
+const (
+	// StoreMap keeps identifiers in a map, fast to load, iterated in random order
+	StoreMap = "map"
+	// StoreSorted keeps identifiers in a sorted slice, about 18 bytes per UUID, slower to load, iterated in order.
+	// Only 16-byte keys are supported.
+	StoreSorted = "sorted"
+)
+
+// newStore returns an empty store of `kind` for keys of `size` bytes, 0 for variable size,
+// or nil for unknown kind or unsupported size
+func newStore(kind string, size int) store {
+	switch {
+	case kind == StoreMap && size == len(compact{}):
+		return make(mapStore)
+	case kind == StoreMap:
+		return make(stringStore)
+	case kind == StoreSorted && size == len(compact{}):
+		return &sortedStore{pending: make(map[compact]struct{})}
+	}
+	return nil
+}
+
+// mapStore is a map based store of 16-byte keys
+type mapStore map[compact]struct{}
+
+func (s mapStore) add(id []byte) bool {
+	c := toCompact(id)
+	if _, ok := s[c]; ok {
+		return false
+	}
+	s[c] = struct{}{}
+	return true
+}
+
+func (s mapStore) remove(id []byte)   { delete(s, toCompact(id)) }
+func (s mapStore) has(id []byte) bool { _, ok := s[toCompact(id)]; return ok }
+func (s mapStore) len() int           { return len(s) }
+func (s mapStore) settle()            {}
+
+func (s mapStore) each(fn func(id key) bool) {
+	for id := range s {
+		if !fn(key(id[:])) {
+			return
+		}
+	}
+}
+
+// stringStore is a map based store of variable length keys
+type stringStore map[key]struct{}
+
+func (s stringStore) add(id []byte) bool {
+	if _, ok := s[key(id)]; ok {
+		return false
+	}
+	s[key(id)] = struct{}{}
+	return true
+}
+
+func (s stringStore) remove(id []byte)   { delete(s, key(id)) }
+func (s stringStore) has(id []byte) bool { _, ok := s[key(id)]; return ok }
+func (s stringStore) len() int           { return len(s) }
+func (s stringStore) settle()            {}
+
+func (s stringStore) each(fn func(id key) bool) {
+	for id := range s {
+		if !fn(id) {
+			return
+		}
+	}
+}
+
+// sortedStore keeps 16-byte keys in a sorted slice.
+// New keys are collected in a small map and merged into the slice in batches,
+// so loading stays O(n log n) without keeping a second copy of the whole set.
+// Lookups go through a directory of bucket offsets by leading key bits,
+// so that a search touches a couple of cache lines instead of log(n) ones.
+type sortedStore struct {
+	sorted  []compact
+	pending map[compact]struct{}
+	index   []uint32 // Offset of the first key of every bucket, plus len(sorted) at the end
+	shift   uint     // Leading 64 bit word is shifted by that many bits to get bucket number
+}
+
+const (
+	minPending     = 4096 // Pending keys are merged when there are at least that many...
+	pendingDivisor = 8    // ...and more than 1/8 of sorted ones
+	bucketSize     = 4    // Average number of keys per index bucket
+)
+
+func (s *sortedStore) add(id []byte) bool {
+	if s.has(id) {
+		return false
+	}
+	s.pending[toCompact(id)] = struct{}{}
+	if len(s.pending) >= minPending && len(s.pending) > len(s.sorted)/pendingDivisor {
+		s.merge()
+	}
+	return true
+}
+
+func (s *sortedStore) remove(b []byte) {
+	id := toCompact(b)
+	if _, ok := s.pending[id]; ok {
+		delete(s.pending, id)
+		return
+	}
+	if i, ok := s.search(id); ok {
+		s.sorted = append(s.sorted[:i], s.sorted[i+1:]...)
+		for b := s.bucket(id) + 1; b < len(s.index); b++ {
+			s.index[b]--
+		}
+	}
+}
+
+func (s *sortedStore) has(b []byte) bool {
+	id := toCompact(b)
+	if _, ok := s.pending[id]; ok {
+		return true
+	}
+	_, ok := s.search(id)
+	return ok
+}
+
+func (s *sortedStore) len() int {
+	return len(s.sorted) + len(s.pending)
+}
+
+func (s *sortedStore) settle() {
+	s.merge()
+}
+
+func (s *sortedStore) each(fn func(id key) bool) {
+	s.merge()
+	for _, id := range s.sorted {
+		if !fn(key(id[:])) {
+			return
+		}
+	}
+}
+
+// bucket returns index bucket number of `id`
+func (s *sortedStore) bucket(id compact) int {
+	return int(binary.BigEndian.Uint64(id[:8]) >> s.shift)
+}
+
+// search returns position of `id` in sorted slice, or where it would be inserted
+func (s *sortedStore) search(id compact) (int, bool) {
+	if len(s.sorted) == 0 {
+		return 0, false
+	}
+	b := s.bucket(id)
+	lo, hi := int(s.index[b]), int(s.index[b+1])
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return !s.sorted[lo+i].less(id)
+	})
+	return i, i < len(s.sorted) && s.sorted[i] == id
+}
+
+// merge moves pending keys into sorted slice, merging from the back in place, and rebuilds the index
+func (s *sortedStore) merge() {
+	if len(s.pending) == 0 {
+		return
+	}
+	batch := make([]compact, 0, len(s.pending))
+	for id := range s.pending {
+		batch = append(batch, id)
+	}
+	sort.Sort(compactSlice(batch))
+	i := len(s.sorted) - 1
+	s.sorted = append(s.sorted, batch...)
+	for j, k := len(batch)-1, len(s.sorted)-1; j >= 0; k-- {
+		if i >= 0 && batch[j].less(s.sorted[i]) {
+			s.sorted[k] = s.sorted[i]
+			i--
+		} else {
+			s.sorted[k] = batch[j]
+			j--
+		}
+	}
+	s.pending = make(map[compact]struct{})
+	s.reindex()
+}
+
+// reindex rebuilds bucket directory sized for the current number of keys
+func (s *sortedStore) reindex() {
+	bits := uint(0)
+	for (len(s.sorted)/bucketSize)>>bits > 1 {
+		bits++
+	}
+	s.shift = 64 - bits
+	buckets := 1 << bits
+	if cap(s.index) >= buckets+1 {
+		s.index = s.index[:buckets+1]
+	} else {
+		s.index = make([]uint32, buckets+1)
+	}
+	pos := 0
+	for b := 0; b < buckets; b++ {
+		for pos < len(s.sorted) && s.bucket(s.sorted[pos]) < b {
+			pos++
+		}
+		s.index[b] = uint32(pos)
+	}
+	s.index[buckets] = uint32(len(s.sorted))
+}
+
+// compactSlice implements `sort.Interface`
+type compactSlice []compact
+
+func (s compactSlice) Len() int           { return len(s) }
+func (s compactSlice) Less(i, j int) bool { return s[i].less(s[j]) }
+func (s compactSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
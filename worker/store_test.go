@@ -0,0 +1,135 @@
+package worker
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"runtime"
+	"sort"
+	"testing"
+
+	"github.com/dmitry-vovk/csv-chg-go/ident"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStores(t *testing.T) {
+	for name, s := range map[string]store{
+		StoreMap:    newStore(StoreMap, 16),
+		StoreSorted: newStore(StoreSorted, 16),
+		"strings":   newStore(StoreMap, 0),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ids := randomIDs(3*minPending, 1)
+			for _, id := range ids {
+				assert.True(t, s.add(id[:]))
+			}
+			for _, id := range ids[:10] {
+				assert.False(t, s.add(id[:]), "duplicate should not be added")
+			}
+			assert.Equal(t, len(ids), s.len())
+			for _, id := range ids {
+				assert.True(t, s.has(id[:]))
+			}
+			// Remove from both sorted and pending parts
+			other := randomIDs(1, 2)[0]
+			s.remove(ids[0][:])
+			s.remove(ids[len(ids)-1][:])
+			s.remove(other[:])
+			assert.False(t, s.has(ids[0][:]))
+			assert.False(t, s.has(ids[len(ids)-1][:]))
+			assert.Equal(t, len(ids)-2, s.len())
+			seen := make(map[key]struct{})
+			s.each(func(id key) bool {
+				seen[id] = struct{}{}
+				return true
+			})
+			assert.Len(t, seen, len(ids)-2)
+			n := 0
+			s.each(func(id key) bool {
+				n++
+				return n < 5
+			})
+			assert.Equal(t, 5, n, "iteration should stop when asked")
+		})
+	}
+	assert.Nil(t, newStore("unknown", 16))
+	assert.Nil(t, newStore(StoreSorted, 0), "sorted store supports 16-byte keys only")
+}
+
+func TestSortedStoreOrder(t *testing.T) {
+	s := newStore(StoreSorted, 16)
+	for _, id := range randomIDs(minPending*5+17, 3) {
+		s.add(id[:])
+	}
+	var ids []key
+	s.each(func(id key) bool {
+		ids = append(ids, id)
+		return true
+	})
+	assert.Len(t, ids, minPending*5+17)
+	assert.True(t, sort.SliceIsSorted(ids, func(i, j int) bool { return ids[i] < ids[j] }))
+}
+
+func TestSortedStoreSkewed(t *testing.T) {
+	// Sequential UUIDs all fall into the same index bucket
+	s := newStore(StoreSorted, 16)
+	var ids []compact
+	for i := 0; i < minPending*3; i++ {
+		var id compact
+		binary.BigEndian.PutUint64(id[8:], uint64(i*2))
+		ids = append(ids, id)
+		assert.True(t, s.add(id[:]))
+	}
+	s.each(func(key) bool { return false })
+	for _, id := range ids {
+		assert.True(t, s.has(id[:]))
+		id[15]++
+		assert.False(t, s.has(id[:]))
+	}
+}
+
+func TestWithStore(t *testing.T) {
+	assert.IsType(t, &sortedStore{}, New(nil).WithStore(StoreSorted).uuids)
+	assert.IsType(t, stringStore{}, New(nil).WithIDFormat(ident.SKU{}).uuids)
+	assert.IsType(t, &sortedStore{}, New(nil).WithStore(StoreSorted).WithIDFormat(ident.ULID{}).uuids)
+	assert.Panics(t, func() { New(nil).WithStore("unknown") })
+	assert.Panics(t, func() { New(nil).WithStore(StoreSorted).WithIDFormat(ident.SKU{}) })
+}
+
+// randomIDs returns `n` distinct pseudo random UUIDs
+func randomIDs(n int, seed int64) []compact {
+	r := rand.New(rand.NewSource(seed))
+	ids := make([]compact, n)
+	for i := range ids {
+		_, _ = r.Read(ids[i][:])
+	}
+	return ids
+}
+
+// Loading 10M UUIDs, go test -run=- -bench=StoreLoad -benchtime=1x ./worker
+// BenchmarkStoreLoad/map      1   2888459660 ns/op   30.26 heap-B/uuid
+// BenchmarkStoreLoad/sorted   1  10427964430 ns/op   18.15 heap-B/uuid
+func BenchmarkStoreLoad(b *testing.B) {
+	const n = 10000000
+	ids := randomIDs(n, 1)
+	for _, kind := range []string{StoreMap, StoreSorted} {
+		b.Run(kind, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				before := heapAlloc()
+				s := newStore(kind, 16)
+				for _, id := range ids {
+					s.add(id[:])
+				}
+				s.each(func(key) bool { return false })
+				b.ReportMetric(float64(heapAlloc()-before)/n, "heap-B/uuid")
+				runtime.KeepAlive(s)
+			}
+		})
+	}
+}
+
+func heapAlloc() uint64 {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
@@ -1,56 +1,390 @@
 package worker
 
 import (
+	"context"
+	"fmt"
+	"log"
+	"runtime"
 	"sync"
 	"time"
 
 	"github.com/dmitry-vovk/csv-chg-go/api"
+	"github.com/dmitry-vovk/csv-chg-go/audit"
+	"github.com/dmitry-vovk/csv-chg-go/history"
+	"github.com/dmitry-vovk/csv-chg-go/ident"
+	"github.com/dmitry-vovk/csv-chg-go/limit"
+	"github.com/dmitry-vovk/csv-chg-go/metrics"
+	"github.com/dmitry-vovk/csv-chg-go/rules"
+	"github.com/dmitry-vovk/csv-chg-go/schedule"
+	"github.com/dmitry-vovk/csv-chg-go/sink"
+	"github.com/dmitry-vovk/csv-chg-go/trace"
 )
 
 type APIClient interface {
 	GetItem(uuid string) (*api.Item, error)
-	PostAlert(uuid string) error
+	PostAlert(uuid string, alert *api.Alert) error
+}
+
+// contextAPIClient is implemented by API clients making requests with context, e.g. to carry trace span
+type contextAPIClient interface {
+	GetItemContext(ctx context.Context, uuid string) (*api.Item, error)
+}
+
+// cacheForgetter is implemented by API clients caching item details
+type cacheForgetter interface {
+	Forget(uuid string)
+}
+
+// History records observed quantities and projects stockouts
+type History interface {
+	Record(o history.Observation) error
+	StockoutAt(uuid string) (time.Time, bool)
+}
+
+// recentHistory is implemented by histories keeping recent observations, e.g. history.Store
+type recentHistory interface {
+	Recent(uuid string) []history.Observation
+}
+
+// Auditor records alert decisions made for items
+type Auditor interface {
+	Record(r audit.Record) error
+}
+
+// Result is the outcome of an item check, or of a deferred alert delivery
+type Result struct {
+	UUID     string
+	Item     *api.Item  // Item details, nil if they could not be fetched
+	Alert    *api.Alert // Alert raised for the item, nil if none
+	Decision string     // What was done, one of audit decisions, e.g. audit.DecisionAlert
+	Sink     string     // Sink the alert was sent to, if any
+	Err      error      // API or sink error
+}
+
+// Sharder selects items this instance is responsible for
+type Sharder interface {
+	Owns(key []byte) bool
+}
+
+// Limiter bounds the number of parallel API requests, possibly adapting to their outcome
+type Limiter interface {
+	Acquire()                                       // Blocks until a request may start
+	Release()                                       // Frees the slot taken by Acquire
+	Observe(latency time.Duration, overloaded bool) // Reports request outcome
+	Limit() int                                     // Current number of allowed parallel requests
+	InFlight() int                                  // Number of requests in progress
+}
+
+// Leader tells whether this instance is allowed to run check cycles
+type Leader interface {
+	IsLeader() bool
 }
 
 type Worker struct {
-	client   APIClient            // API client instance
-	interval time.Duration        // Delay between requests cycles
-	uuids    map[compact]struct{} // List of UUIDs
-	deleteC  chan compact         // UUIDs to delete
-	wg       sync.WaitGroup       // Used to track request completion for graceful shutdown
-	doneC    chan struct{}        // Closed when requested to shut down
-	stoppedC chan struct{}        // Closed when shutdown has completed
-	limitC   chan struct{}        // Limits number of parallel requests
+	client     APIClient         // API client instance
+	schedule   schedule.Schedule // When check cycles run
+	queue      *itemQueue        // Items checked at their own intervals
+	minAuto    time.Duration     // Bounds of intervals derived from consumption, zero to disable
+	maxAuto    time.Duration
+	quiet      schedule.Windows     // Periods when alerts are deferred
+	deferred   map[key]deferred     // Alerts held back until quiet hours end
+	releaseAt  time.Time            // When deferred alerts are delivered
+	deferredM  sync.Mutex           // Guards deferred and releaseAt
+	threshold  int                  // Quantity below which alert is raised
+	instanceID string               // Identifies this worker instance in alerts
+	history    History              // Observations store, nil if disabled
+	horizon    time.Duration        // Projected stockouts within that period raise an alert
+	rules      rules.Set            // Alert conditions
+	sinks      map[string]sink.Sink // Alert destinations by severity
+	escalation int                  // Cycles in the same alert state before escalation, 0 to disable
+	states     map[key]*itemState   // Items state between cycles
+	statesM    sync.Mutex           // Guards states
+	backoffs   map[key]*backoff     // Delayed checks of items failing permanently
+	backoffsM  sync.Mutex           // Guards backoffs
+	sharder    Sharder              // Filters loaded identifiers, nil to load all
+	leader     Leader               // Gates check cycles, nil to always run
+	standby    bool                 // Whether the last cycle was skipped for not being leader
+	format     ident.Format         // Item identifiers format
+	storeKind  string               // Kind of identifiers store
+	uuids      store                // List of item identifiers
+	parsers    int                  // Number of goroutines validating input lines
+	maxLine    int                  // Input lines longer than that are rejected
+	uuidsM     sync.Mutex           // Guards uuids, iterating and postponed
+	iterating  int                  // Number of iterations over uuids in progress
+	postponed  []change             // Changes of uuids made while iterating
+	wg         sync.WaitGroup       // Used to track request completion for graceful shutdown
+	doneC      chan struct{}        // Closed when requested to shut down
+	stopOnce   sync.Once            // Guards closing doneC
+	stoppedC   chan struct{}        // Closed when shutdown has completed
+	started    bool                 // Whether Run has been called
+	startedM   sync.Mutex           // Guards started
+	drain      time.Duration        // How long shutdown waits for checks in progress, 0 to wait indefinitely
+	ctx        context.Context      // Context of checks, cancelled when drain timeout is exceeded
+	abort      context.CancelFunc   // Cancels ctx
+	inFlight   map[key]struct{}     // Items being checked
+	inFlightM  sync.Mutex           // Guards inFlight
+	skipped    int64                // Items not checked due to shutdown, accessed atomically
+	limiter    Limiter              // Limits number of parallel requests
+	requests   *metrics.Counter     // API item requests made, nil if metrics are disabled
+	apiErrors  *metrics.Counter     // API item requests failed, nil if metrics are disabled
+	logger     *log.Logger          // Worker log, nil for the standard logger
+	tracer     *trace.Tracer        // Traces cycles and item checks, nil if disabled
+	auditor    Auditor              // Records alert decisions, nil if disabled
+	onResult   func(Result)         // Called with every check result, nil if not set
 }
 
-const defaultWorkers = 1
+const (
+	defaultWorkers   = 1
+	defaultThreshold = 5
+)
 
-// New returns an instance of Worker
+// New returns an instance of Worker logging to the standard logger
 func New(client APIClient) *Worker {
+	ctx, abort := context.WithCancel(context.Background())
 	return &Worker{
-		client:   client,
-		uuids:    make(map[compact]struct{}),
-		deleteC:  make(chan compact),
-		doneC:    make(chan struct{}),
-		stoppedC: make(chan struct{}),
-		limitC:   make(chan struct{}, defaultWorkers),
+		client:    client,
+		threshold: defaultThreshold,
+		rules:     rules.Default(),
+		sinks:     make(map[string]sink.Sink),
+		states:    make(map[key]*itemState),
+		backoffs:  make(map[key]*backoff),
+		deferred:  make(map[key]deferred),
+		queue:     newItemQueue(),
+		format:    ident.UUID{},
+		storeKind: StoreMap,
+		uuids:     newStore(StoreMap, ident.UUID{}.Size()),
+		parsers:   runtime.GOMAXPROCS(0),
+		maxLine:   defaultMaxLineLength,
+		doneC:     make(chan struct{}),
+		stoppedC:  make(chan struct{}),
+		ctx:       ctx,
+		abort:     abort,
+		inFlight:  make(map[key]struct{}),
+		limiter:   limit.NewFixed(defaultWorkers),
 	}
 }
 
 // WithWorkersCount sets the limit of parallel API requests
 func (w *Worker) WithWorkersCount(n int) *Worker {
-	w.limitC = make(chan struct{}, n)
+	w.limiter = limit.NewFixed(n)
 	return w
 }
 
-// WithInterval sets the interval between series of requests
+// WithLimiter makes `l` decide how many parallel API requests are allowed, replacing workers count
+func (w *Worker) WithLimiter(l Limiter) *Worker {
+	w.limiter = l
+	return w
+}
+
+// WithMetrics registers worker metrics in `r`
+func (w *Worker) WithMetrics(r *metrics.Registry) *Worker {
+	r.GaugeFunc("csvchg_concurrency_limit", "Number of allowed parallel API requests", func() float64 {
+		return float64(w.limiter.Limit())
+	})
+	r.GaugeFunc("csvchg_requests_in_flight", "Number of items being checked", func() float64 {
+		return float64(w.limiter.InFlight())
+	})
+	w.requests = r.Counter("csvchg_api_requests_total", "API item requests made")
+	w.apiErrors = r.Counter("csvchg_api_errors_total", "API item requests failed")
+	return w
+}
+
+// WithTracer makes the worker trace check cycles, item checks and alerts with `t`
+func (w *Worker) WithTracer(t *trace.Tracer) *Worker {
+	w.tracer = t
+	return w
+}
+
+// WithAuditor makes the worker record every alert decision to `a`
+func (w *Worker) WithAuditor(a Auditor) *Worker {
+	w.auditor = a
+	return w
+}
+
+// WithResultHook makes the worker call `fn` with the result of every item check and deferred alert delivery.
+// It is called from the goroutines checking items, so it should be safe for concurrent use and return quickly.
+func (w *Worker) WithResultHook(fn func(Result)) *Worker {
+	w.onResult = fn
+	return w
+}
+
+// WithLogger makes the worker log to `l` instead of the standard logger,
+// e.g. `log.New(ioutil.Discard, "", 0)` silences it
+func (w *Worker) WithLogger(l *log.Logger) *Worker {
+	w.logger = l
+	return w
+}
+
+// logf logs a message to the worker logger, or to the standard logger if none is set
+func (w *Worker) logf(format string, v ...interface{}) {
+	if w.logger == nil {
+		_ = log.Output(2, fmt.Sprintf(format, v...))
+		return
+	}
+	_ = w.logger.Output(2, fmt.Sprintf(format, v...))
+}
+
+// WithInterval sets the interval between series of requests, replacing the schedule
 func (w *Worker) WithInterval(interval time.Duration) *Worker {
-	w.interval = interval
+	w.schedule = schedule.Every(interval)
+	return w
+}
+
+// WithSchedule sets when series of requests run, replacing the interval
+func (w *Worker) WithSchedule(s schedule.Schedule) *Worker {
+	w.schedule = s
+	return w
+}
+
+// WithAutoIntervals makes the worker check items at intervals derived from their consumption, bounded by `min` and `max`.
+// Items are checked on the worker schedule until consumption is observed, and while they are below threshold.
+func (w *Worker) WithAutoIntervals(min, max time.Duration) *Worker {
+	w.minAuto = min
+	w.maxAuto = max
+	return w
+}
+
+// WithQuietHours defers alerts raised within `q` until the windows end, alerts are then delivered in a batch
+func (w *Worker) WithQuietHours(q schedule.Windows) *Worker {
+	w.quiet = q
+	return w
+}
+
+// WithThreshold sets the quantity below which low stock alert is raised
+func (w *Worker) WithThreshold(threshold int) *Worker {
+	w.threshold = threshold
+	return w
+}
+
+// WithInstanceID sets the identifier of this worker instance reported in alerts
+func (w *Worker) WithInstanceID(id string) *Worker {
+	w.instanceID = id
+	return w
+}
+
+// WithHistory enables recording observations to `h`,
+// positive `horizon` raises alerts for items projected to run out within it
+func (w *Worker) WithHistory(h History, horizon time.Duration) *Worker {
+	w.history = h
+	w.horizon = horizon
+	return w
+}
+
+// WithRules sets alert conditions, replacing the default `quantity < threshold` rule
+func (w *Worker) WithRules(set rules.Set) *Worker {
+	w.rules = set
+	return w
+}
+
+// WithSink sends alerts of `severity` to `s` instead of warehouse API
+func (w *Worker) WithSink(severity string, s sink.Sink) *Worker {
+	w.sinks[severity] = s
 	return w
 }
 
-// Shutdown initiates worker stop and blocks until it finishes
+// WithEscalation raises alert severity to escalation
+// when an item stays in the same alert state for `cycles` cycles, 0 disables escalation
+func (w *Worker) WithEscalation(cycles int) *Worker {
+	w.escalation = cycles
+	return w
+}
+
+// WithSharder makes the worker load only identifiers owned by `s`
+func (w *Worker) WithSharder(s Sharder) *Worker {
+	w.sharder = s
+	return w
+}
+
+// WithLeader makes the worker skip check cycles while `l` is not the leader
+func (w *Worker) WithLeader(l Leader) *Worker {
+	w.leader = l
+	return w
+}
+
+// WithStore sets the kind of identifiers store, should be called before loading identifiers
+func (w *Worker) WithStore(kind string) *Worker {
+	w.storeKind = kind
+	w.resetStore()
+	return w
+}
+
+// WithIDFormat sets the format of item identifiers, should be called before loading identifiers
+func (w *Worker) WithIDFormat(f ident.Format) *Worker {
+	w.format = f
+	w.resetStore()
+	return w
+}
+
+// resetStore replaces identifiers store with an empty one matching store kind and identifiers format
+func (w *Worker) resetStore() {
+	s := newStore(w.storeKind, w.format.Size())
+	if s == nil {
+		panic(fmt.Sprintf("store kind %q is unknown or does not support %T identifiers", w.storeKind, w.format))
+	}
+	w.uuids = s
+}
+
+// WithParsers sets the number of goroutines validating input, one per CPU if `n` is less than one
+func (w *Worker) WithParsers(n int) *Worker {
+	if n < 1 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	w.parsers = n
+	return w
+}
+
+// WithMaxLineLength sets the length above which input lines are rejected
+func (w *Worker) WithMaxLineLength(n int) *Worker {
+	w.maxLine = n
+	return w
+}
+
+// sinkFor returns alert destination for `severity`
+func (w *Worker) sinkFor(severity string) sink.Sink {
+	if s, ok := w.sinks[severity]; ok {
+		return s
+	}
+	return sink.API{Client: w.client}
+}
+
+// sinkName names the sink in audit records, webhook URLs are left out as they may carry credentials
+func sinkName(s sink.Sink) string {
+	switch s.(type) {
+	case sink.API:
+		return "api"
+	case sink.Log:
+		return "log"
+	case *sink.Webhook:
+		return "webhook"
+	}
+	return fmt.Sprintf("%T", s)
+}
+
+// WithDrainTimeout limits how long shutdown waits for checks in progress, 0 waits indefinitely.
+// Checks still running after it are aborted and reported as abandoned.
+func (w *Worker) WithDrainTimeout(d time.Duration) *Worker {
+	w.drain = d
+	return w
+}
+
+// Shutdown initiates worker stop and blocks until Run returns.
+// It may be called several times, and before Run, which then returns right away.
 func (w *Worker) Shutdown() {
-	close(w.doneC)
-	<-w.stoppedC
+	w.stopOnce.Do(func() { close(w.doneC) })
+	w.startedM.Lock()
+	started := w.started
+	w.startedM.Unlock()
+	if started {
+		<-w.stoppedC
+	}
+}
+
+// stopping tells whether shutdown has been requested
+func (w *Worker) stopping() bool {
+	select {
+	case <-w.doneC:
+		return true
+	default:
+		return false
+	}
 }
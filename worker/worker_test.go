@@ -1,24 +1,79 @@
 package worker
 
 import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/dmitry-vovk/csv-chg-go/schedule"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestConstructor(t *testing.T) {
 	w := New(nil).WithWorkersCount(17).WithInterval(time.Second * 37)
-	assert.Equal(t, 17, cap(w.limitC))
-	assert.Equal(t, 37.0, w.interval.Seconds())
+	assert.Equal(t, 17, w.limiter.Limit())
+	assert.Equal(t, schedule.Every(37*time.Second), w.schedule)
+	assert.Equal(t, defaultThreshold, w.threshold)
+	w.WithThreshold(3).WithInstanceID("worker-1")
+	assert.Equal(t, 3, w.threshold)
+	assert.Equal(t, "worker-1", w.instanceID)
 }
 
 func TestShutdown(t *testing.T) {
 	w := New(nil).WithInterval(time.Second)
-	go w.Run()
+	go w.Run(context.Background())
 	time.Sleep(10 * time.Millisecond) // Wait for goroutine to start
 	assert.Eventually(t, func() bool {
+		w.Shutdown()
+		w.Shutdown()
+		return true
+	}, time.Millisecond*10, time.Millisecond)
+	// Shutdown before Run makes it return right away
+	w = New(nil).WithInterval(time.Second)
+	w.Shutdown()
+	assert.Eventually(t, func() bool {
+		assert.NoError(t, w.Run(context.Background()))
 		w.Shutdown()
 		return true
 	}, time.Millisecond*10, time.Millisecond)
 }
+
+func TestWithLogger(t *testing.T) {
+	std := &bytes.Buffer{}
+	log.SetOutput(std)
+	defer log.SetOutput(os.Stderr)
+	own := &bytes.Buffer{}
+	w := New(nil).WithLogger(log.New(own, "[london] ", log.Lmsgprefix))
+	assert.NoError(t, w.ReadUUIDs(strings.NewReader("00000000-0000-0000-0000-000000000001\n")))
+	assert.Equal(t, "[london] 1 records loaded, 0 skipped in", strings.Join(strings.Fields(own.String())[:7], " "))
+	assert.Empty(t, std.String())
+	// Without logger the standard one is used
+	log.SetFlags(log.Lshortfile)
+	defer log.SetFlags(log.LstdFlags)
+	w = New(nil)
+	assert.NoError(t, w.ReadUUIDs(strings.NewReader("00000000-0000-0000-0000-000000000001\nbad\n")))
+	assert.Contains(t, std.String(), "reader.go:")
+	assert.Contains(t, std.String(), "1 records loaded, 1 skipped in")
+}
+
+func TestRunContext(t *testing.T) {
+	assert.Equal(t, ErrNoSchedule, New(nil).Run(context.Background()))
+	w := New(nil).WithInterval(time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	errC := make(chan error, 1)
+	go func() { errC <- w.Run(ctx) }()
+	time.Sleep(10 * time.Millisecond) // Wait for goroutine to start
+	assert.Equal(t, ErrStarted, w.Run(context.Background()))
+	cancel()
+	select {
+	case err := <-errC:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(time.Second):
+		assert.Fail(t, "Run did not return on context cancellation")
+	}
+	w.Shutdown()
+}